@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"test-git/common"
+	"test-git/config"
+	"test-git/db"
+	"test-git/migrations"
+	"test-git/repository"
+	"test-git/service"
+)
+
+// openCommandDB 加載配置、初始化應用日志並連接主庫，表結構不是最新時拒絕繼續
+func openCommandDB(ctx context.Context, opts config.Options) (*config.Config, error) {
+	cfg, err := config.Load(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config:\n%v", err)
+	}
+	common.InitAppLogger(cfg.AppLog)
+	if err := db.Init(cfg.Database); err != nil {
+		return nil, err
+	}
+	migrator, err := db.NewMigrator(db.DB, migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	status, err := migrator.Status(ctx)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// cliActor 命令行操作在審計記錄裡的操作人，使用當前系統用戶名
+func cliActor() service.AdminActor {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return service.AdminActor{Name: "cli:" + name}
+}
+
+// commandAdmin 命令行使用的管理服務，讀寫 openCommandDB 連接的主庫
+func commandAdmin() *service.AdminService {
+	return service.NewAdminService(repository.NewGorm(db.DB))
+}
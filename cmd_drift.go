@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"test-git/config"
+	"test-git/db"
+	"test-git/migrations"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// runDrift 比較 gorm 模型和數據庫裡的表結構，有差異時返回 1
+//
+//	go run . drift -migrate     在空庫上先執行遷移再比較，用於 CI
+//	go run . drift -log-db=false
+func runDrift(args []string) int {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	var opts config.Options
+	opts.RegisterFlags(fs)
+	migrate := fs.Bool("migrate", false, "比較前執行未執行的遷移，並創建請求日志分區表")
+	checkLogDB := fs.Bool("log-db", true, "同時檢查請求日志庫的 request_logs")
+	timeout := fs.Duration("timeout", time.Minute, "整個檢查的超時")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := config.Load(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drift: invalid config:\n%v\n", err)
+		return 2
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if err := db.Init(cfg.Database); err != nil {
+		fmt.Fprintf(os.Stderr, "drift: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	if *migrate {
+		migrator, err := db.NewMigrator(db.DB, migrations.FS)
+		if err == nil {
+			_, err = migrator.Up(ctx, 0)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "drift: migrate: %v\n", err)
+			return 1
+		}
+	}
+	drifts, err := db.DiffSchema(ctx, db.DB, db.MainModels...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drift: %v\n", err)
+		return 1
+	}
+
+	if *checkLogDB {
+		var logDB *gorm.DB
+		if *migrate {
+			logDB, err = db.InitLogDB(cfg.LogDatabase, cfg.Partition)
+		} else {
+			logDB, err = db.OpenLogDB(cfg.LogDatabase)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "drift: log database: %v\n", err)
+			return 1
+		}
+		if sqlDB, err := logDB.DB(); err == nil {
+			defer sqlDB.Close()
+		}
+		logDrifts, err := db.DiffSchema(ctx, logDB, db.LogModels...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "drift: log database: %v\n", err)
+			return 1
+		}
+		drifts = append(drifts, logDrifts...)
+	}
+
+	if len(drifts) == 0 {
+		fmt.Println("no drift")
+		return 0
+	}
+	for _, drift := range drifts {
+		fmt.Printf("%s:\n", drift.Table)
+		for _, problem := range drift.Problems {
+			fmt.Printf("  %s\n", problem)
+		}
+	}
+	return 1
+}
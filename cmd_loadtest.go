@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"test-git/loadtest"
+	"time"
+)
+
+// runLoadTest 壓測 -target，結束後輸出 JSON 報告
+//
+//	go run . loadtest -target http://localhost:8080 -scenario upload -c 50 -d 30s
+//	go run . loadtest -target http://localhost:8080 -scenario mix -mix list=60,get=30,create=5,update=5 -users 20
+func runLoadTest(args []string) int {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	target := fs.String("target", "http://localhost:8080", "目標服務地址")
+	scenario := fs.String("scenario", loadtest.ScenarioUpload, "壓測場景：upload 或 mix")
+	file := fs.String("file", "role.json", "角色卡 JSON 文件")
+	concurrency := fs.Int("c", 10, "並發數")
+	duration := fs.Duration("d", 30*time.Second, "壓測時長")
+	users := fs.Int("users", 10, "虛擬用戶數")
+	mix := fs.String("mix", "list=50,get=30,create=10,update=10", "mix 場景的操作權重")
+	identity := fs.String("identity", loadtest.IdentityGateway, "身份來源：gateway 或 session")
+	timeout := fs.Duration("timeout", 10*time.Second, "單個請求超時")
+	seed := fs.Int64("seed", 1, "隨機種子，相同的種子得到相同的操作序列")
+	reportPath := fs.String("report", "loadtest-report.json", "JSON 報告輸出文件，為空時只打印")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	roleCard, err := os.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		return 2
+	}
+	weights, err := loadtest.ParseMix(*mix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		return 2
+	}
+	if *identity != loadtest.IdentityGateway && *identity != loadtest.IdentitySession {
+		fmt.Fprintf(os.Stderr, "loadtest: invalid -identity %q\n", *identity)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("running %s against %s for %s with %d workers\n", *scenario, *target, *duration, *concurrency)
+	report, err := loadtest.Run(ctx, loadtest.Options{
+		BaseURL:       *target,
+		Scenario:      *scenario,
+		RoleCard:      roleCard,
+		Concurrency:   *concurrency,
+		Duration:      *duration,
+		Users:         *users,
+		Mix:           weights,
+		Identity:      *identity,
+		SessionSecret: []byte(os.Getenv("SESSION_SECRET")),
+		GatewaySecret: []byte(os.Getenv("WX_GATEWAY_SECRET")),
+		Seed:          *seed,
+		Client: &http.Client{
+			Timeout:   *timeout,
+			Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency},
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		return 1
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if *reportPath != "" {
+		if err := os.WriteFile(*reportPath, out, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "loadtest: write report: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"test-git/config"
+	"test-git/db"
+	"test-git/migrations"
+)
+
+const migrateUsage = `usage: migrate [-config file] [-set KEY=VALUE] <command>
+
+commands:
+  up [N]        執行未執行的遷移，指定 N 時只執行 N 個
+  down N|-all   回滾 N 個遷移，-all 回滾全部
+  status        顯示當前版本
+  force V       把版本記錄改為 V 並清除 dirty 標記，不執行 SQL
+
+之前由 AutoMigrate 建表、沒有版本記錄的庫只有 roles 表（遷移 2）：先 up 1 創建 books，
+用 drift 確認 roles 與遷移一致後 force 2 記錄版本，再執行 up。up 遇到已經存在的表時不執行，並提示對應的命令。`
+
+// runMigrate 執行嵌入二進制文件的主庫遷移
+//
+//	go run . migrate up
+//	go run . migrate -config config.yaml down 1
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), migrateUsage) }
+	var opts config.Options
+	opts.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	command, rest := fs.Arg(0), fs.Args()[1:]
+
+	// 先校驗參數，不需要為錯誤的命令連接數據庫
+	n := 0
+	switch {
+	case command == "status" && len(rest) == 0:
+	case command == "up" && len(rest) <= 1:
+		if len(rest) == 1 {
+			if n = parseMigrateCount(rest[0]); n <= 0 {
+				fmt.Fprintf(os.Stderr, "migrate: invalid count %q\n", rest[0])
+				return 2
+			}
+		}
+	case command == "down" && len(rest) == 1:
+		if rest[0] != "-all" {
+			if n = parseMigrateCount(rest[0]); n <= 0 {
+				fmt.Fprintf(os.Stderr, "migrate: invalid count %q\n", rest[0])
+				return 2
+			}
+		}
+	case command == "force" && len(rest) == 1:
+		if n = parseMigrateCount(rest[0]); n < 0 {
+			fmt.Fprintf(os.Stderr, "migrate: invalid version %q\n", rest[0])
+			return 2
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: invalid config:\n%v\n", err)
+		return 2
+	}
+	if err := db.Init(cfg.Database); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	migrator, err := db.NewMigrator(db.DB, migrations.FS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var done []db.Migration
+	switch command {
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 1
+		}
+		for _, mig := range migrator.Migrations() {
+			state := "pending"
+			if mig.Version <= status.Current {
+				state = "applied"
+			}
+			fmt.Printf("%06d_%s\t%s\n", mig.Version, mig.Name, state)
+		}
+		fmt.Printf("version %d of %d, dirty=%v\n", status.Current, status.Latest, status.Dirty)
+		if status.Err() != nil {
+			return 1
+		}
+		return 0
+	case "up":
+		done, err = migrator.Up(ctx, n)
+	case "down":
+		done, err = migrator.Down(ctx, n)
+	case "force":
+		err = migrator.Force(ctx, uint(n))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		return 1
+	}
+	for _, mig := range done {
+		fmt.Printf("%s %06d_%s\n", command, mig.Version, mig.Name)
+	}
+	if command != "force" && len(done) == 0 {
+		fmt.Println("no change")
+	}
+	return 0
+}
+
+func parseMigrateCount(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return n
+}
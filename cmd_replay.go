@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"test-git/config"
+	"test-git/db"
+	"test-git/model"
+	"test-git/replay"
+	"time"
+)
+
+// runReplay 從 request_logs 或 NDJSON 文件讀取日志並回放到 -target
+//
+//	go run . replay -target http://localhost:8080 -from 2026-10-19T08:00:00Z -to 2026-10-19T09:00:00Z
+//	go run . replay -target http://localhost:8080 -file logs/request-logs.ndjson -speed 0
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("target", "", "目標服務地址，如 http://localhost:8080")
+	file := fs.String("file", "", "NDJSON 日志文件，不指定時讀取 request-log 庫")
+	fromStr := fs.String("from", "", "開始時間（RFC3339，默認1小時前）")
+	toStr := fs.String("to", "", "結束時間（RFC3339，默認現在）")
+	limit := fs.Int("limit", 10000, "最多回放的請求數")
+	speed := fs.Float64("speed", 1, "回放速度倍數，0 表示不等待")
+	concurrency := fs.Int("concurrency", 8, "最大並發請求數")
+	identity := fs.String("identity", replay.IdentitySession, "還原身份的方式：session、gateway 或 none")
+	adminToken := fs.String("admin-token", "", "回放 /admin 請求使用的管理員凭證，為空時跳過")
+	reportPath := fs.String("report", "", "把 JSON 報告寫到文件")
+	var opts config.Options
+	opts.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *target == "" {
+		fmt.Fprintln(os.Stderr, "replay: -target is required")
+		return 2
+	}
+	switch *identity {
+	case replay.IdentitySession, replay.IdentityGateway, replay.IdentityNone:
+	default:
+		fmt.Fprintf(os.Stderr, "replay: invalid -identity %q\n", *identity)
+		return 2
+	}
+
+	to := time.Now()
+	from := to.Add(-time.Hour)
+	var err error
+	if *fromStr != "" {
+		if from, err = time.Parse(time.RFC3339, *fromStr); err != nil {
+			fmt.Fprintf(os.Stderr, "replay: invalid -from: %v\n", err)
+			return 2
+		}
+	}
+	if *toStr != "" {
+		if to, err = time.Parse(time.RFC3339, *toStr); err != nil {
+			fmt.Fprintf(os.Stderr, "replay: invalid -to: %v\n", err)
+			return 2
+		}
+	}
+
+	cfg, err := config.Load(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: invalid config:\n%v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var logs []model.RequestLog
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+			return 1
+		}
+		logs, err = replay.ReadNDJSON(f, from, to, *limit)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay: read %s: %v\n", *file, err)
+			return 1
+		}
+	} else {
+		logDB, err := db.OpenLogDB(cfg.LogDatabase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay: log database: %v\n", err)
+			return 1
+		}
+		logs, err = replay.LoadFromDB(ctx, logDB, from, to, *limit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay: load request logs: %v\n", err)
+			return 1
+		}
+	}
+	if *identity == replay.IdentitySession && len(cfg.Session.Secret) == 0 {
+		fmt.Fprintln(os.Stderr, "replay: SESSION_SECRET is not set, replayed user requests will be rejected")
+	}
+	fmt.Printf("replaying %d requests against %s\n", len(logs), *target)
+
+	report := replay.Run(ctx, logs, replay.Options{
+		BaseURL:       *target,
+		Speed:         *speed,
+		Concurrency:   *concurrency,
+		Identity:      *identity,
+		SessionSecret: cfg.Session.Secret,
+		GatewaySecret: cfg.Gateway.Secret,
+		UserRefKey:    cfg.BodyCapture.UserRefKey,
+		AdminToken:    *adminToken,
+	})
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if *reportPath != "" {
+		if err := os.WriteFile(*reportPath, out, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "replay: write report: %v\n", err)
+			return 1
+		}
+	}
+	if report.Mismatched > 0 || report.Errors > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"test-git/config"
+	"test-git/db"
+	"test-git/fixture"
+	"test-git/handler"
+	"test-git/model"
+	"time"
+)
+
+// runSeed 把 role.json 格式的角色卡導入到指定用戶名下
+//
+//	go run . seed -openid o6_bmjrPTlm6_2sgVt7hMZOPfL2M role.json fixtures/
+func runSeed(args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	var opts config.Options
+	opts.RegisterFlags(fs)
+	openid := fs.String("openid", "", "角色所屬用戶的 openid")
+	skipExisting := fs.Bool("skip-existing", true, "跳過名稱和角色卡都相同的已有角色，可以重複執行")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *openid == "" || fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: seed -openid <openid> <file.json|dir>...")
+		return 2
+	}
+
+	cards, err := fixture.ReadCardFiles(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		return 1
+	}
+	roles := make([]model.Role, 0, len(cards))
+	for _, card := range cards {
+		role, err := handler.RoleFromCardJSON(card.Data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "seed: %s: %v\n", card.Path, err)
+			return 1
+		}
+		roles = append(roles, *role)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if _, err := openCommandDB(ctx, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	result, err := commandAdmin().ImportRoles(ctx, cliActor(), *openid, roles, *skipExisting, "seed")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("seeded %d roles for %s, skipped %d\n", result.Created, *openid, result.Skipped)
+	return 0
+}
+
+// runExport 把一個用戶的角色導出到目錄或壓縮包（.tar.gz/.tgz/.zip）
+//
+//	go run . export -openid o6_bmjrPTlm6_2sgVt7hMZOPfL2M backup/roles.tar.gz
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var opts config.Options
+	opts.RegisterFlags(fs)
+	openid := fs.String("openid", "", "導出哪個用戶的角色")
+	includeDeleted := fs.Bool("include-deleted", false, "同時導出已刪除的角色")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *openid == "" || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: export -openid <openid> <dir|file.tar.gz|file.zip>")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if _, err := openCommandDB(ctx, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	roles, err := commandAdmin().ExportRoles(ctx, cliActor(), *openid, *includeDeleted)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	records := make([]fixture.RoleRecord, len(roles))
+	for i, role := range roles {
+		records[i] = fixture.FromRole(role)
+	}
+	manifest := fixture.Manifest{WxUserID: *openid, ExportedAt: time.Now().UTC()}
+	if err := fixture.Write(fs.Arg(0), manifest, records); err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	fmt.Printf("exported %d roles of %s to %s\n", len(records), *openid, fs.Arg(0))
+	return 0
+}
+
+// runImport 導入 export 寫出的目錄或壓縮包，默認導入到原來的用戶名下
+//
+//	go run . import backup/roles.tar.gz
+//	go run . import -openid <another openid> backup/roles.tar.gz
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	var opts config.Options
+	opts.RegisterFlags(fs)
+	openid := fs.String("openid", "", "導入到哪個用戶名下，默認為導出時的用戶")
+	skipExisting := fs.Bool("skip-existing", true, "跳過名稱和角色卡都相同的已有角色，可以重複執行")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import [-openid <openid>] <dir|file.tar.gz|file.zip>")
+		return 2
+	}
+
+	manifest, records, err := fixture.Read(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	target := *openid
+	if target == "" {
+		target = manifest.WxUserID
+	}
+	if target == "" {
+		fmt.Fprintln(os.Stderr, "import: the export has no openid, pass -openid")
+		return 2
+	}
+	roles := make([]model.Role, len(records))
+	for i, record := range records {
+		roles[i] = record.Role()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if _, err := openCommandDB(ctx, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	result, err := commandAdmin().ImportRoles(ctx, cliActor(), target, roles, *skipExisting, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	fmt.Printf("imported %d roles for %s, skipped %d\n", result.Created, target, result.Skipped)
+	return 0
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"test-git/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AdminToken = "X-Admin-Token" // 管理員憑證請求頭
+	AdminActor = "admin_actor"
+)
+
+// AdminConfig 管理員憑證，每個憑證對應一個操作人名稱，用於審計
+type AdminConfig struct {
+	Tokens map[string]string // token -> actor
+}
+
+// LoadAdminConfig 讀取 ADMIN_TOKENS，格式為逗號分隔的 "name:token"
+func LoadAdminConfig(lookup func(string) (string, bool)) (AdminConfig, error) {
+	tokens, _ := lookup("ADMIN_TOKENS")
+	cfg := AdminConfig{Tokens: make(map[string]string)}
+	for _, item := range strings.Split(tokens, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(item, ":")
+		if !ok || name == "" || len(token) < 16 {
+			return cfg, fmt.Errorf("invalid ADMIN_TOKENS entry %q, want name:token with at least 16 characters", name)
+		}
+		cfg.Tokens[token] = name
+	}
+	return cfg, nil
+}
+
+// AdminMiddleware 校驗 X-Admin-Token，通過後以 admin 身份繼續處理
+func AdminMiddleware(cfg AdminConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor, ok := cfg.lookup(c.GetHeader(AdminToken))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(c, "管理员凭证无效"))
+			return
+		}
+
+		c.Set(AdminActor, actor)
+		setRequestUser(c, "admin:"+actor)
+		SetSubject(c, policy.Subject{UserID: "admin:" + actor, Roles: []policy.Role{policy.Admin}})
+		c.Next()
+	}
+}
+
+func GetAdminActor(c *gin.Context) string {
+	return c.GetString(AdminActor)
+}
+
+// lookup 逐個做常量時間比較，避免通過響應時間猜測憑證
+func (cfg AdminConfig) lookup(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	var (
+		actor string
+		found bool
+	)
+	for candidate, name := range cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			actor, found = name, true
+		}
+	}
+	return actor, found
+}
@@ -0,0 +1,194 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 應用日志的輸出格式
+const (
+	AppLogJSON = "json"
+	AppLogText = "text"
+)
+
+// AppLogConfig 應用日志（不是請求日志）的格式和級別
+type AppLogConfig struct {
+	Format        string
+	Level         slog.Level
+	PackageLevels map[string]slog.Level // 按 pkg 屬性覆蓋級別，如 db=debug
+	AddSource     bool
+}
+
+func LoadAppLogConfig(lookup func(string) (string, bool)) (AppLogConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := AppLogConfig{Format: AppLogJSON, Level: slog.LevelInfo, PackageLevels: map[string]slog.Level{}}
+	if v := getenv("LOG_FORMAT"); v != "" {
+		if v != AppLogJSON && v != AppLogText {
+			return cfg, fmt.Errorf("invalid LOG_FORMAT %q", v)
+		}
+		cfg.Format = v
+	}
+	if v := getenv("LOG_LEVEL"); v != "" {
+		if err := cfg.Level.UnmarshalText([]byte(v)); err != nil {
+			return cfg, fmt.Errorf("invalid LOG_LEVEL %q", v)
+		}
+	}
+	// LOG_LEVELS=db=debug,http=warn
+	if v := getenv("LOG_LEVELS"); v != "" {
+		for _, item := range splitList(v) {
+			pkg, levelStr, ok := strings.Cut(item, "=")
+			var level slog.Level
+			if !ok || pkg == "" || level.UnmarshalText([]byte(levelStr)) != nil {
+				return cfg, fmt.Errorf("invalid LOG_LEVELS entry %q", item)
+			}
+			cfg.PackageLevels[pkg] = level
+		}
+	}
+	if v := getenv("LOG_ADD_SOURCE"); v == "true" || v == "1" {
+		cfg.AddSource = true
+	}
+	return cfg, nil
+}
+
+// NewAppLogger 按配置創建 logger，log 包的輸出也會經過它
+func NewAppLogger(w io.Writer, cfg AppLogConfig) *slog.Logger {
+	// 底層 handler 放行所有級別，由 levelHandler 按包判斷
+	opts := &slog.HandlerOptions{Level: slog.Level(-100), AddSource: cfg.AddSource}
+	var h slog.Handler
+	if cfg.Format == AppLogText {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(&levelHandler{inner: h, level: cfg.Level, levels: cfg.PackageLevels})
+}
+
+// InitAppLogger 設置 slog 的默認 logger
+func InitAppLogger(cfg AppLogConfig) {
+	slog.SetDefault(NewAppLogger(os.Stderr, cfg))
+}
+
+// levelHandler 根據 With("pkg", ...) 設置的包名決定級別
+type levelHandler struct {
+	inner  slog.Handler
+	level  slog.Level
+	levels map[string]slog.Level
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithAttrs(attrs)
+	for _, a := range attrs {
+		if a.Key != "pkg" {
+			continue
+		}
+		if level, ok := h.levels[a.Value.String()]; ok {
+			clone.level = level
+		}
+	}
+	return &clone
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithGroup(name)
+	return &clone
+}
+
+type loggerKey struct{}
+
+// WithLogger 把 logger 放進 ctx，service 通過 Logger(ctx) 取出
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger 返回請求範圍的 logger（帶 request_id、route、user_ref 等），ctx 中沒有時返回默認 logger
+func Logger(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// addLogAttrs 為當前請求的 logger 追加屬性
+func addLogAttrs(c *gin.Context, args ...any) {
+	ctx := c.Request.Context()
+	c.Request = c.Request.WithContext(WithLogger(ctx, Logger(ctx).With(args...)))
+}
+
+// setRequestUser 記錄當前用戶，並把用戶引用（不是 openid 原文）加到請求的 logger 上
+func setRequestUser(c *gin.Context, userID string) {
+	c.Set(UserID, userID)
+	if ref := requestUserRef(userID); ref != "" {
+		addLogAttrs(c, "user_ref", ref)
+	}
+}
+
+// RequestLoggerMiddleware 為請求創建帶 request_id、route 和 trace_id 的 logger，結束時輸出一條訪問日志；
+// 需放在 RequestIDMiddleware 和 TracingMiddleware 之後
+func RequestLoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		args := []any{"request_id", GetRequestID(c), "method", c.Request.Method, "route", c.FullPath()}
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			args = append(args, "trace_id", sc.TraceID().String())
+		}
+		addLogAttrs(c, args...)
+
+		c.Next()
+
+		logger := Logger(c.Request.Context()).With("pkg", "http")
+		attrs := []any{
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip", c.ClientIP(),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "err", c.Errors.String())
+		}
+		if c.Writer.Status() >= 500 {
+			logger.ErrorContext(c.Request.Context(), "request completed", attrs...)
+		} else {
+			logger.InfoContext(c.Request.Context(), "request completed", attrs...)
+		}
+	}
+}
+
+// RecoveryMiddleware 捕獲 panic，記錄到應用日志並返回 500
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		Logger(c.Request.Context()).Error("panic recovered", "pkg", "http", "panic", fmt.Sprint(err), "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorBody(c, "服务器内部错误"))
+	})
+}
+
+// pkgLogger common 包內後台任務使用的 logger
+func pkgLogger() *slog.Logger {
+	return slog.With("pkg", "common")
+}
+
+// requestLogger common 包中間件使用的請求 logger
+func requestLogger(c *gin.Context) *slog.Logger {
+	return Logger(c.Request.Context()).With("pkg", "common")
+}
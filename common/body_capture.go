@@ -0,0 +1,159 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyCaptureConfig 請求日志記錄請求體和響應體的範圍，以及持久化前的遮蔽規則
+type BodyCaptureConfig struct {
+	Routes         []string // "POST /roles/create"、"/roles/:id"（任意方法）或 "*"，為空時不記錄
+	ContentTypes   []string // 如 application/json，以 "/*" 結尾表示前綴匹配
+	MaxBytes       int      // 請求體和響應體各自最多記錄的字節數
+	RedactPaths    []string // JSON 路徑，如 $..token
+	RedactPatterns []string // 正則，有捕獲組時只遮蔽第一個捕獲組
+	UserRefKey     []byte   // 生成用戶引用的密鑰，為空時記錄不可還原的哈希引用，見 UserRef
+}
+
+var (
+	defaultRedactPaths = []string{
+		"$..token", "$..access_token", "$..refresh_token", "$..session_key",
+		"$..openid", "$..wx_user_id", "$..code", "$..password", "$..secret",
+	}
+	defaultRedactPatterns = []string{
+		`(?i)bearer\s+([A-Za-z0-9._~+/=-]+)`,
+		`(?i)(?:^|&)(?:token|access_token|openid|code|session_key|secret)=([^&]*)`,
+	}
+)
+
+func LoadBodyCaptureConfig(lookup func(string) (string, bool)) (BodyCaptureConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := BodyCaptureConfig{
+		ContentTypes:   []string{"application/json"},
+		MaxBytes:       16 << 10,
+		RedactPaths:    defaultRedactPaths,
+		RedactPatterns: defaultRedactPatterns,
+		UserRefKey:     []byte(getenv("REQUEST_LOG_USER_KEY")),
+	}
+	if v := getenv("REQUEST_LOG_BODY_ROUTES"); v != "" {
+		cfg.Routes = splitList(v)
+	}
+	if v := getenv("REQUEST_LOG_BODY_CONTENT_TYPES"); v != "" {
+		cfg.ContentTypes = splitList(v)
+	}
+	if v := getenv("REQUEST_LOG_BODY_MAX_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("invalid REQUEST_LOG_BODY_MAX_BYTES %q", v)
+		}
+		cfg.MaxBytes = n
+	}
+	if v, ok := lookup("REQUEST_LOG_REDACT_PATHS"); ok {
+		cfg.RedactPaths = splitList(v)
+	}
+	// 正則中可能有逗號，使用 JSON 數組配置
+	if v, ok := lookup("REQUEST_LOG_REDACT_PATTERNS"); ok {
+		cfg.RedactPatterns = nil
+		if v != "" {
+			if err := json.Unmarshal([]byte(v), &cfg.RedactPatterns); err != nil {
+				return cfg, fmt.Errorf("invalid REQUEST_LOG_REDACT_PATTERNS: %v", err)
+			}
+		}
+	}
+	if _, err := NewRedactor(cfg.RedactPaths, cfg.RedactPatterns); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// envGetter 把 os.LookupEnv 形式的查找函數轉成 os.Getenv 形式，未設置時返回空串
+func envGetter(lookup func(string) (string, bool)) func(string) string {
+	return func(key string) string {
+		v, _ := lookup(key)
+		return v
+	}
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
+var (
+	bodyCaptureCfg BodyCaptureConfig
+	logRedactor    *Redactor
+)
+
+// ConfigureBodyCapture 設置請求體記錄和遮蔽規則，需要在 RequestLogMiddleware 處理請求之前調用
+func ConfigureBodyCapture(cfg BodyCaptureConfig) error {
+	redactor, err := NewRedactor(cfg.RedactPaths, cfg.RedactPatterns)
+	if err != nil {
+		return err
+	}
+	bodyCaptureCfg = cfg
+	logRedactor = redactor
+	userRefKey = cfg.UserRefKey
+	return nil
+}
+
+// shouldCaptureBody 路由是否在記錄範圍内，未匹配的路由不記錄
+func shouldCaptureBody(c *gin.Context) bool {
+	route := c.FullPath()
+	if route == "" {
+		return false
+	}
+	for _, r := range bodyCaptureCfg.Routes {
+		if r == "*" || r == route || r == c.Request.Method+" "+route {
+			return true
+		}
+	}
+	return false
+}
+
+func captureContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+	for _, t := range bodyCaptureCfg.ContentTypes {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// peekRequestBody 讀出請求體的前 limit 字節，並把請求體還原給後面的處理函數
+func peekRequestBody(c *gin.Context, limit int) ([]byte, bool) {
+	if c.Request.Body == nil {
+		return nil, false
+	}
+	head, err := io.ReadAll(io.LimitReader(c.Request.Body, int64(limit)+1))
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), c.Request.Body), c.Request.Body}
+	if err != nil {
+		return nil, false
+	}
+	if len(head) > limit {
+		return head[:limit:limit], true
+	}
+	return head, false
+}
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WxSignature = "X-WX-SIGNATURE" // 網關對身份請求頭的 HMAC 簽名
+	WxTimestamp = "X-WX-TIMESTAMP" // 簽名時間戳（unix 秒）
+)
+
+var (
+	ErrUntrustedSource  = errors.New("identity headers from untrusted source")
+	ErrInvalidSignature = errors.New("invalid identity header signature")
+	ErrSignatureExpired = errors.New("identity header signature outside replay window")
+)
+
+// GatewayConfig 微信雲托管網關的信任配置
+type GatewayConfig struct {
+	Enabled        bool         // 是否接受 X-WX-* 身份請求頭
+	TrustedProxies []*net.IPNet // 允許注入身份請求頭的對端地址
+	Secret         []byte       // 配置後要求 X-WX-SIGNATURE 簽名
+	ReplayWindow   time.Duration
+}
+
+func LoadGatewayConfig(lookup func(string) (string, bool)) (GatewayConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := GatewayConfig{
+		Enabled:      getenv("WX_TRUST_HEADER") == "true",
+		Secret:       []byte(getenv("WX_GATEWAY_SECRET")),
+		ReplayWindow: 5 * time.Minute,
+	}
+
+	proxies, err := ParseCIDRs(getenv("WX_TRUSTED_PROXIES"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.TrustedProxies = proxies
+
+	if v := getenv("WX_GATEWAY_REPLAY_WINDOW"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return cfg, fmt.Errorf("invalid WX_GATEWAY_REPLAY_WINDOW %q", v)
+		}
+		cfg.ReplayWindow = window
+	}
+
+	if cfg.Enabled && len(cfg.TrustedProxies) == 0 && len(cfg.Secret) == 0 {
+		return cfg, errors.New("WX_TRUST_HEADER requires WX_TRUSTED_PROXIES or WX_GATEWAY_SECRET")
+	}
+	return cfg, nil
+}
+
+// ParseCIDRs 解析逗號分隔的 CIDR 列表，單個 IP 視為 /32 或 /128
+func ParseCIDRs(value string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", item, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// SignIdentityHeaders 計算身份請求頭的簽名，網關和服務端使用相同算法
+func SignIdentityHeaders(secret []byte, openID, appID, unionID, env string, timestamp int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{openID, appID, unionID, env, strconv.FormatInt(timestamp, 10)}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校驗攜帶身份請求頭的請求是否來自可信網關
+func (cfg GatewayConfig) Verify(r *http.Request, now time.Time) error {
+	if !cfg.Enabled || !cfg.isTrustedPeer(r.RemoteAddr) {
+		return ErrUntrustedSource
+	}
+	if len(cfg.Secret) == 0 {
+		return nil
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(WxTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected := SignIdentityHeaders(cfg.Secret,
+		r.Header.Get(WxOpenID), r.Header.Get(WxAppID), r.Header.Get(WxUnionID), r.Header.Get(WxEnv), timestamp)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(r.Header.Get(WxSignature)))) {
+		return ErrInvalidSignature
+	}
+
+	skew := now.Sub(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > cfg.ReplayWindow {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// isTrustedPeer 只看 TCP 對端地址，不能用 X-Forwarded-For，否則同樣可以偽造
+func (cfg GatewayConfig) isTrustedPeer(remoteAddr string) bool {
+	if len(cfg.TrustedProxies) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range cfg.TrustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIdentityHeaders(r *http.Request) bool {
+	for _, h := range []string{WxOpenID, WxAppID, WxUnionID, WxEnv} {
+		if r.Header.Get(h) != "" {
+			return true
+		}
+	}
+	return false
+}
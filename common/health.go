@@ -0,0 +1,182 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthConfig struct {
+	Timeout           time.Duration // 單個依賴檢查的超時
+	LogQueueThreshold float64       // 日志隊列使用率超過這個值時報告飽和
+}
+
+func LoadHealthConfig(lookup func(string) (string, bool)) (HealthConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := HealthConfig{Timeout: 2 * time.Second, LogQueueThreshold: 0.9}
+	if v := getenv("HEALTH_CHECK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid HEALTH_CHECK_TIMEOUT %q", v)
+		}
+		cfg.Timeout = d
+	}
+	if v := getenv("HEALTH_LOG_QUEUE_THRESHOLD"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			return cfg, fmt.Errorf("invalid HEALTH_LOG_QUEUE_THRESHOLD %q", v)
+		}
+		cfg.LogQueueThreshold = f
+	}
+	return cfg, nil
+}
+
+// HealthCheckFunc 檢查一個依賴，返回的詳情會放進 /readyz 的響應
+type HealthCheckFunc func(ctx context.Context) (map[string]interface{}, error)
+
+type healthCheck struct {
+	name     string
+	critical bool
+	fn       HealthCheckFunc
+}
+
+// Health 就緒檢查：關鍵依賴失敗時返回 503，非關鍵依賴失敗只標記為 degraded
+type Health struct {
+	cfg          HealthConfig
+	checks       []healthCheck
+	shuttingDown atomic.Bool
+}
+
+func NewHealth(cfg HealthConfig) *Health {
+	return &Health{cfg: cfg}
+}
+
+// Add 註冊依賴檢查，需要在處理請求之前調用
+func (h *Health) Add(name string, critical bool, fn HealthCheckFunc) {
+	h.checks = append(h.checks, healthCheck{name: name, critical: critical, fn: fn})
+}
+
+// SetShuttingDown 開始停止服務後 /readyz 返回 503，負載均衡不再轉發新請求
+func (h *Health) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// 就緒狀態
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+type CheckResult struct {
+	Status    string                 `json:"status"` // up 或 down
+	Critical  bool                   `json:"critical"`
+	LatencyMs float64                `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+type ReadinessReport struct {
+	Status       string                 `json:"status"`
+	ShuttingDown bool                   `json:"shutting_down"`
+	Checks       map[string]CheckResult `json:"checks"`
+}
+
+// Check 並發執行所有依賴檢查
+func (h *Health) Check(ctx context.Context) ReadinessReport {
+	report := ReadinessReport{
+		Status:       HealthOK,
+		ShuttingDown: h.shuttingDown.Load(),
+		Checks:       make(map[string]CheckResult, len(h.checks)),
+	}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check healthCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, h.cfg.Timeout)
+			defer cancel()
+			start := time.Now()
+			details, err := check.fn(checkCtx)
+			result := CheckResult{
+				Status:    "up",
+				Critical:  check.critical,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Details:   details,
+			}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			report.Checks[check.name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == "up" {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthUnavailable
+		} else if report.Status == HealthOK {
+			report.Status = HealthDegraded
+		}
+	}
+	if report.ShuttingDown {
+		report.Status = HealthUnavailable
+	}
+	return report
+}
+
+// LivenessHandler 進程存活即返回 200，不檢查依賴，避免數據庫故障時進程被反復重啟
+func (h *Health) LivenessHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": HealthOK})
+	}
+}
+
+// ReadinessHandler 返回每個依賴的檢查結果，不可用或正在停止時返回 503
+func (h *Health) ReadinessHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := h.Check(c.Request.Context())
+		status := http.StatusOK
+		if report.Status == HealthUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
+
+// LogQueueCheck 日志隊列使用率超過閾值時報告飽和
+func LogQueueCheck(threshold float64) HealthCheckFunc {
+	return func(context.Context) (map[string]interface{}, error) {
+		stats := GetLogQueueStats()
+		usage := 0.0
+		if stats.Capacity > 0 {
+			usage = float64(stats.Depth) / float64(stats.Capacity)
+		}
+		details := map[string]interface{}{
+			"depth":    stats.Depth,
+			"capacity": stats.Capacity,
+			"usage":    usage,
+			"dropped":  stats.Dropped,
+			"overflow": stats.Overflow,
+		}
+		if usage >= threshold {
+			return details, fmt.Errorf("log queue saturated: %.0f%% used", usage*100)
+		}
+		return details, nil
+	}
+}
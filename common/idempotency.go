@@ -0,0 +1,379 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	IdempotencyKey      = "Idempotency-Key"
+	IdempotencyReplayed = "Idempotency-Replayed"
+
+	maxIdempotencyKeyLen = 255
+	// 需要讀入內存計算哈希，請求體超過上限時不做冪等處理
+	defaultIdempotencyMaxBytes = 1 << 20
+	// 持有 key 的請求超過這個時間仍未完成，認為處理它的進程已經退出，允許重試接管
+	idempotencyLockTimeout = time.Minute
+)
+
+// IdempotencyRecord 某個 key 第一次請求的處理結果
+type IdempotencyRecord struct {
+	RequestHash string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore 冪等記錄存儲
+type IdempotencyStore interface {
+	// Reserve 佔用 key，成功返回 nil；key 已被佔用時返回已有記錄
+	Reserve(ctx context.Context, scope, key, requestHash string, now time.Time, ttl time.Duration) (*IdempotencyRecord, error)
+	// Complete 保存第一次請求的響應，之後的重試直接重放
+	Complete(ctx context.Context, scope, key string, record IdempotencyRecord) error
+	// Release 放棄佔用，讓重試可以重新執行
+	Release(ctx context.Context, scope, key string) error
+}
+
+type IdempotencyConfig struct {
+	Store    string // memory 或 postgres
+	TTL      time.Duration
+	MaxBytes int64 // 帶 Idempotency-Key 的請求體上限，超過返回 413；0 使用默認值 1MB
+}
+
+func LoadIdempotencyConfig(lookup func(string) (string, bool)) (IdempotencyConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := IdempotencyConfig{Store: "memory", TTL: 24 * time.Hour, MaxBytes: defaultIdempotencyMaxBytes}
+	if v := getenv("IDEMPOTENCY_STORE"); v != "" {
+		if v != "memory" && v != "postgres" {
+			return cfg, fmt.Errorf("invalid IDEMPOTENCY_STORE %q", v)
+		}
+		cfg.Store = v
+	}
+	if v := getenv("IDEMPOTENCY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return cfg, fmt.Errorf("invalid IDEMPOTENCY_TTL %q", v)
+		}
+		cfg.TTL = ttl
+	}
+	if v := getenv("IDEMPOTENCY_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("invalid IDEMPOTENCY_MAX_BYTES %q", v)
+		}
+		cfg.MaxBytes = n
+	}
+	return cfg, nil
+}
+
+func NewIdempotencyStore(cfg IdempotencyConfig, db *gorm.DB) IdempotencyStore {
+	if cfg.Store == "postgres" {
+		return NewPostgresIdempotencyStore(db)
+	}
+	return NewMemoryIdempotencyStore()
+}
+
+// IdempotencyMiddleware 處理 POST 請求的 Idempotency-Key
+//
+// 同一用戶同一 key 的第一次請求正常執行並保存響應；之後負載相同的重試直接重放保存的響應，
+// 負載不同返回 422，第一次請求仍在處理中返回 409。5xx 響應不保存，允許客戶端重試。
+// multipart 請求每次重試的分隔符不同，無法比較負載，帶 key 時返回 400；請求體超過 MaxBytes 返回 413。
+func IdempotencyMiddleware(cfg IdempotencyConfig, store IdempotencyStore) gin.HandlerFunc {
+	maxBytes := cfg.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultIdempotencyMaxBytes
+	}
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKey)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorBody(c, "Idempotency-Key 过长"))
+			return
+		}
+
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorBody(c, "multipart 请求不支持 Idempotency-Key"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, ErrorBody(c, fmt.Sprintf("请求体超过 %d 字节，不支持 Idempotency-Key", maxBytes)))
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorBody(c, "读取请求体失败："+err.Error()))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// 與限流相同，未登錄時按 ClientIP 隔離，依賴 SetTrustedProxies
+		scope := "ip:" + c.ClientIP()
+		if userID := GetUserID(c); userID != "" {
+			scope = "user:" + userID
+		}
+		hash := requestHash(c.Request.Method, c.Request.URL.Path, body)
+
+		existing, err := store.Reserve(c.Request.Context(), scope, key, hash, time.Now(), cfg.TTL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorBody(c, "幂等检查失败："+err.Error()))
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != hash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, ErrorBody(c, "Idempotency-Key 已用于不同的请求"))
+			case !existing.Completed:
+				c.AbortWithStatusJSON(http.StatusConflict, ErrorBody(c, "相同请求正在处理中"))
+			default:
+				c.Header(IdempotencyReplayed, "true")
+				c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		writer := newBodyCaptureWriter(c.Writer, 0)
+		c.Writer = writer
+		c.Next()
+
+		// 請求的 context 可能已經被取消，保存結果使用獨立的 context
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			err = store.Release(ctx, scope, key)
+		} else {
+			err = store.Complete(ctx, scope, key, IdempotencyRecord{
+				RequestHash: hash,
+				Completed:   true,
+				StatusCode:  status,
+				ContentType: writer.Header().Get("Content-Type"),
+				Body:        writer.body.Bytes(),
+			})
+		}
+		if err != nil {
+			requestLogger(c).Error("save idempotency record fails", "err", err)
+		}
+	}
+}
+
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bodyCaptureWriter 在寫出響應的同時保留一份響應體，limit 大於 0 時最多保留 limit 字節
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body      *bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newBodyCaptureWriter(w gin.ResponseWriter, limit int) *bodyCaptureWriter {
+	return &bodyCaptureWriter{ResponseWriter: w, body: &bytes.Buffer{}, limit: limit}
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyCaptureWriter) capture(b []byte) {
+	if w.limit > 0 && w.body.Len()+len(b) > w.limit {
+		b = b[:w.limit-w.body.Len()]
+		w.truncated = true
+	}
+	w.body.Write(b)
+}
+
+type memoryIdempotencyEntry struct {
+	record    IdempotencyRecord
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// MemoryIdempotencyStore 進程內冪等記錄，只適用於單副本部署
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryIdempotencyEntry
+	lastSweep time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]*memoryIdempotencyEntry)}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, scope, key, requestHash string, now time.Time, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, e := range s.entries {
+			if now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	id := scope + "|" + key
+	if e, ok := s.entries[id]; ok && now.Before(e.expiresAt) &&
+		(e.record.Completed || now.Sub(e.createdAt) < idempotencyLockTimeout) {
+		record := e.record
+		return &record, nil
+	}
+	s.entries[id] = &memoryIdempotencyEntry{
+		record:    IdempotencyRecord{RequestHash: requestHash},
+		createdAt: now,
+		expiresAt: now.Add(ttl),
+	}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, scope, key string, record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[scope+"|"+key]; ok {
+		e.record = record
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, scope+"|"+key)
+	return nil
+}
+
+// PostgresIdempotencyStore 冪等記錄存放在 idempotency_keys 表，多副本共享
+type PostgresIdempotencyStore struct {
+	db *gorm.DB
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewPostgresIdempotencyStore(db *gorm.DB) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{db: db}
+}
+
+// 新 key 直接插入；已過期或持有者超時未完成的 key 可以被接管
+const reserveIdempotencyKeySQL = `
+INSERT INTO idempotency_keys AS k (scope, key, request_hash, completed, status_code, content_type, response_body, created_at, expires_at)
+VALUES (@scope, @key, @hash, false, 0, '', NULL, @now, @expires)
+ON CONFLICT (scope, key) DO UPDATE SET
+	request_hash = EXCLUDED.request_hash,
+	completed = false,
+	status_code = 0,
+	content_type = '',
+	response_body = NULL,
+	created_at = EXCLUDED.created_at,
+	expires_at = EXCLUDED.expires_at
+WHERE k.expires_at < @now OR (k.completed = false AND k.created_at < @stale)`
+
+func (s *PostgresIdempotencyStore) Reserve(ctx context.Context, scope, key, requestHash string, now time.Time, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.maybeCleanup(now)
+
+	// 佔用失敗後讀取已有記錄之前，記錄可能剛好被釋放或清理，此時重新佔用
+	const attempts = 3
+	for i := 0; i < attempts; i++ {
+		result := s.db.WithContext(ctx).Exec(reserveIdempotencyKeySQL,
+			sql.Named("scope", scope),
+			sql.Named("key", key),
+			sql.Named("hash", requestHash),
+			sql.Named("now", now),
+			sql.Named("expires", now.Add(ttl)),
+			sql.Named("stale", now.Add(-idempotencyLockTimeout)),
+		)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var row struct {
+			RequestHash  string
+			Completed    bool
+			StatusCode   int
+			ContentType  string
+			ResponseBody []byte
+		}
+		result = s.db.WithContext(ctx).
+			Raw("SELECT request_hash, completed, status_code, content_type, response_body FROM idempotency_keys WHERE scope = ? AND key = ?", scope, key).
+			Scan(&row)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		return &IdempotencyRecord{
+			RequestHash: row.RequestHash,
+			Completed:   row.Completed,
+			StatusCode:  row.StatusCode,
+			ContentType: row.ContentType,
+			Body:        row.ResponseBody,
+		}, nil
+	}
+	return nil, fmt.Errorf("reserve idempotency key %q: record kept disappearing after %d attempts", key, attempts)
+}
+
+func (s *PostgresIdempotencyStore) Complete(ctx context.Context, scope, key string, record IdempotencyRecord) error {
+	return s.db.WithContext(ctx).Exec(
+		"UPDATE idempotency_keys SET completed = true, status_code = ?, content_type = ?, response_body = ? WHERE scope = ? AND key = ? AND request_hash = ?",
+		record.StatusCode, record.ContentType, record.Body, scope, key, record.RequestHash,
+	).Error
+}
+
+func (s *PostgresIdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	return s.db.WithContext(ctx).Exec(
+		"DELETE FROM idempotency_keys WHERE scope = ? AND key = ? AND completed = false", scope, key,
+	).Error
+}
+
+// maybeCleanup 每十分鐘在後台刪除一次過期記錄
+func (s *PostgresIdempotencyStore) maybeCleanup(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastCleanup) < 10*time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastCleanup = now
+	s.mu.Unlock()
+
+	go func() {
+		if err := s.db.Exec("DELETE FROM idempotency_keys WHERE expires_at < ?", now).Error; err != nil {
+			pkgLogger().Error("idempotency cleanup fails", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,358 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"test-git/model"
+	"time"
+)
+
+// 隊列滿時的處理方式
+const (
+	OverflowDropNewest = "drop-newest" // 丟棄新日志
+	OverflowDropOldest = "drop-oldest" // 丟棄隊列中最舊的日志
+	OverflowBlock      = "block"       // 請求等待隊列有空位，超時後丟棄；隊列滿時拖慢請求
+	OverflowSpill      = "spill"       // 寫到本地文件，隊列空閒時再寫出
+)
+
+type LogQueueConfig struct {
+	Size         int
+	Overflow     string
+	BlockTimeout time.Duration
+	SpillDir     string
+}
+
+func LoadLogQueueConfig(lookup func(string) (string, bool)) (LogQueueConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := LogQueueConfig{
+		Size:         10000,
+		Overflow:     OverflowDropNewest,
+		BlockTimeout: 100 * time.Millisecond,
+		SpillDir:     filepath.Join("logs", "spill"),
+	}
+	if v := getenv("REQUEST_LOG_QUEUE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("invalid REQUEST_LOG_QUEUE_SIZE %q", v)
+		}
+		cfg.Size = n
+	}
+	if v := getenv("REQUEST_LOG_OVERFLOW"); v != "" {
+		switch v {
+		case OverflowDropNewest, OverflowDropOldest, OverflowBlock, OverflowSpill:
+			cfg.Overflow = v
+		default:
+			return cfg, fmt.Errorf("invalid REQUEST_LOG_OVERFLOW %q", v)
+		}
+	}
+	if v := getenv("REQUEST_LOG_BLOCK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid REQUEST_LOG_BLOCK_TIMEOUT %q", v)
+		}
+		cfg.BlockTimeout = d
+	}
+	if v := getenv("REQUEST_LOG_SPILL_DIR"); v != "" {
+		cfg.SpillDir = v
+	}
+	return cfg, nil
+}
+
+var (
+	logQueue     = make(chan model.RequestLog, 10000)
+	logQueueCfg  = LogQueueConfig{Size: 10000, Overflow: OverflowDropNewest}
+	logSpillFile = newLogSpill("")
+
+	logsEnqueued atomic.Int64
+	logsDropped  atomic.Int64
+	logsSpilled  atomic.Int64
+	logsWritten  atomic.Int64
+	logsFailed   atomic.Int64
+)
+
+// ConfigureLogQueue 設置隊列大小和溢出策略，需要在 StartLogWriter 和 RequestLogMiddleware 之前調用
+func ConfigureLogQueue(cfg LogQueueConfig) error {
+	if cfg.Overflow == OverflowSpill {
+		if err := os.MkdirAll(cfg.SpillDir, 0o755); err != nil {
+			return err
+		}
+	}
+	logQueue = make(chan model.RequestLog, cfg.Size)
+	logQueueCfg = cfg
+	logSpillFile = newLogSpill(cfg.SpillDir)
+	return nil
+}
+
+// LogQueueStats 請求日志隊列的計數，計數從進程啟動開始累計
+type LogQueueStats struct {
+	Overflow string `json:"overflow"`
+	Depth    int    `json:"depth"`    // 隊列中的日志數
+	Capacity int    `json:"capacity"` // 隊列容量
+	Enqueued int64  `json:"enqueued"` // 進入隊列的日志數
+	Dropped  int64  `json:"dropped"`  // 隊列滿被丟棄的日志數
+	Spilled  int64  `json:"spilled"`  // 隊列滿寫到本地文件的日志數
+	Written  int64  `json:"written"`  // 寫出成功的日志數
+	Failed   int64  `json:"failed"`   // 寫出失敗的日志數
+}
+
+func GetLogQueueStats() LogQueueStats {
+	return LogQueueStats{
+		Overflow: logQueueCfg.Overflow,
+		Depth:    len(logQueue),
+		Capacity: cap(logQueue),
+		Enqueued: logsEnqueued.Load(),
+		Dropped:  logsDropped.Load(),
+		Spilled:  logsSpilled.Load(),
+		Written:  logsWritten.Load(),
+		Failed:   logsFailed.Load(),
+	}
+}
+
+// enqueueLog 放入隊列，隊列滿時按配置的策略處理
+func enqueueLog(reqLog model.RequestLog) {
+	select {
+	case logQueue <- reqLog:
+		logsEnqueued.Add(1)
+		return
+	default:
+	}
+
+	switch logQueueCfg.Overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case logQueue <- reqLog:
+				logsEnqueued.Add(1)
+				return
+			default:
+			}
+			select {
+			case <-logQueue:
+				logsDropped.Add(1)
+			default:
+			}
+		}
+	case OverflowBlock:
+		timer := time.NewTimer(logQueueCfg.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case logQueue <- reqLog:
+			logsEnqueued.Add(1)
+		case <-timer.C:
+			logsDropped.Add(1)
+		}
+	case OverflowSpill:
+		if err := logSpillFile.append(reqLog); err != nil {
+			pkgLogger().Error("spill request log fails", "err", err)
+			logsDropped.Add(1)
+			return
+		}
+		logsSpilled.Add(1)
+	default:
+		logsDropped.Add(1)
+	}
+}
+
+// replaySpilledLogs 把溢出到本地文件的日志按時間順序寫出，寫完的文件刪除；
+// 寫出失敗時（通常是輸出目標不可用）保留沒寫出的部分，下次再重放
+func replaySpilledLogs(sink LogSink) {
+	files, err := logSpillFile.seal()
+	if err != nil {
+		pkgLogger().Error("seal spilled request logs fails", "err", err)
+	}
+	for i, path := range files {
+		written, err := replaySpillFile(sink, path)
+		if err != nil {
+			pkgLogger().Error("replay spilled request logs fails", "file", path, "err", err, "pending_files", len(files)-i)
+			if written > 0 {
+				if err := trimSpillFile(path, written); err != nil {
+					pkgLogger().Error("trim spilled request logs fails", "file", path, "err", err)
+				}
+			}
+			logSpillFile.markPending()
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			pkgLogger().Error("remove spilled request logs fails", "file", path, "err", err)
+		}
+	}
+}
+
+// replaySpillFile 按批寫出文件中的日志，返回已寫出部分的字節數，遇到第一個寫出失敗的批次就停止
+func replaySpillFile(sink LogSink, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// 日志中可能帶有上傳文件的内容
+	scanner.Buffer(make([]byte, 64*1024), 128<<20)
+	batch := make([]model.RequestLog, 0, logBatchSize)
+	var written, offset int64
+	for scanner.Scan() {
+		offset += int64(len(scanner.Bytes())) + 1
+		var reqLog model.RequestLog
+		if err := json.Unmarshal(scanner.Bytes(), &reqLog); err != nil {
+			logsFailed.Add(1)
+			continue
+		}
+		batch = append(batch, reqLog)
+		if len(batch) == logBatchSize {
+			if err := writeLogBatch(sink, batch); err != nil {
+				return written, err
+			}
+			batch = batch[:0]
+			written = offset
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return written, err
+	}
+	if err := writeLogBatch(sink, batch); err != nil {
+		return written, err
+	}
+	return offset, nil
+}
+
+// trimSpillFile 去掉文件中前 n 個已寫出的字節
+func trimSpillFile(path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(n, io.SeekStart); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".trim-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, f); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+const (
+	spillCurrentFile = "spill-current.ndjson"
+	spillFilePrefix  = "spill-"
+	spillFileSuffix  = ".ndjson"
+)
+
+// logSpill 隊列滿時的本地文件，寫入 spill-current.ndjson，寫出前改名為帶時間戳的文件
+type logSpill struct {
+	dir string
+
+	mu      sync.Mutex
+	file    *os.File
+	pending bool
+}
+
+func newLogSpill(dir string) *logSpill {
+	s := &logSpill{dir: dir}
+	if dir == "" {
+		return s
+	}
+	// 上次退出時沒寫出的文件也需要重放
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), spillFilePrefix) && strings.HasSuffix(e.Name(), spillFileSuffix) {
+				s.pending = true
+				break
+			}
+		}
+	}
+	return s
+}
+
+func (s *logSpill) append(reqLog model.RequestLog) error {
+	line, err := json.Marshal(reqLog)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		f, err := os.OpenFile(filepath.Join(s.dir, spillCurrentFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.pending = true
+	return nil
+}
+
+// markPending 重放失敗時標記還有待重放的文件
+func (s *logSpill) markPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = true
+}
+
+// hasPending 是否有待重放的文件
+func (s *logSpill) hasPending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// seal 關閉當前文件並改名，返回所有待重放的文件，按時間從舊到新排序
+func (s *logSpill) seal() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" || !s.pending {
+		return nil, nil
+	}
+	s.pending = false
+
+	if s.file != nil {
+		err := s.file.Close()
+		s.file = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+	current := filepath.Join(s.dir, spillCurrentFile)
+	if _, err := os.Stat(current); err == nil {
+		sealed := spillFilePrefix + time.Now().UTC().Format("20060102T150405.000000000") + spillFileSuffix
+		if err := os.Rename(current, filepath.Join(s.dir, sealed)); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if name != spillCurrentFile && strings.HasPrefix(name, spillFilePrefix) && strings.HasSuffix(name, spillFileSuffix) {
+			files = append(files, filepath.Join(s.dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
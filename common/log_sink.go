@@ -0,0 +1,341 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"test-git/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	LogSinkPostgres = "postgres"
+	LogSinkFile     = "file"
+	LogSinkStdout   = "stdout"
+)
+
+// LogSink 請求日志的輸出目標，StartLogWriter 按批調用 Write
+type LogSink interface {
+	Write(ctx context.Context, logs []model.RequestLog) error
+	Close() error
+}
+
+type LogSinkConfig struct {
+	Sinks          []string // postgres、file、stdout 的任意組合
+	FileDir        string
+	FileMaxSize    int64 // 單個文件超過這個大小後輪轉（字節）
+	FileMaxBackups int   // 保留的輪轉文件數
+}
+
+// Uses 是否配置了某個輸出目標
+func (cfg LogSinkConfig) Uses(sink string) bool {
+	for _, s := range cfg.Sinks {
+		if s == sink {
+			return true
+		}
+	}
+	return false
+}
+
+func LoadLogSinkConfig(lookup func(string) (string, bool)) (LogSinkConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := LogSinkConfig{
+		Sinks:          []string{LogSinkPostgres},
+		FileDir:        "logs",
+		FileMaxSize:    100 << 20,
+		FileMaxBackups: 10,
+	}
+	if v, ok := lookup("REQUEST_LOG_SINKS"); ok {
+		cfg.Sinks = nil
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			switch s {
+			case "":
+				continue
+			case LogSinkPostgres, LogSinkFile, LogSinkStdout:
+				if !cfg.Uses(s) {
+					cfg.Sinks = append(cfg.Sinks, s)
+				}
+			default:
+				return cfg, fmt.Errorf("invalid REQUEST_LOG_SINKS entry %q", s)
+			}
+		}
+	}
+	if v := getenv("REQUEST_LOG_FILE_DIR"); v != "" {
+		cfg.FileDir = v
+	}
+	if v := getenv("REQUEST_LOG_FILE_MAX_MB"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("invalid REQUEST_LOG_FILE_MAX_MB %q", v)
+		}
+		cfg.FileMaxSize = int64(n) << 20
+	}
+	if v := getenv("REQUEST_LOG_FILE_MAX_BACKUPS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("invalid REQUEST_LOG_FILE_MAX_BACKUPS %q", v)
+		}
+		cfg.FileMaxBackups = n
+	}
+	return cfg, nil
+}
+
+// NewLogSink 按配置創建輸出目標，配置了多個時返回 FanoutLogSink
+//
+// logDB 為 nil 時跳過 postgres，沒有可用的輸出目標時返回 nil。
+func NewLogSink(cfg LogSinkConfig, logDB *gorm.DB) (LogSink, error) {
+	var sinks []LogSink
+	for _, s := range cfg.Sinks {
+		switch s {
+		case LogSinkPostgres:
+			if logDB == nil {
+				pkgLogger().Warn("request log database unavailable, skip sink", "sink", s)
+				continue
+			}
+			sinks = append(sinks, NewPostgresLogSink(logDB))
+		case LogSinkFile:
+			sink, err := NewFileLogSink(cfg.FileDir, cfg.FileMaxSize, cfg.FileMaxBackups)
+			if err != nil {
+				for _, opened := range sinks {
+					opened.Close()
+				}
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case LogSinkStdout:
+			sinks = append(sinks, NewStdoutLogSink(os.Stdout))
+		}
+	}
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sinks[0], nil
+	default:
+		return NewFanoutLogSink(sinks...), nil
+	}
+}
+
+// PostgresLogSink 寫入 request-log 庫的 request_logs 表
+type PostgresLogSink struct {
+	db *gorm.DB
+}
+
+func NewPostgresLogSink(db *gorm.DB) *PostgresLogSink {
+	return &PostgresLogSink{db: db}
+}
+
+func (s *PostgresLogSink) Write(ctx context.Context, logs []model.RequestLog) error {
+	return s.db.WithContext(ctx).CreateInBatches(logs, len(logs)).Error
+}
+
+// Close 連接池由 db 包管理，這裡不關閉
+func (s *PostgresLogSink) Close() error {
+	return nil
+}
+
+// StdoutLogSink 每條日志輸出一行 JSON，供 fluent-bit 的 tail 輸入採集
+type StdoutLogSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewStdoutLogSink(w io.Writer) *StdoutLogSink {
+	return &StdoutLogSink{w: w}
+}
+
+func (s *StdoutLogSink) Write(ctx context.Context, logs []model.RequestLog) error {
+	buf, err := marshalNDJSON(logs)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(buf)
+	return err
+}
+
+func (s *StdoutLogSink) Close() error {
+	return nil
+}
+
+// FileLogSink 寫入本地 NDJSON 文件 request-logs.ndjson，超過大小後改名為帶時間戳的文件並重新打開
+type FileLogSink struct {
+	dir        string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	size int64
+}
+
+const (
+	logFileName   = "request-logs.ndjson"
+	logFilePrefix = "request-logs-"
+	logFileSuffix = ".ndjson"
+)
+
+func NewFileLogSink(dir string, maxSize int64, maxBackups int) (*FileLogSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileLogSink{dir: dir, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileLogSink) Write(ctx context.Context, logs []model.RequestLog) error {
+	buf, err := marshalNDJSON(logs)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if s.size > 0 && s.size+int64(len(buf)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.buf.Write(buf)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	// 每批寫完就落盤，進程退出時不丟已經寫出的批次
+	return s.buf.Flush()
+}
+
+func (s *FileLogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.buf.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
+
+func (s *FileLogSink) open() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.buf = bufio.NewWriter(f)
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileLogSink) rotate() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	backup := logFilePrefix + time.Now().UTC().Format("20060102T150405.000000000") + logFileSuffix
+	if err := os.Rename(filepath.Join(s.dir, logFileName), filepath.Join(s.dir, backup)); err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	s.pruneBackups()
+	return nil
+}
+
+// pruneBackups 刪除超出數量的舊文件，文件名中的時間戳保證按名稱排序即按時間排序
+func (s *FileLogSink) pruneBackups() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		pkgLogger().Error("list request log files fails", "err", err)
+		return
+	}
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, logFilePrefix) && strings.HasSuffix(name, logFileSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > s.maxBackups {
+		if err := os.Remove(filepath.Join(s.dir, backups[0])); err != nil {
+			pkgLogger().Error("remove request log file fails", "err", err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// FanoutLogSink 把每批日志寫到所有輸出目標，一個失敗不影響其他目標
+type FanoutLogSink struct {
+	sinks []LogSink
+}
+
+func NewFanoutLogSink(sinks ...LogSink) *FanoutLogSink {
+	return &FanoutLogSink{sinks: sinks}
+}
+
+func (s *FanoutLogSink) Write(ctx context.Context, logs []model.RequestLog) error {
+	var errs []error
+	for _, sink := range s.sinks {
+		if err := sink.Write(ctx, logs); err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", sink, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *FanoutLogSink) Close() error {
+	var errs []error
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func marshalNDJSON(logs []model.RequestLog) ([]byte, error) {
+	var buf []byte
+	for _, l := range logs {
+		line, err := json.Marshal(l)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	return buf, nil
+}
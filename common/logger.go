@@ -1,121 +1,295 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"mime/multipart"
+	"strings"
+	"sync"
 	"test-git/model"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 )
 
-var logQueue = make(chan model.RequestLog, 10000)
+var (
+	serviceName = ""
 
-func RequestLogMiddleware() gin.HandlerFunc {
+	// pendingLogs 記錄還沒放進隊列的日志，停止時先等它們入隊
+	pendingLogs sync.WaitGroup
+)
+
+func SetServiceName(name string) {
+	serviceName = name
+}
+
+// RequestLogMiddleware 記錄請求日志，pathFilter 中的路徑不記錄，以 "/*" 結尾表示前綴匹配
+func RequestLogMiddleware(pathFilter []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if skipRequestLog(c.Request.URL.Path, pathFilter) {
+			c.Next()
+			return
+		}
+
 		start := time.Now()
-		reqID := uuid.New().String()
-		c.Set("request_id", reqID)
+		// 通常由 RequestIDMiddleware 設置，單獨使用時在這裡生成
+		reqID := GetRequestID(c)
+		if reqID == "" {
+			reqID = uuid.New().String()
+			c.Set("request_id", reqID)
+		}
 		var (
 			fileName    string
 			fileSize    int64
 			fileContent []byte
+			reqBody     []byte
+			truncated   bool
+			respWriter  *bodyCaptureWriter
 		)
 
-		if c.ContentType() == "multipart/form-data" {
-			c.Request.ParseMultipartForm(100 << 20)
-			file, handler, err := c.Request.FormFile("file")
-			if err == nil && file != nil {
-				defer file.Close()
-				fileName = handler.Filename
-				fileSize = handler.Size
-
-				if fileSize > 0 && fileSize <= 100*1024*1024 {
-					fileContent, err = io.ReadAll(file)
-					if err != nil {
-						fileContent = []byte(fmt.Sprintf("read file error: %v", err))
-					}
-				} else {
-					fileContent = []byte("file too large, skip content")
-				}
+		if shouldCaptureBody(c) {
+			if captureContentType(c.ContentType()) {
+				reqBody, truncated = peekRequestBody(c, bodyCaptureCfg.MaxBytes)
 			}
+			respWriter = newBodyCaptureWriter(c.Writer, bodyCaptureCfg.MaxBytes)
+			c.Writer = respWriter
 		}
 
 		c.Next()
 
+		// 上傳的文件從處理函數解析過的表單中讀取，被限流等提前拒絕的請求不會為了記錄日志解析請求體
+		if form := c.Request.MultipartForm; form != nil && len(form.File["file"]) > 0 {
+			fileName, fileSize, fileContent = readLoggedFile(form.File["file"][0])
+		}
+
 		reqLog := model.RequestLog{
 			RequestID:   reqID,
+			ServiceName: serviceName,
 			Method:      c.Request.Method,
 			Path:        c.Request.URL.Path,
+			Route:       c.FullPath(),
 			QueryString: c.Request.URL.RawQuery,
 			StatusCode:  c.Writer.Status(),
 			RemoteIP:    c.ClientIP(),
+			UserID:      requestUserRef(GetUserID(c)),
 			UserAgent:   c.Request.UserAgent(),
 			RequestTime: time.Since(start).Seconds(),
 			CreatedAt:   time.Now(),
 			FileName:    fileName,
 			FileSize:    fileSize,
+			ContentType: c.ContentType(),
 		}
 
-		go func(reqLog model.RequestLog, content []byte) {
-			if len(content) == 0 {
-				select {
-				case logQueue <- reqLog:
-				default:
-				}
-				return
-			}
+		var respBody []byte
+		if respWriter != nil && captureContentType(respWriter.Header().Get("Content-Type")) {
+			respBody = respWriter.body.Bytes()
+			truncated = truncated || respWriter.truncated
+		}
+		reqLog.BodyTruncated = truncated
+		if p, ok := GetRequestProfile(c); ok {
+			reqLog.AllocBytes = p.AllocBytes
+			reqLog.Goroutines = p.Goroutines
+			reqLog.CPUProfile = p.CPUProfile
+		}
 
-			var jsonContent model.JSONRawMessage
-			if json.Valid(content) {
-				jsonContent = content
-			} else {
-				errMsg := fmt.Sprintf("file content is not valid JSON: %s", string(content[:min(len(content), 10000)]))
-				jsonContent, _ = json.Marshal(map[string]string{"error": errMsg})
-			}
+		pendingLogs.Add(1)
+		// block 策略在請求的 goroutine 中等待隊列空位，隊列滿時拖慢請求，對客戶端形成背壓；
+		// 其他策略不等待，遮蔽和入隊放到後台
+		if logQueueCfg.Overflow == OverflowBlock {
+			finishRequestLog(reqLog, fileContent, reqBody, respBody)
+			return
+		}
+		go finishRequestLog(reqLog, fileContent, reqBody, respBody)
+	}
+}
+
+// finishRequestLog 遮蔽請求日志並放入隊列
+func finishRequestLog(reqLog model.RequestLog, content, reqBody, respBody []byte) {
+	defer pendingLogs.Done()
+	// 遮蔽在入隊之前完成，隊列、溢出文件和所有輸出目標都不會看到原文
+	query := logRedactor.RedactString(reqLog.QueryString)
+	body := logRedactor.RedactJSON(reqBody)
+	// 請求被遮蔽過時記下來，回放不發送帶 [REDACTED] 的請求
+	reqLog.RequestRedacted = redacted(reqLog.QueryString, query) || redacted(string(reqBody), string(body))
+	reqLog.QueryString = query
+	reqLog.RequestBody = string(body)
+	reqLog.ResponseBody = string(logRedactor.RedactJSON(respBody))
+	if len(content) == 0 {
+		enqueueLog(reqLog)
+		return
+	}
+
+	var jsonContent model.JSONRawMessage
+	if json.Valid(content) {
+		jsonContent = logRedactor.RedactJSON(content)
+		reqLog.RequestRedacted = reqLog.RequestRedacted || redacted(string(content), string(jsonContent))
+	} else {
+		// 內容可能是截斷的 JSON，按 RedactJSON 的規則遮蔽；記錄的是錯誤說明而不是文件本身
+		head := logRedactor.RedactJSON(content[:min(len(content), 10000)])
+		jsonContent, _ = json.Marshal(map[string]string{"error": "file content is not valid JSON: " + string(head)})
+		reqLog.RequestRedacted = true
+	}
+
+	reqLog.FileContentJSON = jsonContent
+	enqueueLog(reqLog)
+}
 
-			reqLog.FileContentJSON = jsonContent
-			select {
-			case logQueue <- reqLog:
-			default:
+// redacted 遮蔽是否替換了內容；原文中本來就有的 [REDACTED] 不算
+func redacted(before, after string) bool {
+	return strings.Count(after, redactedValue) > strings.Count(before, redactedValue)
+}
+
+func readLoggedFile(header *multipart.FileHeader) (string, int64, []byte) {
+	if header.Size <= 0 || header.Size > 100*1024*1024 {
+		return header.Filename, header.Size, []byte("file too large, skip content")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return header.Filename, header.Size, []byte(fmt.Sprintf("read file error: %v", err))
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		content = []byte(fmt.Sprintf("read file error: %v", err))
+	}
+	return header.Filename, header.Size, content
+}
+
+func skipRequestLog(path string, pathFilter []string) bool {
+	for _, s := range pathFilter {
+		if prefix, ok := strings.CutSuffix(s, "/*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
 			}
-		}(reqLog, fileContent)
+		} else if path == s {
+			return true
+		}
 	}
+	return false
 }
 
-func StartLogWriter(db *gorm.DB) {
-	const (
-		batchSize     = 100
-		flushInterval = 500 * time.Millisecond
-	)
+// LogWriter 從隊列中按批取出日志寫入 sink，由 StartLogWriter 創建
+type LogWriter struct {
+	sink     LogSink
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// StartLogWriter 在後台啟動 LogWriter，調用 Stop 後寫完隊列並關閉 sink。
+// 隊列是進程級的，同一時間只應運行一個 LogWriter，停止後可以重新啟動
+func StartLogWriter(sink LogSink) *LogWriter {
+	w := &LogWriter{sink: sink, stop: make(chan struct{}), done: make(chan struct{})}
+	go w.run()
+	return w
+}
 
+func (w *LogWriter) run() {
+	defer close(w.done)
 	for {
-		batch := make([]model.RequestLog, 0, batchSize)
-		timer := time.NewTimer(flushInterval)
-		done := false
-
-		for len(batch) < batchSize && !done {
-			select {
-			case reqLog := <-logQueue:
-				batch = append(batch, reqLog)
-			case <-timer.C:
-				done = true
-			}
+		batch, stopping := nextLogBatch(w.stop)
+		writeQueuedBatch(w.sink, batch)
+		if stopping {
+			break
 		}
-		timer.Stop()
+		// 隊列有空閒時再寫出溢出到文件的日志
+		if logSpillFile.hasPending() && len(logQueue) < cap(logQueue)/2 {
+			replaySpilledLogs(w.sink)
+		}
+	}
 
-		if len(batch) > 0 {
-			if err := writeBatchWithGORM(db, batch); err != nil {
-				log.Printf("批量插入日志失敗: %v, 數據量: %d", err, len(batch))
-			}
+	// 停止時寫完隊列中剩下的日志
+	for {
+		batch := drainLogBatch()
+		if len(batch) == 0 {
+			break
 		}
+		writeQueuedBatch(w.sink, batch)
+	}
+	replaySpilledLogs(w.sink)
+	if err := w.sink.Close(); err != nil {
+		pkgLogger().Error("close request log sink fails", "err", err)
 	}
 }
 
-func writeBatchWithGORM(db *gorm.DB, logs []model.RequestLog) error {
-	return db.CreateInBatches(logs, len(logs)).Error
+// Stop 等待已經產生的日志入隊，通知寫入器寫完隊列後退出
+//
+// 可以重複調用；ctx 到期時返回錯誤，未寫出的日志丟棄。
+func (w *LogWriter) Stop(ctx context.Context) error {
+	enqueued := make(chan struct{})
+	go func() {
+		pendingLogs.Wait()
+		close(enqueued)
+	}()
+	select {
+	case <-enqueued:
+	case <-ctx.Done():
+	}
+
+	w.stopOnce.Do(func() { close(w.stop) })
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("request log writer not drained: %w, %d logs left", ctx.Err(), len(logQueue))
+	}
+}
+
+const logBatchSize = 100
+
+func nextLogBatch(stop <-chan struct{}) ([]model.RequestLog, bool) {
+	const flushInterval = 500 * time.Millisecond
+
+	batch := make([]model.RequestLog, 0, logBatchSize)
+	timer := time.NewTimer(flushInterval)
+	defer timer.Stop()
+	for len(batch) < logBatchSize {
+		select {
+		case reqLog := <-logQueue:
+			batch = append(batch, reqLog)
+		case <-timer.C:
+			return batch, false
+		case <-stop:
+			return batch, true
+		}
+	}
+	return batch, false
+}
+
+func drainLogBatch() []model.RequestLog {
+	batch := make([]model.RequestLog, 0, logBatchSize)
+	for len(batch) < logBatchSize {
+		select {
+		case reqLog := <-logQueue:
+			batch = append(batch, reqLog)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// writeLogBatch 寫出一批日志；失敗的批次是丟棄還是保留重試由調用方決定
+func writeLogBatch(sink LogSink, batch []model.RequestLog) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sink.Write(ctx, batch); err != nil {
+		pkgLogger().Error("批量寫入日志失敗", "err", err, "count", len(batch))
+		return err
+	}
+	logsWritten.Add(int64(len(batch)))
+	return nil
+}
+
+// writeQueuedBatch 寫出從隊列取出的日志，失敗時丟棄並計數
+func writeQueuedBatch(sink LogSink, batch []model.RequestLog) {
+	if err := writeLogBatch(sink, batch); err != nil {
+		logsFailed.Add(int64(len(batch)))
+	}
 }
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type MetricsConfig struct {
+	Enabled bool
+	Path    string // 默認 /metrics
+	Token   string // 配置後抓取時需要 Authorization: Bearer <token>
+}
+
+func LoadMetricsConfig(lookup func(string) (string, bool)) (MetricsConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := MetricsConfig{Enabled: true, Path: "/metrics", Token: getenv("METRICS_TOKEN")}
+	if v := getenv("METRICS_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid METRICS_ENABLED %q", v)
+		}
+		cfg.Enabled = enabled
+	}
+	if v := getenv("METRICS_PATH"); v != "" {
+		if !strings.HasPrefix(v, "/") {
+			return cfg, fmt.Errorf("invalid METRICS_PATH %q", v)
+		}
+		cfg.Path = v
+	}
+	return cfg, nil
+}
+
+// MetricsRegistry 所有 Prometheus 指標都註冊在這裡，不使用全局默認的 registry
+var MetricsRegistry = prometheus.NewRegistry()
+
+// unmatchedRoute 沒有匹配到路由的請求（404 掃描等）統一用這個標籤，避免按原始路徑產生大量時間序列
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route template and status code.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+	httpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpRequestsInFlight,
+		logQueueCollector{},
+	)
+}
+
+// MetricsMiddleware 按路由模板（如 /roles/:id）統計請求數和延遲
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// MetricsHandler 暴露 MetricsRegistry，配置了 Token 時校驗 Bearer 令牌
+func MetricsHandler(cfg MetricsConfig) gin.HandlerFunc {
+	h := promhttp.HandlerFor(MetricsRegistry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if cfg.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(c, "监控凭证无效"))
+			return
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// logQueueCollector 抓取時讀取 GetLogQueueStats，隊列重新配置後也能拿到最新的值
+type logQueueCollector struct{}
+
+var (
+	logQueueDepthDesc    = prometheus.NewDesc("request_log_queue_depth", "Request logs waiting in the queue.", nil, nil)
+	logQueueCapacityDesc = prometheus.NewDesc("request_log_queue_capacity", "Request log queue capacity.", nil, nil)
+	logQueueEventsDesc   = prometheus.NewDesc("request_logs_total", "Request logs by outcome: enqueued, dropped, spilled, written, failed.", []string{"outcome"}, nil)
+)
+
+func (logQueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- logQueueDepthDesc
+	ch <- logQueueCapacityDesc
+	ch <- logQueueEventsDesc
+}
+
+func (logQueueCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := GetLogQueueStats()
+	ch <- prometheus.MustNewConstMetric(logQueueDepthDesc, prometheus.GaugeValue, float64(stats.Depth))
+	ch <- prometheus.MustNewConstMetric(logQueueCapacityDesc, prometheus.GaugeValue, float64(stats.Capacity))
+	for outcome, n := range map[string]int64{
+		"enqueued": stats.Enqueued,
+		"dropped":  stats.Dropped,
+		"spilled":  stats.Spilled,
+		"written":  stats.Written,
+		"failed":   stats.Failed,
+	} {
+		ch <- prometheus.MustNewConstMetric(logQueueEventsDesc, prometheus.CounterValue, float64(n), outcome)
+	}
+}
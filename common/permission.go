@@ -0,0 +1,34 @@
+package common
+
+import (
+	"net/http"
+	"test-git/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+const subjectKey = "subject"
+
+func SetSubject(c *gin.Context, subject policy.Subject) {
+	c.Set(subjectKey, subject)
+}
+
+// GetSubject 返回當前請求的授權主體，未加載時返回沒有任何權限的空主體
+func GetSubject(c *gin.Context) policy.Subject {
+	subject, exists := c.Get(subjectKey)
+	if !exists {
+		return policy.Subject{}
+	}
+	return subject.(policy.Subject)
+}
+
+// RequirePermission 要求當前用戶擁有指定權限，否則返回 403
+func RequirePermission(p policy.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetSubject(c).Can(p) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorBody(c, "无权限执行该操作"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,429 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProfilerConfig 請求資源採樣的配置
+type ProfilerConfig struct {
+	SampleRate     float64       // 採樣比例，0 關閉採樣
+	RingSize       int           // 保留最近多少個採樣
+	SlowThreshold  time.Duration // 請求超過這個耗時後開始 CPU profile，0 關閉
+	ProfileDir     string        // CPU profile 保存目錄
+	MaxProfileTime time.Duration // 單個 CPU profile 的最長時間
+	MaxProfiles    int           // 目錄中最多保留的 CPU profile 文件數，超過時刪除最舊的
+}
+
+func LoadProfilerConfig(lookup func(string) (string, bool)) (ProfilerConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := ProfilerConfig{
+		SampleRate:     0.1,
+		RingSize:       1000,
+		ProfileDir:     filepath.Join("logs", "pprof"),
+		MaxProfileTime: 30 * time.Second,
+		MaxProfiles:    20,
+	}
+	if v := getenv("PROFILER_SAMPLE_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return cfg, fmt.Errorf("invalid PROFILER_SAMPLE_RATE %q", v)
+		}
+		cfg.SampleRate = rate
+	}
+	if v := getenv("PROFILER_RING_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("invalid PROFILER_RING_SIZE %q", v)
+		}
+		cfg.RingSize = n
+	}
+	if v := getenv("PROFILER_SLOW_THRESHOLD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid PROFILER_SLOW_THRESHOLD %q", v)
+		}
+		cfg.SlowThreshold = d
+	}
+	if v := getenv("PROFILER_PROFILE_DIR"); v != "" {
+		cfg.ProfileDir = v
+	}
+	if v := getenv("PROFILER_MAX_PROFILE_TIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid PROFILER_MAX_PROFILE_TIME %q", v)
+		}
+		cfg.MaxProfileTime = d
+	}
+	if v := getenv("PROFILER_MAX_PROFILES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("invalid PROFILER_MAX_PROFILES %q", v)
+		}
+		cfg.MaxProfiles = n
+	}
+	return cfg, nil
+}
+
+// RequestProfile 一個被採樣請求的資源使用
+//
+// AllocBytes 是請求期間進程的堆分配增量，並發請求會互相計入，適合比較路由之間的量級。
+type RequestProfile struct {
+	RequestID  string        `json:"request_id"`
+	Method     string        `json:"method"`
+	Route      string        `json:"route"`
+	StatusCode int           `json:"status_code"`
+	Duration   time.Duration `json:"duration"`
+	AllocBytes int64         `json:"alloc_bytes"`
+	Goroutines int           `json:"goroutines"` // 請求結束時的 goroutine 數
+	CPUProfile string        `json:"cpu_profile,omitempty"`
+	At         time.Time     `json:"at"`
+}
+
+const requestProfileKey = "request_profile"
+
+// GetRequestProfile 請求被採樣或觸發了 CPU profile 時返回資源使用
+func GetRequestProfile(c *gin.Context) (RequestProfile, bool) {
+	v, ok := c.Get(requestProfileKey)
+	if !ok {
+		return RequestProfile{}, false
+	}
+	return v.(RequestProfile), true
+}
+
+// profileRing 最近的採樣，寫滿後覆蓋最舊的
+type profileRing struct {
+	mu      sync.Mutex
+	entries []RequestProfile
+	next    int
+	full    bool
+}
+
+// add 寫入一個採樣，返回被覆蓋的舊採樣
+func (r *profileRing) add(p RequestProfile) RequestProfile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	evicted := r.entries[r.next]
+	r.entries[r.next] = p
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+	return evicted
+}
+
+func (r *profileRing) snapshot() []RequestProfile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.full {
+		return append([]RequestProfile(nil), r.entries...)
+	}
+	return append([]RequestProfile(nil), r.entries[:r.next]...)
+}
+
+// profileFiles 已保存的 CPU profile 文件，按創建順序排列，超過上限時刪除最舊的
+type profileFiles struct {
+	mu    sync.Mutex
+	dir   string
+	max   int
+	names []string
+}
+
+func (f *profileFiles) add(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.names = append(f.names, name)
+	for len(f.names) > f.max {
+		f.delete(f.names[0])
+		f.names = f.names[1:]
+	}
+}
+
+// remove 刪除環形緩衝區中被覆蓋的採樣引用的文件，已經因為超過上限被刪除的忽略
+func (f *profileFiles) remove(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, n := range f.names {
+		if n == name {
+			f.delete(name)
+			f.names = append(f.names[:i], f.names[i+1:]...)
+			return
+		}
+	}
+}
+
+func (f *profileFiles) delete(name string) {
+	if err := os.Remove(filepath.Join(f.dir, name)); err != nil && !os.IsNotExist(err) {
+		pkgLogger().Warn("remove cpu profile fails", "name", name, "err", err)
+	}
+}
+
+var (
+	profiles     = &profileRing{entries: make([]RequestProfile, 1000)}
+	profilerCfg  = ProfilerConfig{ProfileDir: filepath.Join("logs", "pprof")}
+	profileSaved = &profileFiles{dir: profilerCfg.ProfileDir, max: 20}
+	// 同一時間只能有一個 CPU profile
+	cpuProfiling atomic.Bool
+)
+
+// ConfigureProfiler 設置採樣緩衝區和 CPU profile 目錄，需要在 ProfilerMiddleware 處理請求之前調用；
+// 目錄中之前運行留下的 profile 也計入 MaxProfiles，超出的部分刪除最舊的
+func ConfigureProfiler(cfg ProfilerConfig) error {
+	saved := &profileFiles{dir: cfg.ProfileDir, max: max(cfg.MaxProfiles, 1)}
+	entries, err := os.ReadDir(cfg.ProfileDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// 文件名以 UTC 時間開頭，按名稱排序即按創建順序
+	for _, e := range entries {
+		if !e.IsDir() && profileNamePattern.MatchString(e.Name()) {
+			saved.add(e.Name())
+		}
+	}
+	profiles = &profileRing{entries: make([]RequestProfile, max(cfg.RingSize, 1))}
+	profilerCfg = cfg
+	profileSaved = saved
+	return nil
+}
+
+// ProfilerMiddleware 按比例採樣請求的耗時、分配和 goroutine 數，寫入環形緩衝區和請求日志；
+// 配置了 SlowThreshold 時，任何請求超過閾值都會對剩餘的處理過程做 CPU profile
+func ProfilerMiddleware(cfg ProfilerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sampled := cfg.SampleRate > 0 && rand.Float64() < cfg.SampleRate
+		if !sampled && cfg.SlowThreshold <= 0 {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		var startAlloc uint64
+		if sampled {
+			startAlloc = heapAllocBytes()
+		}
+		var slow *slowProfile
+		if cfg.SlowThreshold > 0 {
+			slow = startSlowProfile(c, cfg)
+		}
+
+		c.Next()
+
+		p := RequestProfile{
+			RequestID:  GetRequestID(c),
+			Method:     c.Request.Method,
+			Route:      c.FullPath(),
+			StatusCode: c.Writer.Status(),
+			Duration:   time.Since(start),
+			At:         start,
+		}
+		if slow != nil {
+			p.CPUProfile = slow.finish()
+		}
+		if !sampled && p.CPUProfile == "" {
+			return
+		}
+		if sampled {
+			p.AllocBytes = int64(heapAllocBytes() - startAlloc)
+			p.Goroutines = runtime.NumGoroutine()
+		}
+		c.Set(requestProfileKey, p)
+		if p.CPUProfile != "" {
+			profileSaved.add(p.CPUProfile)
+		}
+		// 被覆蓋的採樣不會再出現在匯總中，它的 CPU profile 也不再需要
+		if evicted := profiles.add(p); evicted.CPUProfile != "" {
+			profileSaved.remove(evicted.CPUProfile)
+		}
+	}
+}
+
+// heapAllocBytes 進程累計的堆分配字節數，讀取 runtime/metrics 不會像 ReadMemStats 那樣停止所有 goroutine
+func heapAllocBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// slowProfile 請求超過閾值時啟動 CPU profile，請求結束或超過 MaxProfileTime 時停止
+type slowProfile struct {
+	timer   *time.Timer
+	restore context.Context
+
+	mu       sync.Mutex
+	stopped  bool
+	file     *os.File
+	name     string
+	deadline *time.Timer
+}
+
+func startSlowProfile(c *gin.Context, cfg ProfilerConfig) *slowProfile {
+	reqID := GetRequestID(c)
+	s := &slowProfile{restore: c.Request.Context()}
+	// 給請求所在的 goroutine 打上標籤，profile 中可以按 request_id 過濾
+	pprof.SetGoroutineLabels(pprof.WithLabels(s.restore, pprof.Labels("request_id", reqID, "route", c.FullPath())))
+	s.timer = time.AfterFunc(cfg.SlowThreshold, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.stopped || !cpuProfiling.CompareAndSwap(false, true) {
+			return
+		}
+		f, err := createProfileFile(cfg.ProfileDir, reqID)
+		if err == nil {
+			err = pprof.StartCPUProfile(f)
+			if err != nil {
+				f.Close()
+				os.Remove(f.Name())
+			}
+		}
+		if err != nil {
+			cpuProfiling.Store(false)
+			pkgLogger().Error("start cpu profile fails", "request_id", reqID, "err", err)
+			return
+		}
+		s.file, s.name = f, filepath.Base(f.Name())
+		s.deadline = time.AfterFunc(cfg.MaxProfileTime, s.stopProfile)
+	})
+	return s
+}
+
+func createProfileFile(dir, reqID string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Join(dir, profileFileName(reqID, time.Now())))
+}
+
+// finish 在請求的 goroutine 上調用，恢復標籤並停止 profile，返回保存的文件名，沒有觸發時返回空字符串
+func (s *slowProfile) finish() string {
+	s.timer.Stop()
+	pprof.SetGoroutineLabels(s.restore)
+	s.stopProfile()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name
+}
+
+func (s *slowProfile) stopProfile() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.file == nil {
+		return
+	}
+	s.deadline.Stop()
+	pprof.StopCPUProfile()
+	s.file.Close()
+	s.file = nil
+	cpuProfiling.Store(false)
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+\.pprof$`)
+
+func profileFileName(reqID string, at time.Time) string {
+	if !requestIDPattern.MatchString(reqID) {
+		reqID = "unknown"
+	}
+	return at.UTC().Format("20060102T150405") + "-" + reqID + ".pprof"
+}
+
+// CPUProfilePath 返回保存的 CPU profile 路徑，名稱不合法或文件不存在時返回 false
+func CPUProfilePath(name string) (string, bool) {
+	if !profileNamePattern.MatchString(name) {
+		return "", false
+	}
+	path := filepath.Join(profilerCfg.ProfileDir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// RouteProfile 一個路由在環形緩衝區中的匯總
+type RouteProfile struct {
+	Method        string
+	Route         string
+	Count         int
+	AvgDuration   time.Duration
+	MaxDuration   time.Duration
+	AvgAllocBytes int64
+	MaxAllocBytes int64
+	MaxGoroutines int
+	CPUProfiles   []string // 最近的 CPU profile 文件名
+	SlowestID     string   // 最慢請求的 request_id
+}
+
+// 排序方式
+const (
+	ProfileByDuration = "duration"
+	ProfileByAlloc    = "alloc"
+)
+
+// TopRouteProfiles 按平均耗時或平均分配排序，返回最重的 n 個路由
+func TopRouteProfiles(n int, by string) []RouteProfile {
+	type acc struct {
+		RouteProfile
+		totalDuration time.Duration
+		totalAlloc    int64
+	}
+	byRoute := make(map[string]*acc)
+	for _, p := range profiles.snapshot() {
+		key := p.Method + " " + p.Route
+		r, ok := byRoute[key]
+		if !ok {
+			r = &acc{RouteProfile: RouteProfile{Method: p.Method, Route: p.Route}}
+			byRoute[key] = r
+		}
+		r.Count++
+		r.totalDuration += p.Duration
+		r.totalAlloc += p.AllocBytes
+		if p.Duration > r.MaxDuration {
+			r.MaxDuration = p.Duration
+			r.SlowestID = p.RequestID
+		}
+		r.MaxAllocBytes = max(r.MaxAllocBytes, p.AllocBytes)
+		r.MaxGoroutines = max(r.MaxGoroutines, p.Goroutines)
+		if p.CPUProfile != "" {
+			r.CPUProfiles = append(r.CPUProfiles, p.CPUProfile)
+		}
+	}
+
+	result := make([]RouteProfile, 0, len(byRoute))
+	for _, r := range byRoute {
+		r.AvgDuration = r.totalDuration / time.Duration(r.Count)
+		r.AvgAllocBytes = r.totalAlloc / int64(r.Count)
+		if len(r.CPUProfiles) > 5 {
+			r.CPUProfiles = r.CPUProfiles[len(r.CPUProfiles)-5:]
+		}
+		result = append(result, r.RouteProfile)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if by == ProfileByAlloc && result[i].AvgAllocBytes != result[j].AvgAllocBytes {
+			return result[i].AvgAllocBytes > result[j].AvgAllocBytes
+		}
+		if result[i].AvgDuration != result[j].AvgDuration {
+			return result[i].AvgDuration > result[j].AvgDuration
+		}
+		return result[i].Method+" "+result[i].Route < result[j].Method+" "+result[j].Route
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,287 @@
+package common
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RateLimit 令牌桶參數：每秒補充 Rate 個令牌，最多積累 Burst 個
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// RateLimitStore 令牌桶存儲，Take 取一個令牌，拒絕時返回需要等待的時間
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, time.Duration, error)
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	Store   string               // memory 或 postgres
+	Default RateLimit            // 沒有單獨配置的路由使用的限制
+	Routes  map[string]RateLimit // "POST /roles/create" -> 限制，路由使用模板路徑
+}
+
+// LoadRateLimitConfig 讀取限流配置
+//
+//	RATE_LIMIT_ENABLED=false               關閉限流
+//	RATE_LIMIT_STORE=postgres              多副本共享限流狀態
+//	RATE_LIMIT_DEFAULT=20/s:40             每秒 20 個請求，突發 40
+//	RATE_LIMIT_ROUTES="POST /roles=1/s:5;POST /roles/create=10/m:5"
+func LoadRateLimitConfig(lookup func(string) (string, bool)) (RateLimitConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := RateLimitConfig{
+		Enabled: getenv("RATE_LIMIT_ENABLED") != "false",
+		Store:   "memory",
+		Default: RateLimit{Rate: 20, Burst: 40},
+		Routes: map[string]RateLimit{
+			"POST /roles":        {Rate: 1, Burst: 5},
+			"POST /roles/create": {Rate: 1, Burst: 5},
+			"POST /auth/login":   {Rate: 1, Burst: 5},
+		},
+	}
+
+	if v := getenv("RATE_LIMIT_STORE"); v != "" {
+		if v != "memory" && v != "postgres" {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_STORE %q", v)
+		}
+		cfg.Store = v
+	}
+	if v := getenv("RATE_LIMIT_DEFAULT"); v != "" {
+		limit, err := ParseRateLimit(v)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Default = limit
+	}
+	if v := getenv("RATE_LIMIT_ROUTES"); v != "" {
+		for _, item := range strings.Split(v, ";") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			route, spec, ok := strings.Cut(item, "=")
+			if !ok {
+				return cfg, fmt.Errorf("invalid RATE_LIMIT_ROUTES entry %q", item)
+			}
+			limit, err := ParseRateLimit(spec)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Routes[strings.TrimSpace(route)] = limit
+		}
+	}
+	return cfg, nil
+}
+
+// ParseRateLimit 解析 "<次數>/<s|m|h>:<突發>"，例如 "10/m:5"
+func ParseRateLimit(spec string) (RateLimit, error) {
+	rateSpec, burstSpec, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	countSpec, unit, ok2 := strings.Cut(rateSpec, "/")
+	if !ok || !ok2 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, want <count>/<s|m|h>:<burst>", spec)
+	}
+
+	count, err := strconv.ParseFloat(countSpec, 64)
+	if err != nil || count < 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit count %q", countSpec)
+	}
+	burst, err := strconv.Atoi(burstSpec)
+	if err != nil || burst < 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit burst %q", burstSpec)
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return RateLimit{}, fmt.Errorf("invalid rate limit unit %q", unit)
+	}
+	return RateLimit{Rate: count / per.Seconds(), Burst: burst}, nil
+}
+
+func NewRateLimitStore(cfg RateLimitConfig, db *gorm.DB) RateLimitStore {
+	if cfg.Store == "postgres" {
+		return NewPostgresRateLimitStore(db)
+	}
+	return NewMemoryRateLimitStore()
+}
+
+// RateLimitMiddleware 按用戶（沒有登錄態時按客戶端IP）和路由限流，需放在 SessionMiddleware 之後
+func RateLimitMiddleware(cfg RateLimitConfig, store RateLimitStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+
+		route := c.Request.Method + " " + c.FullPath()
+		limit, ok := cfg.Routes[route]
+		if !ok {
+			route, limit = "default", cfg.Default
+		}
+		if !limit.Enabled() {
+			c.Next()
+			return
+		}
+
+		// ClientIP 只在對端是可信代理時採信 X-Forwarded-For，見 SetTrustedProxies
+		identity := "ip:" + c.ClientIP()
+		if userID := GetUserID(c); userID != "" {
+			identity = "user:" + userID
+		}
+
+		allowed, retryAfter, err := store.Take(c.Request.Context(), route+"|"+identity, limit, time.Now())
+		if err != nil {
+			// 限流存儲不可用時放行，不能因為限流把服務整個拖垮
+			requestLogger(c).Error("rate limit store fails", "err", err)
+			c.Next()
+			return
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(c, "请求过于频繁，请稍后再试"))
+			return
+		}
+		c.Next()
+	}
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// take 按時間補充令牌並嘗試取一個
+func (b *bucket) take(limit RateLimit, now time.Time) (bool, time.Duration) {
+	if elapsed := now.Sub(b.updatedAt).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.updatedAt = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// MemoryRateLimitStore 進程內令牌桶，只適用於單副本部署
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > time.Minute {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		s.buckets[key] = b
+	}
+	allowed, retryAfter := b.take(limit, now)
+	return allowed, retryAfter, nil
+}
+
+// sweep 清理長時間沒有請求的桶，它們早已補滿，刪除不影響限流結果
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updatedAt) > 10*time.Minute {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// PostgresRateLimitStore 令牌桶存放在 rate_limit_buckets 表，多副本共享限流狀態
+type PostgresRateLimitStore struct {
+	db *gorm.DB
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewPostgresRateLimitStore(db *gorm.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+// 補充令牌和取令牌在一條語句裡完成，由行鎖保證併發安全
+const takeTokenSQL = `
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (@key, CAST(@burst AS double precision) - 1, true, CAST(@now AS timestamptz))
+ON CONFLICT (key) DO UPDATE SET
+	tokens = LEAST(CAST(@burst AS double precision), b.tokens + GREATEST(0, EXTRACT(EPOCH FROM (CAST(@now AS timestamptz) - b.updated_at))) * CAST(@rate AS double precision))
+		- CASE WHEN LEAST(CAST(@burst AS double precision), b.tokens + GREATEST(0, EXTRACT(EPOCH FROM (CAST(@now AS timestamptz) - b.updated_at))) * CAST(@rate AS double precision)) >= 1 THEN 1 ELSE 0 END,
+	allowed = LEAST(CAST(@burst AS double precision), b.tokens + GREATEST(0, EXTRACT(EPOCH FROM (CAST(@now AS timestamptz) - b.updated_at))) * CAST(@rate AS double precision)) >= 1,
+	updated_at = GREATEST(b.updated_at, CAST(@now AS timestamptz))
+RETURNING tokens, allowed`
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, time.Duration, error) {
+	s.maybeCleanup(now)
+
+	var result struct {
+		Tokens  float64
+		Allowed bool
+	}
+	err := s.db.WithContext(ctx).Raw(takeTokenSQL,
+		sql.Named("key", key),
+		sql.Named("burst", limit.Burst),
+		sql.Named("rate", limit.Rate),
+		sql.Named("now", now),
+	).Scan(&result).Error
+	if err != nil {
+		return false, 0, err
+	}
+	if result.Allowed {
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - result.Tokens) / limit.Rate * float64(time.Second)), nil
+}
+
+// maybeCleanup 每十分鐘在後台刪除一次長時間未使用的桶
+func (s *PostgresRateLimitStore) maybeCleanup(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastCleanup) < 10*time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastCleanup = now
+	s.mu.Unlock()
+
+	go func() {
+		err := s.db.Exec("DELETE FROM rate_limit_buckets WHERE updated_at < ?", now.Add(-time.Hour)).Error
+		if err != nil {
+			pkgLogger().Error("rate limit cleanup fails", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,208 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// Redactor 在日志持久化之前遮蔽敏感字段
+//
+// JSON 路徑支持 $.a.b、$.a[0]、$.a[*].b、$.*、$..key（任意層級的 key）；
+// 正則有捕獲組時只遮蔽第一個捕獲組，否則遮蔽整個匹配。
+type Redactor struct {
+	paths    [][]jsonPathStep
+	patterns []*regexp.Regexp
+
+	// 截斷或不合法的 JSON 不能按路徑解析，改為按路徑最後一級的 key 匹配 "key": value；
+	// 有路徑以下標或 * 結尾時無法按 key 匹配，整段替換
+	keyPattern  *regexp.Regexp
+	dropInvalid bool
+}
+
+type jsonPathStep struct {
+	name      string // "*" 匹配任意 key 或下標
+	index     int    // name 為空時按數組下標匹配
+	recursive bool   // ..name，在任意深度匹配
+}
+
+func NewRedactor(paths, patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range paths {
+		steps, err := parseJSONPath(p)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, steps)
+	}
+	var keys []string
+	for _, steps := range r.paths {
+		last := steps[len(steps)-1]
+		if last.name == "" || last.name == "*" {
+			r.dropInvalid = true
+			continue
+		}
+		keys = append(keys, regexp.QuoteMeta(last.name))
+	}
+	if len(keys) > 0 {
+		// 值可以是完整或被截斷的字符串，也可以是數字、布爾等標量
+		r.keyPattern = regexp.MustCompile(`"(?:` + strings.Join(keys, "|") + `)"\s*:\s*("(?:[^"\\]|\\.)*"?|[^\s,\]}]+)`)
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// RedactString 對字符串應用正則規則
+func (r *Redactor) RedactString(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, re := range r.patterns {
+		if re.NumSubexp() == 0 {
+			s = re.ReplaceAllString(s, redactedValue)
+			continue
+		}
+		s = replaceFirstGroup(s, re, redactedValue)
+	}
+	return s
+}
+
+// replaceFirstGroup 把每個匹配的第一個捕獲組替換為 repl
+func replaceFirstGroup(s string, re *regexp.Regexp, repl string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m[2] < 0 {
+			continue
+		}
+		b.WriteString(s[last:m[2]])
+		b.WriteString(repl)
+		last = m[3]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// RedactJSON 遮蔽 JSON 路徑匹配的值，再對結果應用正則規則
+//
+// 不是合法 JSON 時（例如請求體被截斷）按 key 遮蔽路徑規則覆蓋的字段，見 Redactor.keyPattern。
+func (r *Redactor) RedactJSON(data []byte) []byte {
+	if r == nil || len(data) == 0 {
+		return data
+	}
+	if len(r.paths) > 0 && !json.Valid(data) {
+		if r.dropInvalid {
+			return []byte(redactedValue)
+		}
+		data = []byte(replaceFirstGroup(string(data), r.keyPattern, strconv.Quote(redactedValue)))
+	} else if len(r.paths) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err == nil {
+			for _, steps := range r.paths {
+				v = redactPath(v, steps)
+			}
+			if out, err := json.Marshal(v); err == nil {
+				data = out
+			}
+		}
+	}
+	if len(r.patterns) == 0 {
+		return data
+	}
+	return []byte(r.RedactString(string(data)))
+}
+
+func redactPath(v interface{}, steps []jsonPathStep) interface{} {
+	if len(steps) == 0 {
+		return redactedValue
+	}
+	step, rest := steps[0], steps[1:]
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			if step.name == "*" || step.name == k {
+				node[k] = redactPath(child, rest)
+			} else if step.recursive {
+				node[k] = redactPath(child, steps)
+			}
+		}
+	case []interface{}:
+		for i, child := range node {
+			if step.name == "*" || (step.name == "" && step.index == i) {
+				node[i] = redactPath(child, rest)
+			} else if step.recursive {
+				node[i] = redactPath(child, steps)
+			}
+		}
+	}
+	return v
+}
+
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid redact path %q: must start with $", path)
+	}
+	var steps []jsonPathStep
+	for rest != "" {
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid redact path %q: missing ]", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if inner == "*" {
+				step.name = "*"
+			} else if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				step.index = n
+			} else {
+				step.name = strings.Trim(inner, `'"`)
+			}
+			steps = append(steps, step)
+			continue
+		default:
+			return nil, fmt.Errorf("invalid redact path %q", path)
+		}
+
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		step.name = rest[:end]
+		rest = rest[end:]
+		if step.name == "" {
+			return nil, fmt.Errorf("invalid redact path %q: empty segment", path)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("invalid redact path %q: no segments", path)
+	}
+	return steps, nil
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// ServerConfig HTTP 服務的監聽地址和超時
+type ServerConfig struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration // 包含上傳文件的時間
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // 停止時等待請求結束和日志寫完的總時間
+	ShutdownDelay     time.Duration // /readyz 返回 503 後繼續服務的時間，留給負載均衡摘除實例
+	TLSCertFile       string        // 同時設置證書和私鑰時直接監聽 HTTPS
+	TLSKeyFile        string
+}
+
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != ""
+}
+
+func LoadServerConfig(lookup func(string) (string, bool)) (ServerConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := ServerConfig{
+		Addr:              ":8080",
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       60 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+	}
+	if v := getenv("SERVER_ADDR"); v != "" {
+		cfg.Addr = v
+	}
+	cfg.TLSCertFile = getenv("SERVER_TLS_CERT_FILE")
+	cfg.TLSKeyFile = getenv("SERVER_TLS_KEY_FILE")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return cfg, fmt.Errorf("SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set together")
+	}
+	for env, dst := range map[string]*time.Duration{
+		"SERVER_READ_HEADER_TIMEOUT": &cfg.ReadHeaderTimeout,
+		"SERVER_READ_TIMEOUT":        &cfg.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT":       &cfg.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":        &cfg.IdleTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT":    &cfg.ShutdownTimeout,
+	} {
+		if v := getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return cfg, fmt.Errorf("invalid %s %q", env, v)
+			}
+			*dst = d
+		}
+	}
+	if v := getenv("SERVER_SHUTDOWN_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid SERVER_SHUTDOWN_DELAY %q", v)
+		}
+		cfg.ShutdownDelay = d
+	}
+	return cfg, nil
+}
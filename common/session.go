@@ -0,0 +1,164 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrTokenExpired = errors.New("session token expired")
+)
+
+// SessionClaims 會話令牌中攜帶的用戶身份
+type SessionClaims struct {
+	OpenID    string `json:"openid"`
+	UnionID   string `json:"unionid,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type SessionConfig struct {
+	Secret   []byte
+	TTL      time.Duration
+	Disabled bool // 不簽發令牌，只接受網關注入的身份請求頭
+}
+
+// LoadSessionConfig 多個副本和重啟前後必須使用同一個密鑰，所以沒有配置 SESSION_SECRET 時報錯，
+// 只用網關請求頭的部署需要顯式設置 SESSION_DISABLED=true
+func LoadSessionConfig(lookup func(string) (string, bool)) (SessionConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := SessionConfig{
+		Secret: []byte(getenv("SESSION_SECRET")),
+		TTL:    7 * 24 * time.Hour,
+	}
+	if v := getenv("SESSION_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return cfg, fmt.Errorf("invalid SESSION_TTL %q", v)
+		}
+		cfg.TTL = ttl
+	}
+	if v := getenv("SESSION_DISABLED"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SESSION_DISABLED %q", v)
+		}
+		cfg.Disabled = disabled
+	}
+	if !cfg.Disabled && len(cfg.Secret) == 0 {
+		return cfg, errors.New("SESSION_SECRET is required, set SESSION_DISABLED=true to accept only gateway identity headers")
+	}
+	return cfg, nil
+}
+
+// SessionSigner 簽發和校驗 HMAC-SHA256 簽名的會話令牌
+//
+// 令牌格式: base64url(claims JSON) + "." + base64url(signature)
+type SessionSigner struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewSessionSigner(secret []byte, ttl time.Duration) *SessionSigner {
+	return &SessionSigner{secret: secret, ttl: ttl, now: time.Now}
+}
+
+// Issue 簽發令牌，IssuedAt/ExpiresAt 由簽發者填寫
+func (s *SessionSigner) Issue(claims SessionClaims) (string, time.Time, error) {
+	now := s.now()
+	expiresAt := now.Add(s.ttl)
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = expiresAt.Unix()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.sign(encoded), expiresAt, nil
+}
+
+func (s *SessionSigner) Verify(token string) (*SessionClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || encoded == "" || signature == "" {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(encoded))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims SessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.OpenID == "" {
+		return nil, ErrInvalidToken
+	}
+	if s.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func (s *SessionSigner) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SessionMiddleware 從 Authorization: Bearer <token> 解析用戶身份
+//
+// 沒有攜帶令牌的請求回退到 HeaderMiddleware 校驗過的 X-WX-* 請求頭（微信雲托管注入）；
+// 都沒有的請求直接返回 401。signer 為 nil（會話已關閉）時所有令牌都無效。
+func SessionMiddleware(signer *SessionSigner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			if c.GetBool(gatewayIdentity) && GetUserID(c) != "" {
+				c.Next()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(c, "未登錄"))
+			return
+		}
+
+		if signer == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(c, "登錄憑證無效"))
+			return
+		}
+		claims, err := signer.Verify(token)
+		if err != nil {
+			msg := "登錄憑證無效"
+			if errors.Is(err, ErrTokenExpired) {
+				msg = "登錄已過期"
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(c, msg))
+			return
+		}
+
+		setRequestUser(c, claims.OpenID)
+		c.Set(UUID, claims.UnionID)
+		c.Next()
+	}
+}
+
+func bearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
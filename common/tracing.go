@@ -0,0 +1,191 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 鏈路追蹤的導出方式
+const (
+	TraceExporterNone = "none"
+	TraceExporterOTLP = "otlp" // OTLP/HTTP，地址等使用標準的 OTEL_EXPORTER_OTLP_* 環境變量
+	TraceExporterFile = "file" // 每行一個 span 的 JSON，測試和本地調試使用
+)
+
+const tracerName = "test-git"
+
+type TracingConfig struct {
+	Exporter    string
+	File        string  // file 導出的文件路徑
+	SampleRatio float64 // 沒有上游採樣決定時的採樣比例
+	ServiceName string
+}
+
+func LoadTracingConfig(lookup func(string) (string, bool)) (TracingConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := TracingConfig{
+		Exporter:    TraceExporterNone,
+		File:        "traces.ndjson",
+		SampleRatio: 1,
+		ServiceName: "test-git",
+	}
+	if v := getenv("OTEL_TRACES_EXPORTER"); v != "" {
+		switch v {
+		case TraceExporterNone, TraceExporterOTLP, TraceExporterFile:
+			cfg.Exporter = v
+		default:
+			return cfg, fmt.Errorf("invalid OTEL_TRACES_EXPORTER %q", v)
+		}
+	}
+	if v := getenv("OTEL_TRACES_FILE"); v != "" {
+		cfg.File = v
+	}
+	if v := getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return cfg, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG %q", v)
+		}
+		cfg.SampleRatio = ratio
+	}
+	if v := getenv("OTEL_SERVICE_NAME"); v != "" {
+		cfg.ServiceName = v
+	}
+	return cfg, nil
+}
+
+// InitTracing 設置全局的 TracerProvider 和 W3C traceparent 傳播，返回的函數在退出前調用以導出剩餘的 span
+func InitTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Exporter == TraceExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		file     *os.File
+		err      error
+	)
+	switch cfg.Exporter {
+	case TraceExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case TraceExporterFile:
+		file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err == nil {
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// StartSpan 在 ctx 下開始一個子 span，沒有初始化鏈路追蹤時是空操作
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+const RequestIDHeader = "X-Request-ID"
+
+// 只接受常見字符的請求 ID，避免把任意內容寫進日志和響應頭
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware 沿用上游傳入的 X-Request-ID，沒有或不合法時生成新的，並在響應頭中返回
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(reqID) {
+			reqID = uuid.New().String()
+		}
+		c.Set("request_id", reqID)
+		c.Header(RequestIDHeader, reqID)
+		c.Next()
+	}
+}
+
+func GetRequestID(c *gin.Context) string {
+	return c.GetString("request_id")
+}
+
+// ErrorBody 錯誤響應體，附帶請求 ID 方便用戶反饋問題時查找日志
+func ErrorBody(c *gin.Context, msg string) gin.H {
+	body := gin.H{"error": msg}
+	if reqID := GetRequestID(c); reqID != "" {
+		body["request_id"] = reqID
+	}
+	return body
+}
+
+// TracingMiddleware 從 traceparent 延續上游的鏈路，為每個請求創建服務端 span，需放在 RequestIDMiddleware 之後
+func TracingMiddleware() gin.HandlerFunc {
+	tracer := otel.Tracer(tracerName)
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+				attribute.String("client.address", c.ClientIP()),
+				attribute.String("request.id", GetRequestID(c)),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		if sc := span.SpanContext(); sc.IsValid() {
+			c.Header("X-Trace-ID", sc.TraceID().String())
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if ref := requestUserRef(GetUserID(c)); ref != "" {
+			span.SetAttributes(attribute.String("enduser.id", ref))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, strconv.Itoa(status))
+		}
+	}
+}
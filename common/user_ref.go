@@ -0,0 +1,99 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// userRefPrefix 用戶引用的前綴，沒有前綴的是舊日志中的明文 openid；
+// userHashPrefix 是沒有密鑰時的哈希引用，只能篩選不能還原
+const (
+	userRefPrefix  = "u1."
+	userHashPrefix = "h1."
+)
+
+var ErrInvalidUserRef = errors.New("invalid user reference")
+
+// userRefKey 請求日志、追蹤和應用日志中記錄用戶時使用的密鑰，由 ConfigureBodyCapture 設置
+var userRefKey []byte
+
+// UserRef 用密鑰把用戶 ID 轉換成不可讀的引用，同一用戶總是得到同一個引用，便於按用戶篩選；
+// 持有密鑰時可以用 ResolveUserRef 還原。key 為空時返回用戶 ID 的哈希，同樣可以按用戶篩選，
+// 但不能還原；userID 為空時返回空串
+//
+// 隨機數由用戶 ID 的 HMAC 生成（類似 AES-SIV），解密後重新計算並比較，防止篡改。
+func UserRef(key []byte, userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if len(key) == 0 {
+		sum := sha256.Sum256([]byte("user-ref-hash:" + userID))
+		return userHashPrefix + base64.RawURLEncoding.EncodeToString(sum[:16])
+	}
+	aead, nonceKey := userRefCipher(key)
+	nonce := userRefNonce(nonceKey, userID, aead.NonceSize())
+	sealed := aead.Seal(nonce, nonce, []byte(userID), nil)
+	return userRefPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// ResolveUserRef 還原 UserRef 生成的引用；沒有前綴的值按舊日志的明文用戶 ID 原樣返回，
+// 沒有密鑰時生成的哈希引用無法還原，返回 ErrInvalidUserRef
+func ResolveUserRef(key []byte, ref string) (string, error) {
+	if strings.HasPrefix(ref, userHashPrefix) {
+		return "", ErrInvalidUserRef
+	}
+	encoded, ok := strings.CutPrefix(ref, userRefPrefix)
+	if !ok {
+		return ref, nil
+	}
+	if len(key) == 0 {
+		return "", ErrInvalidUserRef
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidUserRef
+	}
+	aead, nonceKey := userRefCipher(key)
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidUserRef
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil || !hmac.Equal(nonce, userRefNonce(nonceKey, string(plain), len(nonce))) {
+		return "", ErrInvalidUserRef
+	}
+	return string(plain), nil
+}
+
+// requestUserRef 當前請求用戶在日志中的引用
+func requestUserRef(userID string) string {
+	return UserRef(userRefKey, userID)
+}
+
+func userRefCipher(key []byte) (cipher.AEAD, []byte) {
+	encKey := deriveKey(key, "user-ref-enc")
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		panic(err) // 派生的密鑰固定 32 字節
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead, deriveKey(key, "user-ref-nonce")
+}
+
+func userRefNonce(nonceKey []byte, userID string, size int) []byte {
+	return deriveKey(nonceKey, userID)[:size]
+}
+
+func deriveKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
@@ -1,6 +1,9 @@
 package common
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,24 +19,51 @@ const (
 	AppID  = "app_id"
 	UUID   = "uuid"
 	Env    = "local"
+
+	gatewayIdentity = "gateway_identity"
 )
 
-func HeaderMiddleware() gin.HandlerFunc {
+// HeaderMiddleware 只接受可信網關注入的 X-WX-* 請求頭，其他來源攜帶身份請求頭的請求返回 401
+func HeaderMiddleware(cfg GatewayConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.Request.Header.Get(WxOpenID)
-		appID := c.Request.Header.Get(WxAppID)
-		UUID := c.Request.Header.Get(WxUnionID)
-		EnvValue := c.Request.Header.Get(WxEnv)
+		if !hasIdentityHeaders(c.Request) {
+			c.Next()
+			return
+		}
 
-		c.Set(UserID, userID)
-		c.Set(AppID, appID)
-		c.Set(UUID, UUID)
-		c.Set(Env, EnvValue)
+		if err := cfg.Verify(c.Request, time.Now()); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(c, "身份請求頭校驗失敗："+err.Error()))
+			return
+		}
 
+		setIdentityFromHeader(c)
+		c.Set(gatewayIdentity, true)
 		c.Next()
 	}
 }
 
+// SetTrustedProxies 只在 TCP 對端屬於 WX_TRUSTED_PROXIES 時採信 X-Forwarded-For/X-Real-IP，否則 ClientIP 取對端地址。
+// gin 默認信任所有代理，客戶端可以偽造 X-Forwarded-For 繞過按 IP 的限流和冪等
+func SetTrustedProxies(r *gin.Engine, cfg GatewayConfig) error {
+	proxies := make([]string, 0, len(cfg.TrustedProxies))
+	for _, ipNet := range cfg.TrustedProxies {
+		proxies = append(proxies, ipNet.String())
+	}
+	return r.SetTrustedProxies(proxies)
+}
+
+func setIdentityFromHeader(c *gin.Context) {
+	userID := c.Request.Header.Get(WxOpenID)
+	appID := c.Request.Header.Get(WxAppID)
+	unionID := c.Request.Header.Get(WxUnionID)
+	envValue := c.Request.Header.Get(WxEnv)
+
+	setRequestUser(c, userID)
+	c.Set(AppID, appID)
+	c.Set(UUID, unionID)
+	c.Set(Env, envValue)
+}
+
 func GetUserID(c *gin.Context) string {
 	userID, exists := c.Get(UserID)
 	if !exists {
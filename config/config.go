@@ -0,0 +1,326 @@
+// Package config 把配置文件、環境變量和命令行參數合併成一份類型化的配置
+//
+// 優先級從低到高：默認值 < 配置文件 < 環境變量 < 命令行參數。配置文件的鍵和環境變量一一對應，
+// 嵌套的鍵用下劃線連接後轉成大寫，例如 server.tls.cert_file 對應 SERVER_TLS_CERT_FILE。
+// 密碼類配置可以用 <KEY>_FILE 指定一個文件，從文件讀取內容，適用於 Docker/Kubernetes secrets。
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"test-git/common"
+	"test-git/db"
+	"test-git/repository"
+	"test-git/wechat"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config 服務啟動需要的全部配置
+type Config struct {
+	Server      common.ServerConfig
+	Store       repository.StoreConfig
+	Database    db.DBConfig
+	LogDatabase db.DBConfig
+	Partition   db.RequestLogPartitionConfig
+	AppLog      common.AppLogConfig
+	LogSink     common.LogSinkConfig
+	LogQueue    common.LogQueueConfig
+	BodyCapture common.BodyCaptureConfig
+	Gateway     common.GatewayConfig
+	Session     common.SessionConfig
+	Admin       common.AdminConfig
+	RateLimit   common.RateLimitConfig
+	Idempotency common.IdempotencyConfig
+	Metrics     common.MetricsConfig
+	Profiler    common.ProfilerConfig
+	Tracing     common.TracingConfig
+	Health      common.HealthConfig
+	WeChat      wechat.Config
+}
+
+// Options 命令行指定的配置來源
+type Options struct {
+	File string            // .yaml、.yml 或 .toml，為空時讀取 CONFIG_FILE
+	Set  map[string]string // 命令行覆蓋的配置，優先級最高
+}
+
+// RegisterFlags 註冊 -config 和 -set KEY=VALUE，-set 可以重複使用
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.File, "config", "", "配置文件（.yaml/.yml/.toml），默認讀取 CONFIG_FILE")
+	fs.Func("set", "覆蓋配置項，如 -set RATE_LIMIT_ENABLED=false，可重複使用", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return fmt.Errorf("want KEY=VALUE, got %q", v)
+		}
+		o.set(key, value)
+		return nil
+	})
+}
+
+// Flag 註冊一個對應單個配置項的快捷參數，如 -addr 對應 SERVER_ADDR
+func (o *Options) Flag(fs *flag.FlagSet, name, key, usage string) {
+	fs.Func(name, usage+"（"+key+"）", func(v string) error {
+		o.set(key, v)
+		return nil
+	})
+}
+
+func (o *Options) set(key, value string) {
+	if o.Set == nil {
+		o.Set = make(map[string]string)
+	}
+	o.Set[strings.ToUpper(strings.TrimSpace(key))] = value
+}
+
+// Load 合併各個配置來源並校驗，返回所有無效的配置項而不是只返回第一個
+//
+// 合併結果只傳給各模塊的 Load*Config，不寫回進程環境變量，從 _FILE 讀取的密鑰不會暴露給子進程。
+func Load(opts Options) (*Config, error) {
+	file := opts.File
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+
+	var layers []map[string]string
+	if file != "" {
+		values, err := ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, values)
+	}
+	env := make(map[string]string)
+	for _, key := range Keys() {
+		if v, ok := os.LookupEnv(key); ok {
+			env[key] = v
+		}
+	}
+	layers = append(layers, env)
+	for key := range opts.Set {
+		if !knownKeys[key] {
+			return nil, fmt.Errorf("unknown config key %q", key)
+		}
+	}
+	layers = append(layers, opts.Set)
+
+	merged := make(map[string]string)
+	for _, layer := range layers {
+		if err := resolveSecretFiles(layer); err != nil {
+			return nil, err
+		}
+		for key, value := range layer {
+			merged[key] = value
+		}
+	}
+	return fromValues(func(key string) (string, bool) {
+		v, ok := merged[key]
+		return v, ok
+	})
+}
+
+// fromValues 用合併後的配置調用各模塊的配置讀取函數並收集錯誤
+func fromValues(lookup func(string) (string, bool)) (*Config, error) {
+	var (
+		cfg  Config
+		errs []error
+		err  error
+	)
+	collect := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	cfg.Server, err = common.LoadServerConfig(lookup)
+	collect(err)
+	cfg.Store, err = repository.LoadStoreConfig(lookup)
+	collect(err)
+	cfg.Database, err = db.LoadDBConfig(lookup)
+	collect(err)
+	cfg.LogDatabase, err = db.LoadLogDBConfig(lookup, cfg.Database)
+	collect(err)
+	cfg.Partition, err = db.LoadRequestLogPartitionConfig(lookup)
+	collect(err)
+	cfg.AppLog, err = common.LoadAppLogConfig(lookup)
+	collect(err)
+	cfg.LogSink, err = common.LoadLogSinkConfig(lookup)
+	collect(err)
+	cfg.LogQueue, err = common.LoadLogQueueConfig(lookup)
+	collect(err)
+	cfg.BodyCapture, err = common.LoadBodyCaptureConfig(lookup)
+	collect(err)
+	cfg.Gateway, err = common.LoadGatewayConfig(lookup)
+	collect(err)
+	cfg.Session, err = common.LoadSessionConfig(lookup)
+	collect(err)
+	// 沒有單獨配置用戶引用密鑰時使用會話密鑰，日志中的用戶仍然可以在回放時還原；
+	// 兩者都沒有時記錄哈希引用
+	if len(cfg.BodyCapture.UserRefKey) == 0 {
+		cfg.BodyCapture.UserRefKey = cfg.Session.Secret
+	}
+	cfg.Admin, err = common.LoadAdminConfig(lookup)
+	collect(err)
+	cfg.RateLimit, err = common.LoadRateLimitConfig(lookup)
+	collect(err)
+	cfg.Idempotency, err = common.LoadIdempotencyConfig(lookup)
+	collect(err)
+	cfg.Metrics, err = common.LoadMetricsConfig(lookup)
+	collect(err)
+	cfg.Profiler, err = common.LoadProfilerConfig(lookup)
+	collect(err)
+	cfg.Tracing, err = common.LoadTracingConfig(lookup)
+	collect(err)
+	cfg.Health, err = common.LoadHealthConfig(lookup)
+	collect(err)
+	cfg.WeChat = wechat.LoadConfig(lookup)
+
+	if cfg.Server.TLSEnabled() {
+		for _, path := range []string{cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile} {
+			if _, err := os.Stat(path); err != nil {
+				errs = append(errs, fmt.Errorf("TLS file: %v", err))
+			}
+		}
+	}
+
+	// 內存模式不連接主庫，依賴主庫的組件也只能用內存實現
+	if cfg.Store.Kind == repository.StoreMemory {
+		if cfg.RateLimit.Store == "postgres" {
+			errs = append(errs, errors.New("RATE_LIMIT_STORE=postgres requires STORE=postgres"))
+		}
+		if cfg.Idempotency.Store == "postgres" {
+			errs = append(errs, errors.New("IDEMPOTENCY_STORE=postgres requires STORE=postgres"))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ReadFile 讀取配置文件並展開成環境變量形式的鍵值
+func ReadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("unsupported config file type %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flatten(values, "", tree); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+func flatten(dst map[string]string, prefix string, tree map[string]interface{}) error {
+	for name, node := range tree {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if sub, ok := node.(map[string]interface{}); ok {
+			if err := flatten(dst, path, sub); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+		if !knownKeys[key] {
+			return fmt.Errorf("unknown key %q", path)
+		}
+		var (
+			value string
+			err   error
+		)
+		if list, ok := node.([]interface{}); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				if items[i], err = scalar(item); err != nil {
+					break
+				}
+			}
+			value = strings.Join(items, ",")
+		} else {
+			value, err = scalar(node)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		dst[key] = value
+	}
+	return nil
+}
+
+func scalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", v)
+}
+
+// resolveSecretFiles 把 <KEY>_FILE 替換成文件內容，同一來源不能同時設置兩者
+func resolveSecretFiles(layer map[string]string) error {
+	for _, key := range secretKeys {
+		path, ok := layer[key+"_FILE"]
+		if !ok {
+			continue
+		}
+		if _, dup := layer[key]; dup {
+			return fmt.Errorf("%s and %s_FILE are both set", key, key)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s_FILE: %v", key, err)
+		}
+		layer[key] = strings.TrimRight(string(data), "\r\n")
+		delete(layer, key+"_FILE")
+	}
+	return nil
+}
+
+// Keys 返回所有支持的配置項
+func Keys() []string {
+	keys := make([]string, 0, len(knownKeys))
+	for key := range knownKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
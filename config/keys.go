@@ -0,0 +1,106 @@
+package config
+
+// secretKeys 可以用 <KEY>_FILE 從文件讀取的配置項
+var secretKeys = []string{
+	"DB_DSN",
+	"DB_PASSWORD",
+	"REQUEST_LOG_DB_DSN",
+	"REQUEST_LOG_DB_PASSWORD",
+	"REQUEST_LOG_USER_KEY",
+	"SESSION_SECRET",
+	"ADMIN_TOKENS",
+	"METRICS_TOKEN",
+	"WX_GATEWAY_SECRET",
+	"WX_SECRET",
+}
+
+// knownKeys 各模塊讀取的環境變量，配置文件和 -set 只接受這些鍵，避免拼寫錯誤被悄悄忽略
+var knownKeys = map[string]bool{
+	"GIN_MODE": true,
+	"STORE":    true,
+
+	"SERVER_ADDR":                true,
+	"SERVER_READ_HEADER_TIMEOUT": true,
+	"SERVER_READ_TIMEOUT":        true,
+	"SERVER_WRITE_TIMEOUT":       true,
+	"SERVER_IDLE_TIMEOUT":        true,
+	"SERVER_SHUTDOWN_TIMEOUT":    true,
+	"SERVER_SHUTDOWN_DELAY":      true,
+	"SERVER_TLS_CERT_FILE":       true,
+	"SERVER_TLS_KEY_FILE":        true,
+
+	"REQUEST_LOG_SINKS":                true,
+	"REQUEST_LOG_FILE_DIR":             true,
+	"REQUEST_LOG_FILE_MAX_MB":          true,
+	"REQUEST_LOG_FILE_MAX_BACKUPS":     true,
+	"REQUEST_LOG_QUEUE_SIZE":           true,
+	"REQUEST_LOG_OVERFLOW":             true,
+	"REQUEST_LOG_BLOCK_TIMEOUT":        true,
+	"REQUEST_LOG_SPILL_DIR":            true,
+	"REQUEST_LOG_BODY_ROUTES":          true,
+	"REQUEST_LOG_BODY_CONTENT_TYPES":   true,
+	"REQUEST_LOG_BODY_MAX_BYTES":       true,
+	"REQUEST_LOG_REDACT_PATHS":         true,
+	"REQUEST_LOG_REDACT_PATTERNS":      true,
+	"REQUEST_LOG_RETENTION_DAYS":       true,
+	"REQUEST_LOG_FILE_RETENTION_DAYS":  true,
+	"REQUEST_LOG_PREMAKE_DAYS":         true,
+	"REQUEST_LOG_MAINTENANCE_INTERVAL": true,
+
+	"LOG_FORMAT":     true,
+	"LOG_LEVEL":      true,
+	"LOG_LEVELS":     true,
+	"LOG_ADD_SOURCE": true,
+
+	"WX_TRUST_HEADER":          true,
+	"WX_TRUSTED_PROXIES":       true,
+	"WX_GATEWAY_REPLAY_WINDOW": true,
+	"WX_CODE2SESSION":          true,
+	"WX_APPID":                 true,
+
+	"SESSION_TTL":      true,
+	"SESSION_DISABLED": true,
+
+	"RATE_LIMIT_ENABLED": true,
+	"RATE_LIMIT_STORE":   true,
+	"RATE_LIMIT_DEFAULT": true,
+	"RATE_LIMIT_ROUTES":  true,
+
+	"IDEMPOTENCY_STORE":     true,
+	"IDEMPOTENCY_TTL":       true,
+	"IDEMPOTENCY_MAX_BYTES": true,
+
+	"METRICS_ENABLED": true,
+	"METRICS_PATH":    true,
+
+	"PROFILER_SAMPLE_RATE":      true,
+	"PROFILER_RING_SIZE":        true,
+	"PROFILER_SLOW_THRESHOLD":   true,
+	"PROFILER_PROFILE_DIR":      true,
+	"PROFILER_MAX_PROFILE_TIME": true,
+	"PROFILER_MAX_PROFILES":     true,
+
+	"OTEL_TRACES_EXPORTER":        true,
+	"OTEL_TRACES_FILE":            true,
+	"OTEL_TRACES_SAMPLER_ARG":     true,
+	"OTEL_SERVICE_NAME":           true,
+	"OTEL_EXPORTER_OTLP_ENDPOINT": true,
+
+	"HEALTH_CHECK_TIMEOUT":       true,
+	"HEALTH_LOG_QUEUE_THRESHOLD": true,
+}
+
+func init() {
+	for _, prefix := range []string{"DB_", "REQUEST_LOG_DB_"} {
+		for _, name := range []string{
+			"HOST", "PORT", "USER", "NAME", "SSLMODE",
+			"MAX_OPEN_CONNS", "MAX_IDLE_CONNS", "CONN_MAX_LIFETIME", "CONN_MAX_IDLE_TIME",
+		} {
+			knownKeys[prefix+name] = true
+		}
+	}
+	for _, key := range secretKeys {
+		knownKeys[key] = true
+		knownKeys[key+"_FILE"] = true
+	}
+}
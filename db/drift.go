@@ -0,0 +1,286 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"test-git/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// MainModels 由 migrations 維護表結構的模型
+var MainModels = []interface{}{
+	&model.Book{}, &model.Role{}, &model.User{}, &model.AdminAudit{}, &model.RateLimitBucket{}, &model.IdempotencyKey{},
+}
+
+// LogModels 請求日志庫的模型，表結構由 EnsureRequestLogPartitions 維護
+var LogModels = []interface{}{&model.RequestLog{}}
+
+type ColumnSpec struct {
+	Name     string
+	Type     string // 使用 format_type 的寫法，如 character varying(255)
+	Nullable bool
+}
+
+type IndexSpec struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Partial bool // 帶 WHERE 條件，gorm 標籤一般不描述這類維護用索引
+}
+
+// TableSpec 一張表的列、主鍵和索引
+type TableSpec struct {
+	Name       string
+	Columns    []ColumnSpec
+	PrimaryKey []string
+	Indexes    []IndexSpec
+}
+
+// ModelSpec 根據 gorm 標籤推導模型對應的表結構，db 只用來確定方言和命名策略
+func ModelSpec(db *gorm.DB, value interface{}) (TableSpec, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(value); err != nil {
+		return TableSpec{}, err
+	}
+	typer, ok := db.Migrator().(interface{ DataTypeOf(*schema.Field) string })
+	if !ok {
+		return TableSpec{}, fmt.Errorf("dialect %s does not expose column types", db.Dialector.Name())
+	}
+
+	s := stmt.Schema
+	spec := TableSpec{Name: s.Table}
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.IgnoreMigration {
+			continue
+		}
+		spec.Columns = append(spec.Columns, ColumnSpec{
+			Name:     field.DBName,
+			Type:     normalizeColumnType(typer.DataTypeOf(field)),
+			Nullable: !field.NotNull && !field.PrimaryKey,
+		})
+	}
+	for _, field := range s.PrimaryFields {
+		spec.PrimaryKey = append(spec.PrimaryKey, field.DBName)
+	}
+	for _, idx := range s.ParseIndexes() {
+		index := IndexSpec{Name: idx.Name, Unique: idx.Class == "UNIQUE", Partial: idx.Where != ""}
+		for _, opt := range idx.Fields {
+			index.Columns = append(index.Columns, opt.DBName)
+		}
+		spec.Indexes = append(spec.Indexes, index)
+	}
+	sort.Slice(spec.Indexes, func(i, j int) bool { return spec.Indexes[i].Name < spec.Indexes[j].Name })
+	return spec, nil
+}
+
+// LiveSpec 從 Postgres 系統表讀取表結構，表不存在時返回 Name 為空的 TableSpec
+func LiveSpec(ctx context.Context, db *gorm.DB, table string) (TableSpec, error) {
+	tx := db.WithContext(ctx)
+	var exists bool
+	if err := tx.Raw("SELECT to_regclass(?) IS NOT NULL", table).Scan(&exists).Error; err != nil {
+		return TableSpec{}, err
+	}
+	if !exists {
+		return TableSpec{}, nil
+	}
+
+	spec := TableSpec{Name: table}
+	err := tx.Raw(`
+SELECT a.attname AS name, format_type(a.atttypid, a.atttypmod) AS type, NOT a.attnotnull AS nullable
+FROM pg_attribute a
+WHERE a.attrelid = to_regclass(?) AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, table).Scan(&spec.Columns).Error
+	if err != nil {
+		return TableSpec{}, err
+	}
+
+	var indexes []struct {
+		Name    string
+		Columns string
+		Unique  bool
+		Primary bool
+		Partial bool
+	}
+	err = tx.Raw(`
+SELECT i.relname AS name, x.indisunique AS "unique", x.indisprimary AS "primary", x.indpred IS NOT NULL AS partial,
+	array_to_string(ARRAY(
+		SELECT a.attname FROM unnest(x.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = x.indrelid AND a.attnum = k.attnum
+		ORDER BY k.ord), ',') AS columns
+FROM pg_index x
+JOIN pg_class i ON i.oid = x.indexrelid
+WHERE x.indrelid = to_regclass(?)
+ORDER BY i.relname`, table).Scan(&indexes).Error
+	if err != nil {
+		return TableSpec{}, err
+	}
+	for _, idx := range indexes {
+		columns := strings.Split(idx.Columns, ",")
+		if idx.Primary {
+			spec.PrimaryKey = columns
+			continue
+		}
+		spec.Indexes = append(spec.Indexes, IndexSpec{Name: idx.Name, Columns: columns, Unique: idx.Unique, Partial: idx.Partial})
+	}
+	return spec, nil
+}
+
+// TableDrift 一張表上模型和數據庫不一致的地方
+type TableDrift struct {
+	Table    string
+	Problems []string
+}
+
+// DiffSchema 比較模型和數據庫裡的表結構，只返回有差異的表
+func DiffSchema(ctx context.Context, db *gorm.DB, models ...interface{}) ([]TableDrift, error) {
+	var drifts []TableDrift
+	for _, m := range models {
+		want, err := ModelSpec(db, m)
+		if err != nil {
+			return nil, err
+		}
+		got, err := LiveSpec(ctx, db, want.Name)
+		if err != nil {
+			return nil, err
+		}
+		if problems := CompareSpecs(want, got); len(problems) > 0 {
+			drifts = append(drifts, TableDrift{Table: want.Name, Problems: problems})
+		}
+	}
+	return drifts, nil
+}
+
+// CompareSpecs 逐項比較模型推導的表結構和數據庫表結構，返回可讀的差異描述
+//
+// 數據庫裡額外的部分索引不算差異，它們是維護任務使用的，gorm 標籤不描述。
+func CompareSpecs(model, live TableSpec) []string {
+	if live.Name == "" {
+		return []string{"table missing in database"}
+	}
+	var problems []string
+
+	liveColumns := make(map[string]ColumnSpec, len(live.Columns))
+	for _, col := range live.Columns {
+		liveColumns[col.Name] = col
+	}
+	for _, want := range model.Columns {
+		got, ok := liveColumns[want.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("column %s: only in model (%s)", want.Name, describeColumn(want)))
+			continue
+		}
+		delete(liveColumns, want.Name)
+		if want.Type != got.Type || want.Nullable != got.Nullable {
+			problems = append(problems, fmt.Sprintf("column %s: model %s, database %s", want.Name, describeColumn(want), describeColumn(got)))
+		}
+	}
+	for _, col := range live.Columns {
+		if _, extra := liveColumns[col.Name]; extra {
+			problems = append(problems, fmt.Sprintf("column %s: only in database (%s)", col.Name, describeColumn(col)))
+		}
+	}
+
+	if !equalStrings(model.PrimaryKey, live.PrimaryKey) {
+		problems = append(problems, fmt.Sprintf("primary key: model (%s), database (%s)",
+			strings.Join(model.PrimaryKey, ", "), strings.Join(live.PrimaryKey, ", ")))
+	}
+
+	liveIndexes := make(map[string]IndexSpec, len(live.Indexes))
+	for _, idx := range live.Indexes {
+		liveIndexes[idx.Name] = idx
+	}
+	for _, want := range model.Indexes {
+		got, ok := liveIndexes[want.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("index %s: only in model %s", want.Name, describeIndex(want)))
+			continue
+		}
+		delete(liveIndexes, want.Name)
+		if want.Unique != got.Unique || !equalStrings(want.Columns, got.Columns) {
+			problems = append(problems, fmt.Sprintf("index %s: model %s, database %s", want.Name, describeIndex(want), describeIndex(got)))
+		}
+	}
+	for _, idx := range live.Indexes {
+		if _, extra := liveIndexes[idx.Name]; extra && !idx.Partial {
+			problems = append(problems, fmt.Sprintf("index %s: only in database %s", idx.Name, describeIndex(idx)))
+		}
+	}
+	return problems
+}
+
+func describeColumn(col ColumnSpec) string {
+	if col.Nullable {
+		return col.Type + " NULL"
+	}
+	return col.Type + " NOT NULL"
+}
+
+func describeIndex(idx IndexSpec) string {
+	desc := "(" + strings.Join(idx.Columns, ", ") + ")"
+	if idx.Unique {
+		desc = "UNIQUE " + desc
+	}
+	return desc
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	typeWithArgs = regexp.MustCompile(`^([a-z ]+?)\s*(\(.*\))?$`)
+	// gorm 標籤和方言使用的類型名 -> format_type 的寫法
+	columnTypeAliases = map[string]string{
+		"bigserial":   "bigint",
+		"serial8":     "bigint",
+		"int8":        "bigint",
+		"serial":      "integer",
+		"serial4":     "integer",
+		"int":         "integer",
+		"int4":        "integer",
+		"smallserial": "smallint",
+		"int2":        "smallint",
+		"varchar":     "character varying",
+		"char":        "character",
+		"decimal":     "numeric",
+		"float8":      "double precision",
+		"float4":      "real",
+		"bool":        "boolean",
+		"timestamptz": "timestamp with time zone",
+		"timestamp":   "timestamp without time zone",
+		"timetz":      "time with time zone",
+		"time":        "time without time zone",
+	}
+)
+
+// normalizeColumnType 把 varchar(255)、bigserial、timestamptz 等寫法轉成 Postgres format_type 的輸出
+func normalizeColumnType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	m := typeWithArgs.FindStringSubmatch(t)
+	if m == nil {
+		return t
+	}
+	name, args := m[1], strings.ReplaceAll(m[2], " ", "")
+	if alias, ok := columnTypeAliases[name]; ok {
+		name = alias
+	}
+	// 帶精度的時間類型，format_type 把精度寫在類型名中間
+	if args != "" && (strings.HasPrefix(name, "timestamp ") || strings.HasPrefix(name, "time ")) {
+		base, zone, _ := strings.Cut(name, " ")
+		return base + args + " " + zone
+	}
+	return name + args
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PingCheck 帶超時地 ping 數據庫，並返回連接池狀態
+func PingCheck(db *gorm.DB) func(ctx context.Context) (map[string]interface{}, error) {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if db == nil {
+			return nil, fmt.Errorf("database not initialized")
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		stats := sqlDB.Stats()
+		details := map[string]interface{}{
+			"open_connections": stats.OpenConnections,
+			"in_use":           stats.InUse,
+			"idle":             stats.Idle,
+			"wait_count":       stats.WaitCount,
+		}
+		return details, sqlDB.PingContext(ctx)
+	}
+}
+
+// MigrationCheck 檢查主庫的遷移版本是否和二進制文件一致
+func MigrationCheck(m *Migrator) func(ctx context.Context) (map[string]interface{}, error) {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		status, err := m.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]interface{}{
+			"current": status.Current,
+			"latest":  status.Latest,
+			"dirty":   status.Dirty,
+		}
+		return details, status.Err()
+	}
+}
+
+// RequestLogPartitionCheck 檢查 request_logs 是分區表且今天的分區已經創建
+func RequestLogPartitionCheck(db *gorm.DB) func(ctx context.Context) (map[string]interface{}, error) {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if db == nil {
+			return nil, fmt.Errorf("log database not initialized")
+		}
+		var row struct {
+			Partitioned bool
+			Partitions  int
+			Today       bool
+		}
+		err := db.WithContext(ctx).Raw(`
+SELECT
+	EXISTS (SELECT 1 FROM pg_class WHERE relname = ? AND relkind = 'p') AS partitioned,
+	(SELECT count(*) FROM pg_inherits i JOIN pg_class p ON p.oid = i.inhparent WHERE p.relname = ?) AS partitions,
+	EXISTS (SELECT 1 FROM pg_class WHERE relname = ?) AS today`,
+			requestLogTable, requestLogTable, RequestLogPartitionName(time.Now())).Scan(&row).Error
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]interface{}{"partitions": row.Partitions}
+		switch {
+		case !row.Partitioned:
+			return details, fmt.Errorf("%s is not partitioned", requestLogTable)
+		case !row.Today:
+			return details, fmt.Errorf("partition %s missing", RequestLogPartitionName(time.Now()))
+		}
+		return details, nil
+	}
+}
@@ -0,0 +1,10 @@
+package db
+
+import "strings"
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike 轉義 LIKE/ILIKE 的通配符，用戶輸入按字面匹配；Postgres 默認以反斜杠為轉義字符
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
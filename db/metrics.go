@@ -0,0 +1,89 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+var (
+	gormQueriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gorm_queries_total",
+		Help: "Gorm statements by database, operation and result.",
+	}, []string{"db", "operation", "result"})
+	gormQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gorm_query_duration_seconds",
+		Help:    "Gorm statement latency by database and operation.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"db", "operation"})
+)
+
+const metricsStartKey = "metrics:start"
+
+// RegisterMetrics 統計 gorm 語句數和耗時，並導出連接池狀態，name 作為 db 標籤（如 main、request_log）
+func RegisterMetrics(reg prometheus.Registerer, name string, db *gorm.DB) error {
+	for _, c := range []prometheus.Collector{gormQueriesTotal, gormQueryDuration} {
+		if err := reg.Register(c); err != nil {
+			var are prometheus.AlreadyRegisteredError
+			if !errors.As(err, &are) {
+				return err
+			}
+		}
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := reg.Register(collectors.NewDBStatsCollector(sqlDB, name)); err != nil {
+		return err
+	}
+	return db.Use(metricsPlugin{name: name})
+}
+
+type metricsPlugin struct {
+	name string
+}
+
+func (p metricsPlugin) Name() string {
+	return "metrics:" + p.name
+}
+
+func (p metricsPlugin) Initialize(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(metricsStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			v, ok := tx.InstanceGet(metricsStartKey)
+			if !ok {
+				return
+			}
+			result := "ok"
+			if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				result = "error"
+			}
+			gormQueriesTotal.WithLabelValues(p.name, operation, result).Inc()
+			gormQueryDuration.WithLabelValues(p.name, operation).Observe(time.Since(v.(time.Time)).Seconds())
+		}
+	}
+
+	cb := db.Callback()
+	errs := []error{
+		cb.Create().Before("gorm:create").Register(p.Name()+":before_create", before),
+		cb.Create().After("gorm:create").Register(p.Name()+":after_create", after("create")),
+		cb.Query().Before("gorm:query").Register(p.Name()+":before_query", before),
+		cb.Query().After("gorm:query").Register(p.Name()+":after_query", after("query")),
+		cb.Update().Before("gorm:update").Register(p.Name()+":before_update", before),
+		cb.Update().After("gorm:update").Register(p.Name()+":after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register(p.Name()+":before_delete", before),
+		cb.Delete().After("gorm:delete").Register(p.Name()+":after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register(p.Name()+":before_row", before),
+		cb.Row().After("gorm:row").Register(p.Name()+":after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register(p.Name()+":before_raw", before),
+		cb.Raw().After("gorm:raw").Register(p.Name()+":after_raw", after("raw")),
+	}
+	return errors.Join(errs...)
+}
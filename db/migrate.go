@@ -0,0 +1,314 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 和 golang-migrate 使用同一張版本表，之前用 migrate CLI 遷移過的庫可以直接接著使用
+	schemaMigrationsTable = "schema_migrations"
+	// 多副本同時啟動時只讓一個進程執行遷移
+	schemaMigrationLock = 7340002
+)
+
+var ErrSchemaDirty = errors.New("schema is dirty, fix the database manually and run `migrate force <version>`")
+
+// Migration 一個版本的升級和回滾 SQL
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadMigrations 讀取遷移文件，按版本號排序，版本號必須從 1 開始連續
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		m := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %q", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[uint(version)]
+		if !ok {
+			mig = &Migration{Version: uint(version), Name: m[2]}
+			byVersion[uint(version)] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, mig := range migrations {
+		if mig.Version != uint(i+1) {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, missing %d", i+1)
+		}
+		if strings.TrimSpace(mig.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// MigrationStatus 數據庫當前的遷移版本，Current 為 0 表示還沒有執行過遷移
+type MigrationStatus struct {
+	Current uint
+	Dirty   bool
+	Latest  uint
+}
+
+// Behind 數據庫版本落後於二進制文件裡的遷移
+func (s MigrationStatus) Behind() bool {
+	return s.Current < s.Latest
+}
+
+// Err 數據庫處於 dirty 狀態或版本落後時返回錯誤，服務不能在這種表結構上運行
+func (s MigrationStatus) Err() error {
+	switch {
+	case s.Dirty:
+		return ErrSchemaDirty
+	case s.Behind():
+		return fmt.Errorf("schema is at version %d, want %d, run `migrate up`", s.Current, s.Latest)
+	}
+	return nil
+}
+
+// Migrator 在主庫上執行嵌入的遷移
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+func (m *Migrator) Status(ctx context.Context) (MigrationStatus, error) {
+	status := MigrationStatus{Latest: uint(len(m.migrations))}
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		status.Current, status.Dirty, err = readSchemaVersion(tx)
+		return err
+	})
+	return status, err
+}
+
+// Up 依次執行未執行的遷移，steps 為 0 時執行到最新版本，返回執行過的遷移
+//
+// 要執行的遷移會創建已經存在的表時不執行任何遷移，返回錯誤說明怎樣用 up N 和 force 接上版本記錄。
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(tx *gorm.DB, current uint) error {
+		pending := m.migrations[current:]
+		if steps > 0 && len(pending) > steps {
+			pending = pending[:steps]
+		}
+		if err := checkExistingTables(tx, current, pending); err != nil {
+			return err
+		}
+		for _, mig := range pending {
+			if err := tx.Exec(mig.Up).Error; err != nil {
+				return fmt.Errorf("migration %d_%s up: %v", mig.Version, mig.Name, err)
+			}
+			if err := writeSchemaVersion(tx, mig.Version); err != nil {
+				return err
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Down 從當前版本開始回滾 steps 個遷移，steps 為 0 時全部回滾
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(tx *gorm.DB, current uint) error {
+		for version := current; version > 0; version-- {
+			if steps > 0 && len(reverted) == steps {
+				break
+			}
+			mig := m.migrations[version-1]
+			if strings.TrimSpace(mig.Down) == "" {
+				return fmt.Errorf("migration %d_%s has no down script", mig.Version, mig.Name)
+			}
+			if err := tx.Exec(mig.Down).Error; err != nil {
+				return fmt.Errorf("migration %d_%s down: %v", mig.Version, mig.Name, err)
+			}
+			if err := writeSchemaVersion(tx, version-1); err != nil {
+				return err
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reverted, nil
+}
+
+// Force 只修改記錄的版本並清除 dirty 標記，不執行任何 SQL，用於手工修復失敗的遷移之後
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version > uint(len(m.migrations)) {
+		return fmt.Errorf("unknown migration version %d, latest is %d", version, len(m.migrations))
+	}
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", schemaMigrationLock).Error; err != nil {
+			return err
+		}
+		if err := ensureSchemaMigrationsTable(tx); err != nil {
+			return err
+		}
+		return writeSchemaVersion(tx, version)
+	})
+}
+
+// locked 在持有遷移鎖的事務中執行，遷移失敗時整個事務回滾，版本號保持不變
+func (m *Migrator) locked(ctx context.Context, fn func(tx *gorm.DB, current uint) error) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", schemaMigrationLock).Error; err != nil {
+			return err
+		}
+		if err := ensureSchemaMigrationsTable(tx); err != nil {
+			return err
+		}
+		current, dirty, err := readSchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrSchemaDirty
+		}
+		if current > uint(len(m.migrations)) {
+			return fmt.Errorf("database is at version %d, newer than the latest known migration %d", current, len(m.migrations))
+		}
+		return fn(tx, current)
+	})
+}
+
+var createTablePattern = regexp.MustCompile(`(?i)CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?"?(\w+)"?`)
+
+// checkExistingTables 找出第一個會創建已有表的遷移。沒有版本記錄、由 AutoMigrate 建表的庫直接 up 時，
+// CREATE TABLE IF NOT EXISTS 會跳過結構不同的舊表，之後的 CREATE INDEX 也會因為索引已存在而失敗
+func checkExistingTables(tx *gorm.DB, current uint, pending []Migration) error {
+	var tables []string
+	for _, mig := range pending {
+		for _, m := range createTablePattern.FindAllStringSubmatch(mig.Up, -1) {
+			tables = append(tables, m[1])
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	var existing []string
+	if err := tx.Raw("SELECT c.relname FROM pg_class c WHERE c.relname IN ? AND pg_table_is_visible(c.oid)", tables).
+		Scan(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		exists[name] = true
+	}
+	for i, mig := range pending {
+		for _, m := range createTablePattern.FindAllStringSubmatch(mig.Up, -1) {
+			if !exists[m[1]] {
+				continue
+			}
+			steps := "`migrate force " + strconv.FormatUint(uint64(mig.Version), 10) + "`"
+			if i > 0 {
+				steps = fmt.Sprintf("`migrate up %d`, then %s", i, steps)
+			}
+			return fmt.Errorf("migration %d_%s creates table %s, which already exists but the schema is at version %d; "+
+				"check the table against the migration with `drift`, then run %s and `migrate up` again",
+				mig.Version, mig.Name, m[1], current, steps)
+		}
+	}
+	return nil
+}
+
+func ensureSchemaMigrationsTable(tx *gorm.DB) error {
+	return tx.Exec(`CREATE TABLE IF NOT EXISTS ` + schemaMigrationsTable + ` (
+	version bigint NOT NULL PRIMARY KEY,
+	dirty boolean NOT NULL
+)`).Error
+}
+
+func readSchemaVersion(tx *gorm.DB) (uint, bool, error) {
+	var exists bool
+	if err := tx.Raw("SELECT to_regclass(?) IS NOT NULL", schemaMigrationsTable).Scan(&exists).Error; err != nil {
+		return 0, false, err
+	}
+	if !exists {
+		return 0, false, nil
+	}
+	var rows []struct {
+		Version int64
+		Dirty   bool
+	}
+	if err := tx.Raw("SELECT version, dirty FROM " + schemaMigrationsTable + " LIMIT 1").Scan(&rows).Error; err != nil {
+		return 0, false, err
+	}
+	// golang-migrate 回滾到初始狀態失敗時會寫入 -1 和 dirty
+	if len(rows) == 0 || rows[0].Version <= 0 {
+		return 0, len(rows) > 0 && rows[0].Dirty, nil
+	}
+	return uint(rows[0].Version), rows[0].Dirty, nil
+}
+
+// writeSchemaVersion 版本表只保留一行，版本為 0 時清空
+func writeSchemaVersion(tx *gorm.DB, version uint) error {
+	if err := tx.Exec("DELETE FROM " + schemaMigrationsTable).Error; err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	return tx.Exec("INSERT INTO "+schemaMigrationsTable+" (version, dirty) VALUES (?, false)", version).Error
+}
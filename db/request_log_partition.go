@@ -0,0 +1,357 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"test-git/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	requestLogTable           = "request_logs"
+	requestLogPartitionPrefix = "request_logs_p"
+	requestLogPartitionLayout = "20060102"
+	// 時間不在任何日分區範圍内的行（時鐘錯誤、回放舊日志）寫入默認分區，不會讓整批寫入失敗
+	requestLogDefaultPartition = "request_logs_default"
+
+	// 多副本同時啟動或維護時，只讓一個進程改表結構
+	requestLogMaintenanceLock = 7340001
+)
+
+// RequestLogPartitionConfig request_logs 分區和保留策略，單位為天
+type RequestLogPartitionConfig struct {
+	Retention            int           // 超過保留天數的分區整個刪除
+	FileContentRetention int           // 超過這個天數的日志清空 file_content_json
+	Premake              int           // 提前創建的未來分區數
+	Interval             time.Duration // 維護任務的執行間隔
+}
+
+func LoadRequestLogPartitionConfig(lookup func(string) (string, bool)) (RequestLogPartitionConfig, error) {
+	getenv := envGetter(lookup)
+	cfg := RequestLogPartitionConfig{
+		Retention:            30,
+		FileContentRetention: 7,
+		Premake:              3,
+		Interval:             time.Hour,
+	}
+	for env, dst := range map[string]*int{
+		"REQUEST_LOG_RETENTION_DAYS":      &cfg.Retention,
+		"REQUEST_LOG_FILE_RETENTION_DAYS": &cfg.FileContentRetention,
+		"REQUEST_LOG_PREMAKE_DAYS":        &cfg.Premake,
+	} {
+		if v := getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return cfg, fmt.Errorf("invalid %s %q", env, v)
+			}
+			*dst = n
+		}
+	}
+	if v := getenv("REQUEST_LOG_MAINTENANCE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid REQUEST_LOG_MAINTENANCE_INTERVAL %q", v)
+		}
+		cfg.Interval = d
+	}
+	if cfg.FileContentRetention > cfg.Retention {
+		return cfg, fmt.Errorf("REQUEST_LOG_FILE_RETENTION_DAYS (%d) exceeds REQUEST_LOG_RETENTION_DAYS (%d)",
+			cfg.FileContentRetention, cfg.Retention)
+	}
+	return cfg, nil
+}
+
+// RequestLogPartitionName 某一天（UTC）的分區表名
+func RequestLogPartitionName(day time.Time) string {
+	return requestLogPartitionPrefix + day.UTC().Format(requestLogPartitionLayout)
+}
+
+// 分區鍵必須包含在主鍵中，所以主鍵是 (id, created_at)
+var createRequestLogTableSQL = []string{
+	`CREATE SEQUENCE IF NOT EXISTS request_logs_id_seq`,
+	`CREATE TABLE request_logs (
+	id bigint NOT NULL DEFAULT nextval('request_logs_id_seq'),
+	request_id varchar(64) NOT NULL,
+	method varchar(10) NOT NULL,
+	service_name varchar(255),
+	path varchar(255) NOT NULL,
+	route varchar(255),
+	query_string text,
+	status_code bigint NOT NULL,
+	remote_ip varchar(45) NOT NULL,
+	user_id varchar(255),
+	user_agent text,
+	request_time double precision NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	file_name varchar(255),
+	file_size bigint,
+	content_type varchar(45) NOT NULL DEFAULT '',
+	file_content_json jsonb,
+	request_body text,
+	response_body text,
+	body_truncated boolean NOT NULL DEFAULT false,
+	request_redacted boolean NOT NULL DEFAULT false,
+	alloc_bytes bigint,
+	goroutines integer,
+	cpu_profile varchar(255),
+	CONSTRAINT request_logs_pkey PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at)`,
+	`ALTER SEQUENCE request_logs_id_seq OWNED BY request_logs.id`,
+	`CREATE TABLE request_logs_default PARTITION OF request_logs DEFAULT`,
+}
+
+// 分區表上的索引會自動建到每個分區；新增的列也在這裡補到已有的分區表上
+var requestLogSchemaSQL = []string{
+	`ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS user_id varchar(255)`,
+	`ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS request_body text`,
+	`ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS response_body text`,
+	`ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS body_truncated boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS request_redacted boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS alloc_bytes bigint`,
+	`ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS goroutines integer`,
+	`ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS cpu_profile varchar(255)`,
+	`CREATE INDEX IF NOT EXISTS idx_request_logs_request_id ON request_logs (request_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_request_logs_service_name ON request_logs (service_name)`,
+	`CREATE INDEX IF NOT EXISTS idx_request_logs_path ON request_logs (path)`,
+	`CREATE INDEX IF NOT EXISTS idx_request_logs_route ON request_logs (route)`,
+	`CREATE INDEX IF NOT EXISTS idx_request_logs_created_at ON request_logs (created_at)`,
+	// 只索引還保留文件内容的行，清理 file_content_json 時不用掃描整個分區
+	`CREATE INDEX IF NOT EXISTS idx_request_logs_file_content ON request_logs (created_at) WHERE file_content_json IS NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS request_logs_default PARTITION OF request_logs DEFAULT`,
+}
+
+const requestLogColumns = `id, request_id, method, service_name, path, route, query_string, status_code,
+	remote_ip, user_agent, request_time, created_at, file_name, file_size, content_type, file_content_json,
+	request_body, response_body, body_truncated, request_redacted, user_id, alloc_bytes, goroutines, cpu_profile`
+
+// EnsureRequestLogPartitions 保證 request_logs 是按 created_at 每天分區的表
+//
+// 表不存在時直接創建分區表；已有的普通表會改名為 request_logs_legacy，
+// 保留期内的數據複製到新表後刪除舊表。
+func EnsureRequestLogPartitions(db *gorm.DB, cfg RequestLogPartitionConfig) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", requestLogMaintenanceLock).Error; err != nil {
+			return err
+		}
+
+		var relkind string
+		err := tx.Raw("SELECT relkind FROM pg_class WHERE oid = to_regclass(?)", requestLogTable).Scan(&relkind).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		cutoff := retentionCutoff(now, cfg.Retention)
+		switch relkind {
+		case "p":
+			return ensureRequestLogSchema(tx, now, cfg)
+		case "":
+			if err := execAll(tx, createRequestLogTableSQL); err != nil {
+				return err
+			}
+			return ensureRequestLogSchema(tx, now, cfg)
+		case "r":
+			pkgLogger().Info("converting request logs to a partitioned table", "table", requestLogTable)
+			return convertRequestLogTable(tx, now, cutoff, cfg)
+		default:
+			return fmt.Errorf("%s has unexpected relkind %q", requestLogTable, relkind)
+		}
+	})
+}
+
+func convertRequestLogTable(tx *gorm.DB, now, cutoff time.Time, cfg RequestLogPartitionConfig) error {
+	// 先補齊舊表缺少的列，複製數據時兩邊的列一致
+	if err := model.AutoMigrateRequestLog(tx); err != nil {
+		return err
+	}
+	err := execAll(tx, []string{
+		`ALTER TABLE request_logs RENAME TO request_logs_legacy`,
+		`ALTER TABLE request_logs_legacy RENAME CONSTRAINT request_logs_pkey TO request_logs_legacy_pkey`,
+		// 舊表的 id 序列轉給新表繼續使用，刪除舊表時不會一起刪掉
+		`CREATE SEQUENCE IF NOT EXISTS request_logs_id_seq`,
+		`ALTER SEQUENCE request_logs_id_seq OWNED BY NONE`,
+	})
+	if err != nil {
+		return err
+	}
+	if err := execAll(tx, createRequestLogTableSQL); err != nil {
+		return err
+	}
+
+	var oldest sql.NullTime
+	err = tx.Raw("SELECT min(created_at) FROM request_logs_legacy WHERE created_at >= ?", cutoff).Scan(&oldest).Error
+	if err != nil {
+		return err
+	}
+	if oldest.Valid {
+		for day := startOfDay(oldest.Time); day.Before(now); day = day.AddDate(0, 0, 1) {
+			if err := createRequestLogPartition(tx, day); err != nil {
+				return err
+			}
+		}
+	}
+	if err := createUpcomingPartitions(tx, now, cfg.Premake); err != nil {
+		return err
+	}
+
+	// 只複製保留期内、已有分區覆蓋的數據
+	upper := startOfDay(now).AddDate(0, 0, cfg.Premake+1)
+	copySQL := fmt.Sprintf("INSERT INTO request_logs (%s) SELECT %s FROM request_logs_legacy WHERE created_at >= ? AND created_at < ?",
+		requestLogColumns, requestLogColumns)
+	result := tx.Exec(copySQL, cutoff, upper)
+	if result.Error != nil {
+		return result.Error
+	}
+	pkgLogger().Info("copied rows into partitioned table", "table", requestLogTable, "rows", result.RowsAffected)
+
+	err = execAll(tx, []string{
+		`SELECT setval('request_logs_id_seq', (SELECT COALESCE(max(id), 0) + 1 FROM request_logs_legacy), false)`,
+		`DROP TABLE request_logs_legacy`,
+	})
+	if err != nil {
+		return err
+	}
+	// 舊表的索引刪除後才能使用相同的索引名
+	return ensureRequestLogSchema(tx, now, cfg)
+}
+
+func execAll(tx *gorm.DB, stmts []string) error {
+	for _, stmt := range stmts {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureRequestLogSchema 創建索引和今天起的分區
+func ensureRequestLogSchema(tx *gorm.DB, now time.Time, cfg RequestLogPartitionConfig) error {
+	if err := execAll(tx, requestLogSchemaSQL); err != nil {
+		return err
+	}
+	return createUpcomingPartitions(tx, now, cfg.Premake)
+}
+
+func createUpcomingPartitions(tx *gorm.DB, now time.Time, premake int) error {
+	today := startOfDay(now)
+	for i := 0; i <= premake; i++ {
+		if err := createRequestLogPartition(tx, today.AddDate(0, 0, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createRequestLogPartition 創建某一天的分區。默認分區裡已有這一天的行時 Postgres 不允許直接創建，
+// 所以先建普通表，把這些行從默認分區移過去，再掛到 request_logs 上
+func createRequestLogPartition(tx *gorm.DB, day time.Time) error {
+	name := RequestLogPartitionName(day)
+	var exists bool
+	if err := tx.Raw("SELECT to_regclass(?) IS NOT NULL", name).Scan(&exists).Error; err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	from, to := day.Format(time.RFC3339), day.AddDate(0, 0, 1).Format(time.RFC3339)
+	if err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE request_logs INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", name)).Error; err != nil {
+		return err
+	}
+	moveSQL := fmt.Sprintf(`WITH moved AS (DELETE FROM %s WHERE created_at >= ? AND created_at < ? RETURNING %s)
+INSERT INTO %s (%s) SELECT %s FROM moved`,
+		requestLogDefaultPartition, requestLogColumns, name, requestLogColumns, requestLogColumns)
+	result := tx.Exec(moveSQL, from, to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		pkgLogger().Warn("moved rows out of the default request log partition", "partition", name, "rows", result.RowsAffected)
+	}
+	return tx.Exec(fmt.Sprintf("ALTER TABLE request_logs ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')", name, from, to)).Error
+}
+
+// MaintainRequestLogPartitions 創建未來的分區，刪除過期分區，清空過期的文件内容
+func MaintainRequestLogPartitions(db *gorm.DB, cfg RequestLogPartitionConfig, now time.Time) error {
+	now = now.UTC()
+	return db.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", requestLogMaintenanceLock).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			// 其他副本正在維護
+			return nil
+		}
+
+		if err := createUpcomingPartitions(tx, now, cfg.Premake); err != nil {
+			return err
+		}
+
+		var partitions []string
+		err := tx.Raw(`SELECT c.relname FROM pg_inherits i
+			JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = to_regclass(?)`, requestLogTable).Scan(&partitions).Error
+		if err != nil {
+			return err
+		}
+		cutoff := retentionCutoff(now, cfg.Retention)
+		for _, name := range partitions {
+			day, ok := parseRequestLogPartition(name)
+			// 分區的結束時間早於截止時間才整個刪除
+			if !ok || day.AddDate(0, 0, 1).After(cutoff) {
+				continue
+			}
+			if err := tx.Exec(fmt.Sprintf("DROP TABLE %s", name)).Error; err != nil {
+				return err
+			}
+			pkgLogger().Info("dropped expired request log partition", "partition", name)
+		}
+		// 默認分區不會整個刪除，過期的行逐條清理
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE created_at < ?", requestLogDefaultPartition), cutoff).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec("UPDATE request_logs SET file_content_json = NULL WHERE file_content_json IS NOT NULL AND created_at < ?",
+			retentionCutoff(now, cfg.FileContentRetention)).Error
+	})
+}
+
+// RunRequestLogMaintenance 按配置的間隔執行維護，需要在 goroutine 中運行，ctx 取消後返回
+func RunRequestLogMaintenance(ctx context.Context, db *gorm.DB, cfg RequestLogPartitionConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := MaintainRequestLogPartitions(db.WithContext(ctx), cfg, time.Now()); err != nil && ctx.Err() == nil {
+			pkgLogger().Error("request log maintenance fails", "err", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func parseRequestLogPartition(name string) (time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, requestLogPartitionPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	day, err := time.Parse(requestLogPartitionLayout, suffix)
+	return day, err == nil
+}
+
+func retentionCutoff(now time.Time, days int) time.Time {
+	return startOfDay(now).AddDate(0, 0, -days)
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "tracing:span"
+
+// RegisterTracing 為帶有鏈路上下文（WithContext）的 gorm 語句創建 span，name 作為 db.namespace
+//
+// 沒有上層 span 的語句（如後台維護任務）不會創建根 span。
+func RegisterTracing(name string, db *gorm.DB) error {
+	return db.Use(tracingPlugin{name: name})
+}
+
+type tracingPlugin struct {
+	name string
+}
+
+func (p tracingPlugin) Name() string {
+	return "tracing:" + p.name
+}
+
+func (p tracingPlugin) Initialize(db *gorm.DB) error {
+	tracer := otel.Tracer("test-git/db")
+	before := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			ctx := tx.Statement.Context
+			if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+			ctx, span := tracer.Start(ctx, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient))
+			tx.Statement.Context = ctx
+			tx.InstanceSet(tracingSpanKey, span)
+		}
+	}
+	after := func(tx *gorm.DB) {
+		v, ok := tx.InstanceGet(tracingSpanKey)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		span.SetAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.namespace", p.name),
+			attribute.String("db.collection.name", tx.Statement.Table),
+			// 參數化的 SQL，不包含參數值
+			attribute.String("db.query.text", tx.Statement.SQL.String()),
+			attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+		)
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(tx.Error)
+			span.SetStatus(codes.Error, tx.Error.Error())
+		}
+		span.End()
+	}
+
+	cb := db.Callback()
+	errs := []error{
+		cb.Create().Before("gorm:create").Register(p.Name()+":before_create", before("create")),
+		cb.Create().After("gorm:create").Register(p.Name()+":after_create", after),
+		cb.Query().Before("gorm:query").Register(p.Name()+":before_query", before("query")),
+		cb.Query().After("gorm:query").Register(p.Name()+":after_query", after),
+		cb.Update().Before("gorm:update").Register(p.Name()+":before_update", before("update")),
+		cb.Update().After("gorm:update").Register(p.Name()+":after_update", after),
+		cb.Delete().Before("gorm:delete").Register(p.Name()+":before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register(p.Name()+":after_delete", after),
+		cb.Row().Before("gorm:row").Register(p.Name()+":before_row", before("row")),
+		cb.Row().After("gorm:row").Register(p.Name()+":after_row", after),
+		cb.Raw().Before("gorm:raw").Register(p.Name()+":before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register(p.Name()+":after_raw", after),
+	}
+	return errors.Join(errs...)
+}
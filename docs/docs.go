@@ -15,6 +15,713 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/debug/profiler": {
+            "get": {
+                "description": "按最近采样请求的平均耗时或平均内存分配排序，返回前 N 个路由及其慢请求的 CPU profile",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "最耗资源的路由",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "返回的路由数（默认10）",
+                        "name": "n",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "排序方式：duration（默认）或 alloc",
+                        "name": "by",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.RouteProfileResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "请求参数错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/debug/profiler/profiles/{name}": {
+            "get": {
+                "description": "下载慢请求触发的 CPU profile，可用 go tool pprof 分析，按 request_id 标签过滤",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "下载 CPU profile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "profile 文件名",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "profile 不存在",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/log-queue": {
+            "get": {
+                "description": "返回请求日志队列的深度以及入队、丢弃、溢出、写出和失败的累计数",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "请求日志队列状态",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.LogQueueStatusResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/reports/endpoints": {
+            "get": {
+                "description": "按 method+路由模板汇总请求日志：请求数、错误率、P50/P90/P99 耗时和最慢请求，并按时间分桶",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "接口耗时和错误率报表",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "开始时间（RFC3339，默认1小时前）",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "结束时间（RFC3339，默认现在）",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "时间桶大小，如 1m、5m（默认窗口的1/60）",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "只统计该方法的时间序列",
+                        "name": "method",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "只统计该路由的时间序列",
+                        "name": "route",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "返回的接口数（默认50，最大200）",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.EndpointReportResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "请求参数错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "服务器内部错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "请求日志库不可用",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/request-logs": {
+            "get": {
+                "description": "按条件查询请求日志，按时间倒序游标分页，不返回文件内容",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "查询请求日志",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "开始时间（RFC3339，包含）",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "结束时间（RFC3339，不包含）",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "请求路径，以 * 结尾表示前缀匹配",
+                        "name": "path",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "HTTP方法",
+                        "name": "method",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "最小状态码",
+                        "name": "status_min",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "最大状态码",
+                        "name": "status_max",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "客户端IP",
+                        "name": "remote_ip",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "请求ID",
+                        "name": "request_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "服务名",
+                        "name": "service_name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "请求的 Content-Type，如 multipart/form-data",
+                        "name": "content_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "最小耗时（毫秒）",
+                        "name": "min_latency_ms",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "上一页返回的 next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页条数（默认50，最大200）",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.RequestLogListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "请求参数错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "服务器内部错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "请求日志库不可用",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/request-logs/{id}": {
+            "get": {
+                "description": "根据ID查询请求日志，包含保存的文件内容",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "查询请求日志详情",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "日志ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.RequestLogDetailResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "ID格式错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "日志不存在",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "服务器内部错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "请求日志库不可用",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/roles": {
+            "get": {
+                "description": "按用户、关键字查询所有用户的角色，可包含已删除的角色",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "跨用户查询角色",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "所属用户",
+                        "name": "wx_user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "角色名称或描述关键字",
+                        "name": "keyword",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "include 包含已删除，only 只查已删除",
+                        "name": "deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页码（默认1）",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页条数（默认10）",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.AdminRoleListResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "服务器内部错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/roles/{id}/restore": {
+            "post": {
+                "description": "撤销角色的软删除",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "恢复已删除的角色",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "角色ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.AdminRoleResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "ID格式错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "角色不存在",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "角色未被删除",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "服务器内部错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/roles/{id}/transfer": {
+            "post": {
+                "description": "把角色转给另一个用户",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "转移角色",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "角色ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "接收角色的用户",
+                        "name": "transfer",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.TransferRoleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.AdminRoleResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "请求参数错误或ID格式错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "角色不存在",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "服务器内部错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/users/{wx_user_id}/stats": {
+            "get": {
+                "description": "查询单个用户的角色数量和活跃时间",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "查询用户统计",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "管理员凭证",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "用户ID",
+                        "name": "wx_user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserStatsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "管理员凭证无效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "服务器内部错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/login": {
+            "post": {
+                "description": "用 wx.login 返回的 code 換取服務端簽發的會話令牌",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "小程序登錄",
+                "parameters": [
+                    {
+                        "description": "登錄信息",
+                        "name": "login",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.LoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.LoginResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "请求参数错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "code 無效",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "服务器内部错误",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "502": {
+                        "description": "微信服务异常",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/books": {
             "get": {
                 "description": "分页查询所有书籍",
@@ -43,6 +750,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/handler.BookListResponse"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "服务器内部错误",
                         "schema": {
@@ -84,6 +797,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "服务器内部错误",
                         "schema": {
@@ -122,6 +841,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "书籍不存在",
                         "schema": {
@@ -176,6 +901,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "书籍不存在",
                         "schema": {
@@ -218,6 +949,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "书籍不存在",
                         "schema": {
@@ -261,6 +998,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/handler.RoleListResponse"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "服务器内部错误",
                         "schema": {
@@ -328,6 +1071,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handler.CreateRoleRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "幂等键，重试时使用相同的值",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -343,6 +1092,24 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "相同请求正在处理中",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "幂等键已用于不同的请求",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "服务器内部错误",
                         "schema": {
@@ -381,6 +1148,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "角色不存在",
                         "schema": {
@@ -435,6 +1208,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "角色不存在",
                         "schema": {
@@ -477,6 +1256,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "无权限",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "角色不存在",
                         "schema": {
@@ -491,9 +1276,62 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
+        }
+    },
+    "definitions": {
+        "handler.AdminRoleListResponse": {
+            "type": "object",
+            "properties": {
+                "list": {
+                    "description": "分页数据列表",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.AdminRoleResponse"
+                    }
+                },
+                "total": {
+                    "description": "总条数",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.AdminRoleResponse": {
+            "type": "object",
+            "properties": {
+                "avatar_url": {
+                    "description": "头像URL",
+                    "type": "string"
+                },
+                "created_at": {
+                    "description": "创建时间",
+                    "type": "string"
+                },
+                "deleted_at": {
+                    "description": "删除时间，未删除为空",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "角色描述",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "角色ID",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "角色名称",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "description": "更新时间",
+                    "type": "string"
+                },
+                "wx_user_id": {
+                    "description": "所屬用戶",
+                    "type": "string"
+                }
+            }
+        },
         "handler.Attributes": {
             "type": "object",
             "properties": {
@@ -769,6 +1607,85 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.EndpointReportResponse": {
+            "type": "object",
+            "properties": {
+                "bucket_seconds": {
+                    "description": "時間桶大小（秒）",
+                    "type": "integer"
+                },
+                "endpoints": {
+                    "description": "按請求數倒序的接口統計",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.EndpointStatsResponse"
+                    }
+                },
+                "from": {
+                    "description": "統計開始時間",
+                    "type": "string"
+                },
+                "series": {
+                    "description": "時間序列",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.SeriesPointResponse"
+                    }
+                },
+                "to": {
+                    "description": "統計結束時間",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.EndpointStatsResponse": {
+            "type": "object",
+            "properties": {
+                "client_error_rate": {
+                    "description": "4xx 比例",
+                    "type": "number"
+                },
+                "count": {
+                    "description": "請求數",
+                    "type": "integer"
+                },
+                "error_rate": {
+                    "description": "5xx 比例",
+                    "type": "number"
+                },
+                "max_ms": {
+                    "description": "最大耗時（毫秒）",
+                    "type": "number"
+                },
+                "method": {
+                    "description": "HTTP方法",
+                    "type": "string"
+                },
+                "p50_ms": {
+                    "description": "耗時中位數（毫秒）",
+                    "type": "number"
+                },
+                "p90_ms": {
+                    "description": "耗時 P90（毫秒）",
+                    "type": "number"
+                },
+                "p99_ms": {
+                    "description": "耗時 P99（毫秒）",
+                    "type": "number"
+                },
+                "route": {
+                    "description": "路由模板",
+                    "type": "string"
+                },
+                "slowest_request_ids": {
+                    "description": "最慢的請求ID",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
         "handler.Equipment": {
             "type": "object",
             "properties": {
@@ -810,6 +1727,76 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.LogQueueStatusResponse": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "description": "隊列容量",
+                    "type": "integer"
+                },
+                "depth": {
+                    "description": "隊列中的日志數",
+                    "type": "integer"
+                },
+                "dropped": {
+                    "description": "被丟棄的日志數",
+                    "type": "integer"
+                },
+                "enqueued": {
+                    "description": "進入隊列的日志數",
+                    "type": "integer"
+                },
+                "failed": {
+                    "description": "寫出失敗的日志數",
+                    "type": "integer"
+                },
+                "overflow": {
+                    "description": "隊列滿時的處理方式",
+                    "type": "string"
+                },
+                "spilled": {
+                    "description": "溢出到本地文件的日志數",
+                    "type": "integer"
+                },
+                "usage": {
+                    "description": "隊列使用率",
+                    "type": "number"
+                },
+                "written": {
+                    "description": "寫出成功的日志數",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.LoginRequest": {
+            "type": "object",
+            "required": [
+                "code"
+            ],
+            "properties": {
+                "code": {
+                    "description": "wx.login 返回的 code",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.LoginResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "過期時間",
+                    "type": "string"
+                },
+                "openid": {
+                    "description": "用戶 openid",
+                    "type": "string"
+                },
+                "token": {
+                    "description": "會話令牌，放在 Authorization: Bearer 中",
+                    "type": "string"
+                }
+            }
+        },
         "handler.PersonalTraits": {
             "type": "object",
             "properties": {
@@ -831,6 +1818,184 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.RequestLogDetailResponse": {
+            "type": "object",
+            "properties": {
+                "alloc_bytes": {
+                    "description": "採樣請求期間的堆分配（字節）",
+                    "type": "integer"
+                },
+                "body_truncated": {
+                    "description": "請求體或響應體是否被截斷",
+                    "type": "boolean"
+                },
+                "content_type": {
+                    "description": "請求類型",
+                    "type": "string"
+                },
+                "cpu_profile": {
+                    "description": "慢請求的 CPU profile 文件名",
+                    "type": "string"
+                },
+                "created_at": {
+                    "description": "請求時間",
+                    "type": "string"
+                },
+                "file_content_json": {
+                    "description": "上傳文件内容",
+                    "type": "object"
+                },
+                "file_name": {
+                    "description": "上傳文件名",
+                    "type": "string"
+                },
+                "file_size": {
+                    "description": "文件大小（字節）",
+                    "type": "integer"
+                },
+                "goroutines": {
+                    "description": "採樣請求結束時的 goroutine 數",
+                    "type": "integer"
+                },
+                "id": {
+                    "description": "日志ID",
+                    "type": "integer"
+                },
+                "method": {
+                    "description": "HTTP方法",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "請求路徑",
+                    "type": "string"
+                },
+                "query_string": {
+                    "description": "查詢參數",
+                    "type": "string"
+                },
+                "remote_ip": {
+                    "description": "客戶端IP",
+                    "type": "string"
+                },
+                "request_body": {
+                    "description": "請求體（已遮蔽敏感字段）",
+                    "type": "string"
+                },
+                "request_id": {
+                    "description": "請求唯一標識",
+                    "type": "string"
+                },
+                "request_redacted": {
+                    "description": "請求是否被遮蔽或改寫，和原請求不同",
+                    "type": "boolean"
+                },
+                "request_time": {
+                    "description": "請求耗時（秒）",
+                    "type": "number"
+                },
+                "response_body": {
+                    "description": "響應體（已遮蔽敏感字段）",
+                    "type": "string"
+                },
+                "route": {
+                    "description": "路由模板",
+                    "type": "string"
+                },
+                "status_code": {
+                    "description": "響應狀態碼",
+                    "type": "integer"
+                },
+                "user_agent": {
+                    "description": "用戶代理",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "請求用戶的引用，不是 openid 原文",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.RequestLogListResponse": {
+            "type": "object",
+            "properties": {
+                "list": {
+                    "description": "當前頁數據",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.RequestLogResponse"
+                    }
+                },
+                "next_cursor": {
+                    "description": "下一頁游標，為空表示沒有更多數據",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.RequestLogResponse": {
+            "type": "object",
+            "properties": {
+                "content_type": {
+                    "description": "請求類型",
+                    "type": "string"
+                },
+                "created_at": {
+                    "description": "請求時間",
+                    "type": "string"
+                },
+                "file_name": {
+                    "description": "上傳文件名",
+                    "type": "string"
+                },
+                "file_size": {
+                    "description": "文件大小（字節）",
+                    "type": "integer"
+                },
+                "id": {
+                    "description": "日志ID",
+                    "type": "integer"
+                },
+                "method": {
+                    "description": "HTTP方法",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "請求路徑",
+                    "type": "string"
+                },
+                "query_string": {
+                    "description": "查詢參數",
+                    "type": "string"
+                },
+                "remote_ip": {
+                    "description": "客戶端IP",
+                    "type": "string"
+                },
+                "request_id": {
+                    "description": "請求唯一標識",
+                    "type": "string"
+                },
+                "request_time": {
+                    "description": "請求耗時（秒）",
+                    "type": "number"
+                },
+                "route": {
+                    "description": "路由模板",
+                    "type": "string"
+                },
+                "status_code": {
+                    "description": "響應狀態碼",
+                    "type": "integer"
+                },
+                "user_agent": {
+                    "description": "用戶代理",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "請求用戶的引用，不是 openid 原文",
+                    "type": "string"
+                }
+            }
+        },
         "handler.RoleListResponse": {
             "type": "object",
             "properties": {
@@ -862,6 +2027,10 @@ const docTemplate = `{
                     "description": "角色描述",
                     "type": "string"
                 },
+                "id": {
+                    "description": "角色ID",
+                    "type": "integer"
+                },
                 "name": {
                     "description": "角色名称",
                     "type": "string"
@@ -880,6 +2049,79 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.RouteProfileResponse": {
+            "type": "object",
+            "properties": {
+                "avg_alloc_bytes": {
+                    "description": "平均堆分配（字節）",
+                    "type": "integer"
+                },
+                "avg_ms": {
+                    "description": "平均耗時（毫秒）",
+                    "type": "number"
+                },
+                "count": {
+                    "description": "採樣數",
+                    "type": "integer"
+                },
+                "cpu_profiles": {
+                    "description": "最近的 CPU profile 文件名",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "max_alloc_bytes": {
+                    "description": "最大堆分配（字節）",
+                    "type": "integer"
+                },
+                "max_goroutines": {
+                    "description": "最大 goroutine 數",
+                    "type": "integer"
+                },
+                "max_ms": {
+                    "description": "最大耗時（毫秒）",
+                    "type": "number"
+                },
+                "method": {
+                    "description": "HTTP方法",
+                    "type": "string"
+                },
+                "route": {
+                    "description": "路由模板",
+                    "type": "string"
+                },
+                "slowest_request_id": {
+                    "description": "最慢請求的ID",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.SeriesPointResponse": {
+            "type": "object",
+            "properties": {
+                "bucket_start": {
+                    "description": "時間桶開始時間",
+                    "type": "string"
+                },
+                "count": {
+                    "description": "請求數",
+                    "type": "integer"
+                },
+                "error_rate": {
+                    "description": "5xx 比例",
+                    "type": "number"
+                },
+                "p50_ms": {
+                    "description": "耗時中位數（毫秒）",
+                    "type": "number"
+                },
+                "p99_ms": {
+                    "description": "耗時 P99（毫秒）",
+                    "type": "number"
+                }
+            }
+        },
         "handler.Skill": {
             "type": "object",
             "properties": {
@@ -948,6 +2190,18 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.TransferRoleRequest": {
+            "type": "object",
+            "required": [
+                "to_wx_user_id"
+            ],
+            "properties": {
+                "to_wx_user_id": {
+                    "description": "接收角色的用户",
+                    "type": "string"
+                }
+            }
+        },
         "handler.UpdateBookRequest": {
             "type": "object",
             "properties": {
@@ -994,6 +2248,35 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.UserStatsResponse": {
+            "type": "object",
+            "properties": {
+                "active_roles": {
+                    "description": "未删除的角色数",
+                    "type": "integer"
+                },
+                "deleted_roles": {
+                    "description": "已删除的角色数",
+                    "type": "integer"
+                },
+                "last_updated_at": {
+                    "description": "最近一次角色更新时间",
+                    "type": "string"
+                },
+                "registered_at": {
+                    "description": "首次登录时间，未登录过为空",
+                    "type": "string"
+                },
+                "roles": {
+                    "description": "系统角色",
+                    "type": "string"
+                },
+                "wx_user_id": {
+                    "description": "用户ID",
+                    "type": "string"
+                }
+            }
+        },
         "handler.Wealth": {
             "type": "object",
             "properties": {
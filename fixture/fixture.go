@@ -0,0 +1,359 @@
+// Package fixture 角色的導出、導入文件格式和 role.json 格式的角色卡讀取
+//
+// 導出內容是一個 manifest.json 加上 roles/ 下每個角色一個 JSON 文件，
+// 可以寫成目錄，也可以寫成 .tar.gz/.tgz 或 .zip 壓縮包。
+package fixture
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"test-git/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FormatVersion = 1
+	manifestName  = "manifest.json"
+	rolesDir      = "roles"
+	// 單個文件的大小上限，防止讀取異常的壓縮包時耗盡內存
+	maxEntrySize = 16 << 20
+)
+
+// Manifest 導出文件的描述
+type Manifest struct {
+	Version    int       `json:"version"`
+	WxUserID   string    `json:"wx_user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+	Roles      int       `json:"roles"`
+}
+
+// RoleRecord 導出的角色，不包含 ID 和所有者，導入時由目標用戶重新創建
+type RoleRecord struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	AvatarURL   string          `json:"avatar_url"`
+	RoleData    json.RawMessage `json:"role_data"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeletedAt   *time.Time      `json:"deleted_at,omitempty"`
+}
+
+func FromRole(role model.Role) RoleRecord {
+	record := RoleRecord{
+		Name:        role.Name,
+		Description: role.Description,
+		AvatarURL:   role.AvatarUrl,
+		RoleData:    json.RawMessage(role.RoleData),
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}
+	if role.DeletedAt.Valid {
+		deletedAt := role.DeletedAt.Time
+		record.DeletedAt = &deletedAt
+	}
+	return record
+}
+
+func (r RoleRecord) Role() model.Role {
+	role := model.Role{
+		Name:        r.Name,
+		Description: r.Description,
+		AvatarUrl:   r.AvatarURL,
+		RoleData:    []byte(r.RoleData),
+	}
+	role.CreatedAt = r.CreatedAt
+	role.UpdatedAt = r.UpdatedAt
+	if r.DeletedAt != nil {
+		role.DeletedAt = gorm.DeletedAt{Time: *r.DeletedAt, Valid: true}
+	}
+	return role
+}
+
+// IsArchive 按擴展名判斷導出目標是壓縮包還是目錄
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".zip")
+}
+
+// Write 把導出內容寫到目錄或壓縮包，不覆蓋已有的導出
+func Write(dst string, manifest Manifest, records []RoleRecord) error {
+	manifest.Version = FormatVersion
+	manifest.Roles = len(records)
+	entries := make([]entry, 0, len(records)+1)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	entries = append(entries, entry{name: manifestName, data: data})
+	for i, record := range records {
+		data, err := json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{name: fmt.Sprintf("%s/%06d.json", rolesDir, i+1), data: data})
+	}
+
+	if !IsArchive(dst) {
+		return writeDir(dst, entries)
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(strings.ToLower(dst), ".zip") {
+		err = writeZip(f, entries)
+	} else {
+		err = writeTarGz(f, entries)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// Read 讀取 Write 寫出的目錄或壓縮包
+func Read(src string) (Manifest, []RoleRecord, error) {
+	var (
+		files map[string][]byte
+		err   error
+	)
+	lower := strings.ToLower(src)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		files, err = readZip(src)
+	case IsArchive(src):
+		files, err = readTarGz(src)
+	default:
+		files, err = readDir(os.DirFS(src))
+	}
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+
+	var manifest Manifest
+	data, ok := files[manifestName]
+	if !ok {
+		return Manifest{}, nil, fmt.Errorf("%s: %s not found", src, manifestName)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, nil, fmt.Errorf("%s: %v", manifestName, err)
+	}
+	if manifest.Version != FormatVersion {
+		return Manifest{}, nil, fmt.Errorf("unsupported export version %d", manifest.Version)
+	}
+
+	var names []string
+	for name := range files {
+		if path.Dir(name) == rolesDir && path.Ext(name) == ".json" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	records := make([]RoleRecord, 0, len(names))
+	for _, name := range names {
+		var record RoleRecord
+		if err := json.Unmarshal(files[name], &record); err != nil {
+			return Manifest{}, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if record.Name == "" || !json.Valid(record.RoleData) {
+			return Manifest{}, nil, fmt.Errorf("%s: name and role_data are required", name)
+		}
+		records = append(records, record)
+	}
+	if len(records) != manifest.Roles {
+		return Manifest{}, nil, fmt.Errorf("%s lists %d roles, found %d", manifestName, manifest.Roles, len(records))
+	}
+	return manifest, records, nil
+}
+
+// CardFile 一個 role.json 格式的角色卡文件
+type CardFile struct {
+	Path string
+	Data []byte
+}
+
+// ReadCardFiles 讀取角色卡文件，目錄展開為其中的 .json 文件，按路徑排序
+func ReadCardFiles(paths []string) ([]CardFile, error) {
+	var cards []CardFile
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{p}
+		if info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(p, "*.json")); err != nil {
+				return nil, err
+			}
+			sort.Strings(files)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			cards = append(cards, CardFile{Path: file, Data: data})
+		}
+	}
+	return cards, nil
+}
+
+type entry struct {
+	name string
+	data []byte
+}
+
+func writeDir(dir string, entries []entry) error {
+	if _, err := os.Stat(filepath.Join(dir, manifestName)); err == nil {
+		return fmt.Errorf("%s already contains an export", dir)
+	}
+	for _, e := range entries {
+		target := filepath.Join(dir, filepath.FromSlash(e.name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, e.data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTarGz(w io.Writer, entries []entry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeZip(w io.Writer, entries []entry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		fw, err := zw.Create(e.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func readDir(fsys fs.FS) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err := readLimited(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		files[name] = data
+		return nil
+	})
+	return files, err
+}
+
+func readTarGz(src string) (map[string][]byte, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := readLimited(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+		files[path.Clean(hdr.Name)] = data
+	}
+}
+
+func readZip(src string) (map[string][]byte, error) {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	files := make(map[string][]byte)
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := readLimited(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", zf.Name, err)
+		}
+		files[path.Clean(zf.Name)] = data
+	}
+	return files, nil
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, maxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > maxEntrySize {
+		return nil, fmt.Errorf("larger than %d bytes", maxEntrySize)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"test-git/common"
+	"test-git/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AdminListRolesHandler 跨用户查询角色接口
+//
+//	@Summary		跨用户查询角色
+//	@Description	按用户、关键字查询所有用户的角色，可包含已删除的角色
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Param			wx_user_id		query		string	false	"所属用户"
+//	@Param			keyword			query		string	false	"角色名称或描述关键字"
+//	@Param			deleted			query		string	false	"include 包含已删除，only 只查已删除"
+//	@Param			page			query		int		false	"页码（默认1）"
+//	@Param			pageSize		query		int		false	"每页条数（默认10）"
+//	@Success		200				{object}	AdminRoleListResponse
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Failure		500				{string}	string	"服务器内部错误"
+//	@Router			/admin/roles [get]
+func AdminListRolesHandler(adminService *service.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+		filter := service.AdminRoleFilter{
+			WxUserID: c.Query("wx_user_id"),
+			Keyword:  c.Query("keyword"),
+			Deleted:  c.Query("deleted"),
+		}
+
+		roles, total, err := adminService.SearchRoles(c.Request.Context(), adminActor(c), filter, page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "查询列表失败："+err.Error()))
+			return
+		}
+
+		respList := make([]AdminRoleResponse, 0, len(roles))
+		for _, role := range roles {
+			respList = append(respList, toAdminRoleResponse(role))
+		}
+		c.JSON(http.StatusOK, AdminRoleListResponse{Total: int(total), List: respList})
+	}
+}
+
+// AdminTransferRoleHandler 转移角色接口
+//
+//	@Summary		转移角色
+//	@Description	把角色转给另一个用户
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string				true	"管理员凭证"
+//	@Param			id				path		int					true	"角色ID"
+//	@Param			transfer		body		TransferRoleRequest	true	"接收角色的用户"
+//	@Success		200				{object}	AdminRoleResponse
+//	@Failure		400				{string}	string	"请求参数错误或ID格式错误"
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Failure		404				{string}	string	"角色不存在"
+//	@Failure		500				{string}	string	"服务器内部错误"
+//	@Router			/admin/roles/{id}/transfer [post]
+func AdminTransferRoleHandler(adminService *service.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
+
+		var req TransferRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "请求参数错误："+err.Error()))
+			return
+		}
+
+		role, err := adminService.TransferRole(c.Request.Context(), adminActor(c), uint(id), req.ToWxUserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, common.ErrorBody(c, "角色不存在"))
+			} else {
+				c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "转移失败："+err.Error()))
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, toAdminRoleResponse(*role))
+	}
+}
+
+// AdminRestoreRoleHandler 恢复角色接口
+//
+//	@Summary		恢复已删除的角色
+//	@Description	撤销角色的软删除
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Param			id				path		int		true	"角色ID"
+//	@Success		200				{object}	AdminRoleResponse
+//	@Failure		400				{string}	string	"ID格式错误"
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Failure		404				{string}	string	"角色不存在"
+//	@Failure		409				{string}	string	"角色未被删除"
+//	@Failure		500				{string}	string	"服务器内部错误"
+//	@Router			/admin/roles/{id}/restore [post]
+func AdminRestoreRoleHandler(adminService *service.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
+
+		role, err := adminService.RestoreRole(c.Request.Context(), adminActor(c), uint(id))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, common.ErrorBody(c, "角色不存在"))
+			} else if errors.Is(err, service.ErrRoleNotDeleted) {
+				c.JSON(http.StatusConflict, common.ErrorBody(c, err.Error()))
+			} else {
+				c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "恢复失败："+err.Error()))
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, toAdminRoleResponse(*role))
+	}
+}
+
+// AdminUserStatsHandler 用户统计接口
+//
+//	@Summary		查询用户统计
+//	@Description	查询单个用户的角色数量和活跃时间
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Param			wx_user_id		path		string	true	"用户ID"
+//	@Success		200				{object}	UserStatsResponse
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Failure		500				{string}	string	"服务器内部错误"
+//	@Router			/admin/users/{wx_user_id}/stats [get]
+func AdminUserStatsHandler(adminService *service.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := adminService.GetUserStats(c.Request.Context(), adminActor(c), c.Param("wx_user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "查询失败："+err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, UserStatsResponse{
+			WxUserID:      stats.WxUserID,
+			Roles:         stats.Roles,
+			RegisteredAt:  formatOptionalTime(stats.RegisteredAt),
+			ActiveRoles:   stats.ActiveRoles,
+			DeletedRoles:  stats.DeletedRoles,
+			LastUpdatedAt: formatOptionalTime(stats.LastUpdatedAt),
+		})
+	}
+}
+
+func adminActor(c *gin.Context) service.AdminActor {
+	return service.AdminActor{
+		Name:     common.GetAdminActor(c),
+		RemoteIP: c.ClientIP(),
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"test-git/common"
+	"test-git/service"
+	"test-git/wechat"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginHandler 小程序登錄接口
+//
+//	@Summary		小程序登錄
+//	@Description	用 wx.login 返回的 code 換取服務端簽發的會話令牌
+//	@Accept			json
+//	@Produce		json
+//	@Param			login	body		LoginRequest	true	"登錄信息"
+//	@Success		200		{object}	LoginResponse
+//	@Failure		400		{string}	string	"请求参数错误"
+//	@Failure		401		{string}	string	"code 無效"
+//	@Failure		500		{string}	string	"服务器内部错误"
+//	@Failure		502		{string}	string	"微信服务异常"
+//	@Router			/auth/login [post]
+func LoginHandler(client wechat.Code2SessionClient, signer *common.SessionSigner, users *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "请求参数错误："+err.Error()))
+			return
+		}
+
+		session, err := client.Code2Session(c.Request.Context(), req.Code)
+		if err != nil {
+			if errors.Is(err, wechat.ErrInvalidCode) {
+				c.JSON(http.StatusUnauthorized, common.ErrorBody(c, "登錄失敗："+err.Error()))
+			} else {
+				c.JSON(http.StatusBadGateway, common.ErrorBody(c, "微信服务异常："+err.Error()))
+			}
+			return
+		}
+
+		if _, err := users.EnsureUser(c.Request.Context(), session.OpenID); err != nil {
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "创建用户失败："+err.Error()))
+			return
+		}
+
+		token, expiresAt, err := signer.Issue(common.SessionClaims{
+			OpenID:  session.OpenID,
+			UnionID: session.UnionID,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "签发令牌失败："+err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, LoginResponse{
+			Token:     token,
+			ExpiresAt: expiresAt.Format("2006-01-02 15:04:05"),
+			OpenID:    session.OpenID,
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"test-git/common"
 	"test-git/model"
+	"test-git/policy"
 	"test-git/service"
 
 	"github.com/gin-gonic/gin"
@@ -19,29 +22,36 @@ import (
 //	@Param			book	body		CreateBookRequest	true	"书籍信息"
 //	@Success		201		{object}	BookResponse
 //	@Failure		400		{string}	string	"请求参数错误"
+//	@Failure		403		{string}	string	"无权限"
 //	@Failure		500		{string}	string	"服务器内部错误"
 //	@Router			/books [post]
-func CreateBookHandler(c *gin.Context) {
-	var req CreateBookRequest
+func CreateBookHandler(bookService *service.BookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateBookRequest
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误：" + err.Error()})
-		return
-	}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "请求参数错误："+err.Error()))
+			return
+		}
 
-	book := &model.Book{
-		Title:       req.Title,
-		Author:      req.Author,
-		Price:       req.Price,
-		Description: req.Description,
-	}
+		book := &model.Book{
+			Title:       req.Title,
+			Author:      req.Author,
+			Price:       req.Price,
+			Description: req.Description,
+		}
 
-	if err := service.CreateBook(book); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建书籍失败：" + err.Error()})
-		return
-	}
+		if err := bookService.CreateBook(c.Request.Context(), book, common.GetSubject(c)); err != nil {
+			if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限创建书籍"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "创建书籍失败："+err.Error()))
+			return
+		}
 
-	c.JSON(http.StatusCreated, toBookResponse(*book))
+		c.JSON(http.StatusCreated, toBookResponse(*book))
+	}
 }
 
 // GetBookHandler 根据ID查询书籍接口
@@ -53,28 +63,32 @@ func CreateBookHandler(c *gin.Context) {
 //	@Success		200	{object}	BookResponse
 //	@Failure		400	{string}	string	"ID格式错误"
 //	@Failure		404	{string}	string	"书籍不存在"
+//	@Failure		403	{string}	string	"无权限"
 //	@Failure		500	{string}	string	"服务器内部错误"
 //	@Router			/books/{id} [get]
-func GetBookHandler(c *gin.Context) {
-
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
-		return
-	}
+func GetBookHandler(bookService *service.BookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
 
-	book, err := service.GetBookByID(uint(id))
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "书籍不存在"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败：" + err.Error()})
+		book, err := bookService.GetBookByID(c.Request.Context(), uint(id), common.GetSubject(c))
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, common.ErrorBody(c, "书籍不存在"))
+			} else if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限查看书籍"))
+			} else {
+				c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "查询失败："+err.Error()))
+			}
+			return
 		}
-		return
-	}
 
-	c.JSON(http.StatusOK, toBookResponse(*book))
+		c.JSON(http.StatusOK, toBookResponse(*book))
+	}
 }
 
 // ListBooksHandler 查询书籍列表接口（支持分页）
@@ -85,28 +99,35 @@ func GetBookHandler(c *gin.Context) {
 //	@Param			page		query		int	false	"页码（默认1）"
 //	@Param			pageSize	query		int	false	"每页条数（默认10）"
 //	@Success		200			{object}	BookListResponse
+//	@Failure		403			{string}	string	"无权限"
 //	@Failure		500			{string}	string	"服务器内部错误"
 //	@Router			/books [get]
-func ListBooksHandler(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
-
-	books, total, err := service.GetAllBooks(page, pageSize)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询列表失败：" + err.Error()})
-		return
-	}
+func ListBooksHandler(bookService *service.BookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+		books, total, err := bookService.GetAllBooks(c.Request.Context(), common.GetSubject(c), page, pageSize)
+		if err != nil {
+			if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限查看书籍"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "查询列表失败："+err.Error()))
+			return
+		}
 
-	var respList []BookResponse
-	for _, book := range books {
-		respList = append(respList, toBookResponse(book))
-	}
+		var respList []BookResponse
+		for _, book := range books {
+			respList = append(respList, toBookResponse(book))
+		}
 
-	resp := BookListResponse{
-		Total: int(total),
-		List:  respList,
+		resp := BookListResponse{
+			Total: int(total),
+			List:  respList,
+		}
+		c.JSON(http.StatusOK, resp)
 	}
-	c.JSON(http.StatusOK, resp)
 }
 
 // UpdateBookHandler 更新书籍接口
@@ -120,40 +141,45 @@ func ListBooksHandler(c *gin.Context) {
 //	@Success		204		{string}	string				"更新成功"
 //	@Failure		400		{string}	string				"请求参数错误或ID格式错误"
 //	@Failure		404		{string}	string				"书籍不存在"
+//	@Failure		403		{string}	string				"无权限"
 //	@Failure		500		{string}	string				"服务器内部错误"
 //	@Router			/books/{id} [put]
-func UpdateBookHandler(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
-		return
-	}
+func UpdateBookHandler(bookService *service.BookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
 
-	var req UpdateBookRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误：" + err.Error()})
-		return
-	}
+		var req UpdateBookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "请求参数错误："+err.Error()))
+			return
+		}
 
-	updatedBook := &model.Book{
-		Title:       req.Title,
-		Author:      req.Author,
-		Price:       req.Price,
-		Description: req.Description,
-	}
+		updatedBook := &model.Book{
+			Title:       req.Title,
+			Author:      req.Author,
+			Price:       req.Price,
+			Description: req.Description,
+		}
 
-	if err := service.UpdateBook(uint(id), updatedBook); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "書籍記錄不存在:" + err.Error()})
+		if err := bookService.UpdateBook(c.Request.Context(), uint(id), updatedBook, common.GetSubject(c)); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, common.ErrorBody(c, "書籍記錄不存在:"+err.Error()))
+				return
+			} else if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限修改书籍"))
+			} else {
+				c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "更新失败："+err.Error()))
+			}
 			return
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败：" + err.Error()})
 		}
-		return
-	}
 
-	c.JSON(http.StatusNoContent, gin.H{"message": "更新成功"})
+		c.JSON(http.StatusNoContent, gin.H{"message": "更新成功"})
+	}
 }
 
 // DeleteBookHandler 删除书籍接口
@@ -165,20 +191,27 @@ func UpdateBookHandler(c *gin.Context) {
 //	@Success		204	{string}	string	"删除成功"
 //	@Failure		400	{string}	string	"ID格式错误"
 //	@Failure		404	{string}	string	"书籍不存在"
+//	@Failure		403	{string}	string	"无权限"
 //	@Failure		500	{string}	string	"服务器内部错误"
 //	@Router			/books/{id} [delete]
-func DeleteBookHandler(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
-		return
-	}
+func DeleteBookHandler(bookService *service.BookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
 
-	if err := service.DeleteBook(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败：" + err.Error()})
-		return
-	}
+		if err := bookService.DeleteBook(c.Request.Context(), uint(id), common.GetSubject(c)); err != nil {
+			if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限删除书籍"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "删除失败："+err.Error()))
+			return
+		}
 
-	c.JSON(http.StatusNoContent, gin.H{"message": "删除成功"})
+		c.JSON(http.StatusNoContent, gin.H{"message": "删除成功"})
+	}
 }
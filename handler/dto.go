@@ -2,8 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"strconv"
+	"test-git/common"
 	"test-git/model"
+	"test-git/service"
+	"time"
 )
 
 // CreateBookRequest 创建书籍的请求体
@@ -76,6 +80,7 @@ type RolePreviewResponse struct {
 }
 
 type RoleResponse struct {
+	ID          uint         `json:"id"`          // 角色ID
 	Name        string       `json:"name"`        // 角色名称
 	Description string       `json:"description"` // 角色描述
 	AvatarURL   string       `json:"avatar_url"`  // 头像URL
@@ -86,6 +91,7 @@ type RoleResponse struct {
 
 func toRoleResponse(role model.Role, withDetail bool) RoleResponse {
 	resp := RoleResponse{
+		ID:          role.ID,
 		Name:        role.Name,
 		Description: role.Description,
 		AvatarURL:   role.AvatarUrl,
@@ -100,6 +106,35 @@ func toRoleResponse(role model.Role, withDetail bool) RoleResponse {
 	return resp
 }
 
+// newRoleFromCard 按角色卡生成角色，avatarURL 不為空時覆蓋角色卡裡的頭像
+func newRoleFromCard(card COCRoleCard, avatarURL string) (*model.Role, error) {
+	if avatarURL != "" {
+		card.BasicInfo.AvatarURL = avatarURL
+	}
+	roleJSON, err := json.Marshal(&card)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Role{
+		Name:        card.BasicInfo.RoleName,
+		AvatarUrl:   avatarURL,
+		Description: getRoleDesc(&card),
+		RoleData:    roleJSON,
+	}, nil
+}
+
+// RoleFromCardJSON 把 role.json 格式的角色卡轉成角色，用於命令行導入
+func RoleFromCardJSON(data []byte) (*model.Role, error) {
+	var card COCRoleCard
+	if err := json.Unmarshal(data, &card); err != nil {
+		return nil, err
+	}
+	if card.BasicInfo.RoleName == "" {
+		return nil, errors.New("basic_info.name is required")
+	}
+	return newRoleFromCard(card, card.BasicInfo.AvatarURL)
+}
+
 func getRoleDesc(r *COCRoleCard) string {
 	return strconv.Itoa(r.BasicInfo.Age) + "岁" + r.BasicInfo.Race + r.BasicInfo.Gender + "，职业是" + r.BasicInfo.Occupation
 }
@@ -202,3 +237,248 @@ type Status struct {
 	IsInsane   bool   `json:"isInsane"`   // 是否疯狂
 	Remark     string `json:"remark"`     // 备注
 }
+
+type LoginRequest struct {
+	Code string `json:"code" binding:"required"` // wx.login 返回的 code
+}
+
+type LoginResponse struct {
+	Token     string `json:"token"`      // 會話令牌，放在 Authorization: Bearer 中
+	ExpiresAt string `json:"expires_at"` // 過期時間
+	OpenID    string `json:"openid"`     // 用戶 openid
+}
+
+type AdminRoleResponse struct {
+	ID          uint   `json:"id"`          // 角色ID
+	WxUserID    string `json:"wx_user_id"`  // 所屬用戶
+	Name        string `json:"name"`        // 角色名称
+	Description string `json:"description"` // 角色描述
+	AvatarURL   string `json:"avatar_url"`  // 头像URL
+	CreatedAt   string `json:"created_at"`  // 创建时间
+	UpdatedAt   string `json:"updated_at"`  // 更新时间
+	DeletedAt   string `json:"deleted_at"`  // 删除时间，未删除为空
+}
+
+type AdminRoleListResponse struct {
+	Total int                 `json:"total"` // 总条数
+	List  []AdminRoleResponse `json:"list"`  // 分页数据列表
+}
+
+type TransferRoleRequest struct {
+	ToWxUserID string `json:"to_wx_user_id" binding:"required"` // 接收角色的用户
+}
+
+type UserStatsResponse struct {
+	WxUserID      string `json:"wx_user_id"`      // 用户ID
+	Roles         string `json:"roles"`           // 系统角色
+	RegisteredAt  string `json:"registered_at"`   // 首次登录时间，未登录过为空
+	ActiveRoles   int64  `json:"active_roles"`    // 未删除的角色数
+	DeletedRoles  int64  `json:"deleted_roles"`   // 已删除的角色数
+	LastUpdatedAt string `json:"last_updated_at"` // 最近一次角色更新时间
+}
+
+func toAdminRoleResponse(role model.Role) AdminRoleResponse {
+	resp := AdminRoleResponse{
+		ID:          role.ID,
+		WxUserID:    role.WxUserId,
+		Name:        role.Name,
+		Description: role.Description,
+		AvatarURL:   role.AvatarUrl,
+		CreatedAt:   role.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:   role.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if role.DeletedAt.Valid {
+		resp.DeletedAt = role.DeletedAt.Time.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+type RequestLogResponse struct {
+	ID          uint64  `json:"id"`           // 日志ID
+	RequestID   string  `json:"request_id"`   // 請求唯一標識
+	Method      string  `json:"method"`       // HTTP方法
+	Path        string  `json:"path"`         // 請求路徑
+	Route       string  `json:"route"`        // 路由模板
+	QueryString string  `json:"query_string"` // 查詢參數
+	StatusCode  int     `json:"status_code"`  // 響應狀態碼
+	RemoteIP    string  `json:"remote_ip"`    // 客戶端IP
+	UserID      string  `json:"user_id"`      // 請求用戶的引用，不是 openid 原文
+	UserAgent   string  `json:"user_agent"`   // 用戶代理
+	RequestTime float64 `json:"request_time"` // 請求耗時（秒）
+	CreatedAt   string  `json:"created_at"`   // 請求時間
+	FileName    string  `json:"file_name"`    // 上傳文件名
+	FileSize    int64   `json:"file_size"`    // 文件大小（字節）
+	ContentType string  `json:"content_type"` // 請求類型
+}
+
+type RequestLogListResponse struct {
+	List       []RequestLogResponse `json:"list"`        // 當前頁數據
+	NextCursor string               `json:"next_cursor"` // 下一頁游標，為空表示沒有更多數據
+}
+
+type RequestLogDetailResponse struct {
+	RequestLogResponse
+	FileContentJSON json.RawMessage `json:"file_content_json" swaggertype:"object"` // 上傳文件内容
+	RequestBody     string          `json:"request_body"`                           // 請求體（已遮蔽敏感字段）
+	ResponseBody    string          `json:"response_body"`                          // 響應體（已遮蔽敏感字段）
+	BodyTruncated   bool            `json:"body_truncated"`                         // 請求體或響應體是否被截斷
+	RequestRedacted bool            `json:"request_redacted"`                       // 請求是否被遮蔽或改寫，和原請求不同
+	AllocBytes      int64           `json:"alloc_bytes"`                            // 採樣請求期間的堆分配（字節）
+	Goroutines      int             `json:"goroutines"`                             // 採樣請求結束時的 goroutine 數
+	CPUProfile      string          `json:"cpu_profile"`                            // 慢請求的 CPU profile 文件名
+}
+
+func toRequestLogResponse(reqLog model.RequestLog) RequestLogResponse {
+	return RequestLogResponse{
+		ID:          reqLog.ID,
+		RequestID:   reqLog.RequestID,
+		Method:      reqLog.Method,
+		Path:        reqLog.Path,
+		Route:       reqLog.Route,
+		QueryString: reqLog.QueryString,
+		StatusCode:  reqLog.StatusCode,
+		RemoteIP:    reqLog.RemoteIP,
+		UserID:      reqLog.UserID,
+		UserAgent:   reqLog.UserAgent,
+		RequestTime: reqLog.RequestTime,
+		CreatedAt:   reqLog.CreatedAt.Format(time.RFC3339Nano),
+		FileName:    reqLog.FileName,
+		FileSize:    reqLog.FileSize,
+		ContentType: reqLog.ContentType,
+	}
+}
+
+type EndpointStatsResponse struct {
+	Method            string   `json:"method"`              // HTTP方法
+	Route             string   `json:"route"`               // 路由模板
+	Count             int64    `json:"count"`               // 請求數
+	ErrorRate         float64  `json:"error_rate"`          // 5xx 比例
+	ClientErrorRate   float64  `json:"client_error_rate"`   // 4xx 比例
+	P50Ms             float64  `json:"p50_ms"`              // 耗時中位數（毫秒）
+	P90Ms             float64  `json:"p90_ms"`              // 耗時 P90（毫秒）
+	P99Ms             float64  `json:"p99_ms"`              // 耗時 P99（毫秒）
+	MaxMs             float64  `json:"max_ms"`              // 最大耗時（毫秒）
+	SlowestRequestIDs []string `json:"slowest_request_ids"` // 最慢的請求ID
+}
+
+type SeriesPointResponse struct {
+	BucketStart string  `json:"bucket_start"` // 時間桶開始時間
+	Count       int64   `json:"count"`        // 請求數
+	ErrorRate   float64 `json:"error_rate"`   // 5xx 比例
+	P50Ms       float64 `json:"p50_ms"`       // 耗時中位數（毫秒）
+	P99Ms       float64 `json:"p99_ms"`       // 耗時 P99（毫秒）
+}
+
+type EndpointReportResponse struct {
+	From          string                  `json:"from"`           // 統計開始時間
+	To            string                  `json:"to"`             // 統計結束時間
+	BucketSeconds int64                   `json:"bucket_seconds"` // 時間桶大小（秒）
+	Endpoints     []EndpointStatsResponse `json:"endpoints"`      // 按請求數倒序的接口統計
+	Series        []SeriesPointResponse   `json:"series"`         // 時間序列
+}
+
+func toEndpointReportResponse(query service.EndpointReportQuery, report *service.EndpointReport) EndpointReportResponse {
+	resp := EndpointReportResponse{
+		From:          query.From.Format(time.RFC3339),
+		To:            query.To.Format(time.RFC3339),
+		BucketSeconds: int64(query.Bucket.Seconds()),
+		Endpoints:     make([]EndpointStatsResponse, 0, len(report.Endpoints)),
+		Series:        make([]SeriesPointResponse, 0, len(report.Series)),
+	}
+	for _, e := range report.Endpoints {
+		resp.Endpoints = append(resp.Endpoints, EndpointStatsResponse{
+			Method:            e.Method,
+			Route:             e.Route,
+			Count:             e.Count,
+			ErrorRate:         ratio(e.ServerErrors, e.Count),
+			ClientErrorRate:   ratio(e.ClientErrors, e.Count),
+			P50Ms:             e.P50 * 1000,
+			P90Ms:             e.P90 * 1000,
+			P99Ms:             e.P99 * 1000,
+			MaxMs:             e.Max * 1000,
+			SlowestRequestIDs: e.SlowestRequestIDs(),
+		})
+	}
+	for _, p := range report.Series {
+		resp.Series = append(resp.Series, SeriesPointResponse{
+			BucketStart: p.BucketStart.Format(time.RFC3339),
+			Count:       p.Count,
+			ErrorRate:   ratio(p.ServerErrors, p.Count),
+			P50Ms:       p.P50 * 1000,
+			P99Ms:       p.P99 * 1000,
+		})
+	}
+	return resp
+}
+
+func ratio(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+type LogQueueStatusResponse struct {
+	Overflow string  `json:"overflow"` // 隊列滿時的處理方式
+	Depth    int     `json:"depth"`    // 隊列中的日志數
+	Capacity int     `json:"capacity"` // 隊列容量
+	Usage    float64 `json:"usage"`    // 隊列使用率
+	Enqueued int64   `json:"enqueued"` // 進入隊列的日志數
+	Dropped  int64   `json:"dropped"`  // 被丟棄的日志數
+	Spilled  int64   `json:"spilled"`  // 溢出到本地文件的日志數
+	Written  int64   `json:"written"`  // 寫出成功的日志數
+	Failed   int64   `json:"failed"`   // 寫出失敗的日志數
+}
+
+func toLogQueueStatusResponse(stats common.LogQueueStats) LogQueueStatusResponse {
+	return LogQueueStatusResponse{
+		Overflow: stats.Overflow,
+		Depth:    stats.Depth,
+		Capacity: stats.Capacity,
+		Usage:    ratio(int64(stats.Depth), int64(stats.Capacity)),
+		Enqueued: stats.Enqueued,
+		Dropped:  stats.Dropped,
+		Spilled:  stats.Spilled,
+		Written:  stats.Written,
+		Failed:   stats.Failed,
+	}
+}
+
+type RouteProfileResponse struct {
+	Method        string   `json:"method"`             // HTTP方法
+	Route         string   `json:"route"`              // 路由模板
+	Count         int      `json:"count"`              // 採樣數
+	AvgMs         float64  `json:"avg_ms"`             // 平均耗時（毫秒）
+	MaxMs         float64  `json:"max_ms"`             // 最大耗時（毫秒）
+	AvgAllocBytes int64    `json:"avg_alloc_bytes"`    // 平均堆分配（字節）
+	MaxAllocBytes int64    `json:"max_alloc_bytes"`    // 最大堆分配（字節）
+	MaxGoroutines int      `json:"max_goroutines"`     // 最大 goroutine 數
+	SlowestID     string   `json:"slowest_request_id"` // 最慢請求的ID
+	CPUProfiles   []string `json:"cpu_profiles"`       // 最近的 CPU profile 文件名
+}
+
+func toRouteProfileResponse(p common.RouteProfile) RouteProfileResponse {
+	profiles := p.CPUProfiles
+	if profiles == nil {
+		profiles = []string{}
+	}
+	return RouteProfileResponse{
+		Method:        p.Method,
+		Route:         p.Route,
+		Count:         p.Count,
+		AvgMs:         float64(p.AvgDuration.Microseconds()) / 1000,
+		MaxMs:         float64(p.MaxDuration.Microseconds()) / 1000,
+		AvgAllocBytes: p.AvgAllocBytes,
+		MaxAllocBytes: p.MaxAllocBytes,
+		MaxGoroutines: p.MaxGoroutines,
+		SlowestID:     p.SlowestID,
+		CPUProfiles:   profiles,
+	}
+}
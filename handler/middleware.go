@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+	"test-git/common"
+	"test-git/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubjectMiddleware 加載當前用戶的角色授權，需放在 SessionMiddleware 之後
+func SubjectMiddleware(users *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject, err := users.GetSubject(c.Request.Context(), common.GetUserID(c))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, common.ErrorBody(c, "加载用户权限失败："+err.Error()))
+			return
+		}
+		common.SetSubject(c, subject)
+		c.Next()
+	}
+}
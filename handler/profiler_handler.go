@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"test-git/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminProfilerTopHandler 最耗资源的路由
+//
+//	@Summary		最耗资源的路由
+//	@Description	按最近采样请求的平均耗时或平均内存分配排序，返回前 N 个路由及其慢请求的 CPU profile
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Param			n				query		int		false	"返回的路由数（默认10）"
+//	@Param			by				query		string	false	"排序方式：duration（默认）或 alloc"
+//	@Success		200				{array}		RouteProfileResponse
+//	@Failure		400				{string}	string	"请求参数错误"
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Router			/admin/debug/profiler [get]
+func AdminProfilerTopHandler(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", "10"))
+	if err != nil || n < 1 {
+		c.JSON(http.StatusBadRequest, common.ErrorBody(c, "n 必须是正整数"))
+		return
+	}
+	by := c.DefaultQuery("by", common.ProfileByDuration)
+	if by != common.ProfileByDuration && by != common.ProfileByAlloc {
+		c.JSON(http.StatusBadRequest, common.ErrorBody(c, "by 只能是 duration 或 alloc"))
+		return
+	}
+
+	resp := []RouteProfileResponse{}
+	for _, p := range common.TopRouteProfiles(n, by) {
+		resp = append(resp, toRouteProfileResponse(p))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AdminCPUProfileHandler 下载慢请求的 CPU profile
+//
+//	@Summary		下载 CPU profile
+//	@Description	下载慢请求触发的 CPU profile，可用 go tool pprof 分析，按 request_id 标签过滤
+//	@Produce		octet-stream
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Param			name			path		string	true	"profile 文件名"
+//	@Success		200				{file}		binary
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Failure		404				{string}	string	"profile 不存在"
+//	@Router			/admin/debug/profiler/profiles/{name} [get]
+func AdminCPUProfileHandler(c *gin.Context) {
+	path, ok := common.CPUProfilePath(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, common.ErrorBody(c, "profile 不存在"))
+		return
+	}
+	c.FileAttachment(path, c.Param("name"))
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"test-git/common"
+	"test-git/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 一個報表最多的時間桶數，避免窗口很大、分桶很小時返回過多數據
+	maxReportBuckets = 1000
+	// 返回的接口數，和請求日志列表一樣由 parseLimit 校驗
+	defaultReportLimit = 50
+	maxReportLimit     = 200
+)
+
+// AdminEndpointReportHandler 接口耗时和错误率报表
+//
+//	@Summary		接口耗时和错误率报表
+//	@Description	按 method+路由模板汇总请求日志：请求数、错误率、P50/P90/P99 耗时和最慢请求，并按时间分桶
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Param			from			query		string	false	"开始时间（RFC3339，默认1小时前）"
+//	@Param			to				query		string	false	"结束时间（RFC3339，默认现在）"
+//	@Param			bucket			query		string	false	"时间桶大小，如 1m、5m（默认窗口的1/60）"
+//	@Param			method			query		string	false	"只统计该方法的时间序列"
+//	@Param			route			query		string	false	"只统计该路由的时间序列"
+//	@Param			limit			query		int		false	"返回的接口数（默认50，最大200）"
+//	@Success		200				{object}	EndpointReportResponse
+//	@Failure		400				{string}	string	"请求参数错误"
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Failure		503				{string}	string	"请求日志库不可用"
+//	@Failure		500				{string}	string	"服务器内部错误"
+//	@Router			/admin/reports/endpoints [get]
+func AdminEndpointReportHandler(logService *service.RequestLogService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		query := service.EndpointReportQuery{
+			From:   now.Add(-time.Hour),
+			To:     now,
+			Method: c.Query("method"),
+			Route:  c.Query("route"),
+		}
+
+		var err error
+		if v := c.Query("from"); v != "" {
+			if query.From, err = time.Parse(time.RFC3339, v); err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorBody(c, "from 不是 RFC3339 时间"))
+				return
+			}
+		}
+		if v := c.Query("to"); v != "" {
+			if query.To, err = time.Parse(time.RFC3339, v); err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorBody(c, "to 不是 RFC3339 时间"))
+				return
+			}
+		}
+		window := query.To.Sub(query.From)
+		if window <= 0 {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "from 必须早于 to"))
+			return
+		}
+
+		query.Bucket = (window / 60).Truncate(time.Second)
+		if v := c.Query("bucket"); v != "" {
+			if query.Bucket, err = time.ParseDuration(v); err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorBody(c, "bucket 格式错误"))
+				return
+			}
+		}
+		if query.Bucket < time.Second {
+			query.Bucket = time.Second
+		}
+		if window/query.Bucket > maxReportBuckets {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "时间桶过多，请增大 bucket"))
+			return
+		}
+
+		if query.Limit, err = parseLimit(c, defaultReportLimit, maxReportLimit); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, err.Error()))
+			return
+		}
+
+		report, err := logService.GetEndpointReport(c.Request.Context(), adminActor(c), query)
+		if err != nil {
+			writeRequestLogError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, toEndpointReportResponse(query, report))
+	}
+}
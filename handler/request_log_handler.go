@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"test-git/common"
+	"test-git/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRequestLogLimit = 50
+	maxRequestLogLimit     = 200
+)
+
+// AdminListRequestLogsHandler 查询请求日志接口
+//
+//	@Summary		查询请求日志
+//	@Description	按条件查询请求日志，按时间倒序游标分页，不返回文件内容
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Param			from			query		string	false	"开始时间（RFC3339，包含）"
+//	@Param			to				query		string	false	"结束时间（RFC3339，不包含）"
+//	@Param			path			query		string	false	"请求路径，以 * 结尾表示前缀匹配"
+//	@Param			method			query		string	false	"HTTP方法"
+//	@Param			status_min		query		int		false	"最小状态码"
+//	@Param			status_max		query		int		false	"最大状态码"
+//	@Param			remote_ip		query		string	false	"客户端IP"
+//	@Param			request_id		query		string	false	"请求ID"
+//	@Param			service_name	query		string	false	"服务名"
+//	@Param			content_type	query		string	false	"请求的 Content-Type，如 multipart/form-data"
+//	@Param			min_latency_ms	query		number	false	"最小耗时（毫秒）"
+//	@Param			cursor			query		string	false	"上一页返回的 next_cursor"
+//	@Param			limit			query		int		false	"每页条数（默认50，最大200）"
+//	@Success		200				{object}	RequestLogListResponse
+//	@Failure		400				{string}	string	"请求参数错误"
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Failure		503				{string}	string	"请求日志库不可用"
+//	@Failure		500				{string}	string	"服务器内部错误"
+//	@Router			/admin/request-logs [get]
+func AdminListRequestLogsHandler(logService *service.RequestLogService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseRequestLogFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "请求参数错误："+err.Error()))
+			return
+		}
+
+		limit, err := parseLimit(c, defaultRequestLogLimit, maxRequestLogLimit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, err.Error()))
+			return
+		}
+
+		logs, next, err := logService.ListRequestLogs(c.Request.Context(), adminActor(c), filter, c.Query("cursor"), limit)
+		if err != nil {
+			writeRequestLogError(c, err)
+			return
+		}
+
+		respList := make([]RequestLogResponse, 0, len(logs))
+		for _, reqLog := range logs {
+			respList = append(respList, toRequestLogResponse(reqLog))
+		}
+		c.JSON(http.StatusOK, RequestLogListResponse{List: respList, NextCursor: next})
+	}
+}
+
+// AdminGetRequestLogHandler 查询请求日志详情接口
+//
+//	@Summary		查询请求日志详情
+//	@Description	根据ID查询请求日志，包含保存的文件内容
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Param			id				path		int		true	"日志ID"
+//	@Success		200				{object}	RequestLogDetailResponse
+//	@Failure		400				{string}	string	"ID格式错误"
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Failure		404				{string}	string	"日志不存在"
+//	@Failure		503				{string}	string	"请求日志库不可用"
+//	@Failure		500				{string}	string	"服务器内部错误"
+//	@Router			/admin/request-logs/{id} [get]
+func AdminGetRequestLogHandler(logService *service.RequestLogService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
+
+		reqLog, err := logService.GetRequestLog(c.Request.Context(), adminActor(c), id)
+		if err != nil {
+			writeRequestLogError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, RequestLogDetailResponse{
+			RequestLogResponse: toRequestLogResponse(*reqLog),
+			FileContentJSON:    json.RawMessage(reqLog.FileContentJSON),
+			RequestBody:        reqLog.RequestBody,
+			ResponseBody:       reqLog.ResponseBody,
+			BodyTruncated:      reqLog.BodyTruncated,
+			RequestRedacted:    reqLog.RequestRedacted,
+			AllocBytes:         reqLog.AllocBytes,
+			Goroutines:         reqLog.Goroutines,
+			CPUProfile:         reqLog.CPUProfile,
+		})
+	}
+}
+
+func parseRequestLogFilter(c *gin.Context) (service.RequestLogFilter, error) {
+	filter := service.RequestLogFilter{
+		Path:        c.Query("path"),
+		Method:      c.Query("method"),
+		RemoteIP:    c.Query("remote_ip"),
+		RequestID:   c.Query("request_id"),
+		ServiceName: c.Query("service_name"),
+		ContentType: c.Query("content_type"),
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, errors.New(p.name + " 不是 RFC3339 时间")
+			}
+			*p.dst = &t
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"status_min", &filter.StatusMin}, {"status_max", &filter.StatusMax}} {
+		if v := c.Query(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return filter, errors.New(p.name + " 不是整数")
+			}
+			*p.dst = n
+		}
+	}
+
+	if v := c.Query("min_latency_ms"); v != "" {
+		ms, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, errors.New("min_latency_ms 不是数字")
+		}
+		filter.MinLatency = ms / 1000
+	}
+	return filter, nil
+}
+
+// parseLimit 解析 limit 參數：沒有傳時為 def，不是正整數時報錯，超過 maxLimit 時按 maxLimit
+func parseLimit(c *gin.Context, def, maxLimit int) (int, error) {
+	v := c.Query("limit")
+	if v == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("limit 必须是正整数")
+	}
+	return min(limit, maxLimit), nil
+}
+
+func writeRequestLogError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, common.ErrorBody(c, "日志不存在"))
+	case errors.Is(err, service.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, common.ErrorBody(c, err.Error()))
+	case errors.Is(err, service.ErrLogDBUnavailable):
+		c.JSON(http.StatusServiceUnavailable, common.ErrorBody(c, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "查询失败："+err.Error()))
+	}
+}
+
+// AdminLogQueueStatusHandler 请求日志队列状态接口
+//
+//	@Summary		请求日志队列状态
+//	@Description	返回请求日志队列的深度以及入队、丢弃、溢出、写出和失败的累计数
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"管理员凭证"
+//	@Success		200				{object}	LogQueueStatusResponse
+//	@Failure		401				{string}	string	"管理员凭证无效"
+//	@Router			/admin/log-queue [get]
+func AdminLogQueueStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, toLogQueueStatusResponse(common.GetLogQueueStats()))
+}
@@ -2,11 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"mime/multipart"
 	"net/http"
 	"strconv"
 	"test-git/common"
 	"test-git/model"
+	"test-git/policy"
 	"test-git/service"
 
 	"github.com/gin-gonic/gin"
@@ -30,30 +32,24 @@ func PreviewRoleHandler(c *gin.Context) {
 
 	var roleCard COCRoleCard
 	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "解析表单失败: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, common.ErrorBody(c, "解析表单失败: "+err.Error()))
 		return
 	}
 
 	if c.Request.MultipartForm == nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "表单数据为空",
-		})
+		c.JSON(http.StatusBadRequest, common.ErrorBody(c, "表单数据为空"))
 		return
 	}
 
 	files, ok := c.Request.MultipartForm.File["file"]
 	if !ok || len(files) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "未找到名为 'file' 的文件",
-		})
+		c.JSON(http.StatusBadRequest, common.ErrorBody(c, "未找到名为 'file' 的文件"))
 		return
 	}
 
 	err := decodeFile(&roleCard, files[0])
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "文件解析失敗：" + err.Error()})
+		c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "文件解析失敗："+err.Error()))
 		return
 	}
 	c.JSON(http.StatusOK, roleCard)
@@ -67,29 +63,35 @@ func PreviewRoleHandler(c *gin.Context) {
 //	@Param			page		query		int	false	"页码（默认1）"
 //	@Param			pageSize	query		int	false	"每页条数（默认10）"
 //	@Success		200			{object}	RoleListResponse
+//	@Failure		403			{string}	string	"无权限"
 //	@Failure		500			{string}	string	"服务器内部错误"
 //	@Router			/roles [get]
-func ListRoleHandler(c *gin.Context) {
-	userID := common.GetUserID(c)
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
-
-	roles, total, err := service.GetAllRoles(userID, page, pageSize)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询列表失败：" + err.Error()})
-		return
-	}
+func ListRoleHandler(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+		roles, total, err := roleService.GetAllRoles(c.Request.Context(), common.GetSubject(c), page, pageSize)
+		if err != nil {
+			if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限查看角色"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "查询列表失败："+err.Error()))
+			return
+		}
 
-	var respList []RoleResponse
-	for _, role := range roles {
-		respList = append(respList, toRoleResponse(role, false))
-	}
+		var respList []RoleResponse
+		for _, role := range roles {
+			respList = append(respList, toRoleResponse(role, false))
+		}
 
-	resp := RoleListResponse{
-		Total: int(total),
-		List:  respList,
+		resp := RoleListResponse{
+			Total: int(total),
+			List:  respList,
+		}
+		c.JSON(http.StatusOK, resp)
 	}
-	c.JSON(http.StatusOK, resp)
 }
 
 // GetRoleHandler 查询角色详情接口
@@ -101,27 +103,32 @@ func ListRoleHandler(c *gin.Context) {
 //	@Success		200		{object}	RoleResponse
 //	@Failure		400		{string}	string	"请求参数错误或ID格式错误"
 //	@Failure		404		{string}	string	"角色不存在"
+//	@Failure		403		{string}	string	"无权限"
 //	@Failure		500		{string}	string	"服务器内部错误"
 //	@Router			/roles/{id} [get]
-func GetRoleHandler(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
-		return
-	}
+func GetRoleHandler(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
 
-	role, err := service.GetRoleByID(uint(id), common.GetUserID(c))
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败：" + err.Error()})
+		role, err := roleService.GetRoleByID(c.Request.Context(), uint(id), common.GetSubject(c))
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, common.ErrorBody(c, "角色不存在"))
+			} else if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限查看该角色"))
+			} else {
+				c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "查询失败："+err.Error()))
+			}
+			return
 		}
-		return
-	}
 
-	c.JSON(http.StatusOK, toRoleResponse(*role, true))
+		c.JSON(http.StatusOK, toRoleResponse(*role, true))
+	}
 }
 
 // CreateRoleHandler 创建角色接口
@@ -130,45 +137,41 @@ func GetRoleHandler(c *gin.Context) {
 //	@Description	新增一個角色到数据库
 //	@Accept			json
 //	@Produce		json
-//	@Param			book	body		CreateRoleRequest	true	"角色信息"
-//	@Success		201		{object}	RoleResponse
-//	@Failure		400		{string}	string	"请求参数错误"
-//	@Failure		500		{string}	string	"服务器内部错误"
+//	@Param			book			body		CreateRoleRequest	true	"角色信息"
+//	@Param			Idempotency-Key	header		string				false	"幂等键，重试时使用相同的值"
+//	@Success		201				{object}	RoleResponse
+//	@Failure		400				{string}	string	"请求参数错误"
+//	@Failure		403				{string}	string	"无权限"
+//	@Failure		409				{string}	string	"相同请求正在处理中"
+//	@Failure		422				{string}	string	"幂等键已用于不同的请求"
+//	@Failure		500				{string}	string	"服务器内部错误"
 //	@Router			/roles/create [post]
-func CreateRoleHandler(c *gin.Context) {
-	var req CreateRoleRequest
+func CreateRoleHandler(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateRoleRequest
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误：" + err.Error()})
-		return
-	}
-
-	roleCard := req.RoleData
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "请求参数错误："+err.Error()))
+			return
+		}
 
-	if req.AvatarUrl != roleCard.BasicInfo.AvatarURL && req.AvatarUrl != "" {
-		roleCard.BasicInfo.AvatarURL = req.AvatarUrl
-	}
+		role, err := newRoleFromCard(req.RoleData, req.AvatarUrl)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "角色卡格式错误："+err.Error()))
+			return
+		}
 
-	roleJSON, err := json.Marshal(&roleCard)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "角色卡格式错误：" + err.Error()})
-		return
-	}
+		if err := roleService.CreateRole(c.Request.Context(), role, common.GetSubject(c)); err != nil {
+			if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限创建角色"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "创建角色失败："+err.Error()))
+			return
+		}
 
-	role := &model.Role{
-		Name:        roleCard.BasicInfo.RoleName,
-		WxUserId:    common.GetUserID(c),
-		AvatarUrl:   req.AvatarUrl,
-		Description: getRoleDesc(&roleCard),
-		RoleData:    roleJSON,
+		c.JSON(http.StatusCreated, toRoleResponse(*role, true))
 	}
-
-	if err := service.CreateRole(role); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建角色失败：" + err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusCreated, toRoleResponse(*role, true))
 }
 
 // UpdateRoleHandler 更新角色接口
@@ -182,53 +185,57 @@ func CreateRoleHandler(c *gin.Context) {
 //	@Success		204		{string}	string				"更新成功"
 //	@Failure		400		{string}	string				"请求参数错误或ID格式错误"
 //	@Failure		404		{string}	string				"角色不存在"
+//	@Failure		403		{string}	string				"无权限"
 //	@Failure		500		{string}	string				"服务器内部错误"
 //	@Router			/roles/{id} [put]
-func UpdateRoleHandler(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
-		return
-	}
-
-	var req UpdateRoleRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误：" + err.Error()})
-		return
-	}
+func UpdateRoleHandler(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
 
-	roleCard := req.RoleData
+		var req UpdateRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "请求参数错误："+err.Error()))
+			return
+		}
 
-	if req.AvatarUrl != roleCard.BasicInfo.AvatarURL && req.AvatarUrl != "" {
-		roleCard.BasicInfo.AvatarURL = req.AvatarUrl
-	}
+		roleCard := req.RoleData
 
-	roleJSON, err := json.Marshal(&roleCard)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "角色卡格式错误：" + err.Error()})
-		return
-	}
+		if req.AvatarUrl != roleCard.BasicInfo.AvatarURL && req.AvatarUrl != "" {
+			roleCard.BasicInfo.AvatarURL = req.AvatarUrl
+		}
 
-	updatedRole := &model.Role{
-		Name:        roleCard.BasicInfo.RoleName,
-		WxUserId:    common.GetUserID(c),
-		Description: getRoleDesc(&roleCard),
-		AvatarUrl:   req.AvatarUrl,
-	}
-	updatedRole.RoleData = roleJSON
+		roleJSON, err := json.Marshal(&roleCard)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "角色卡格式错误："+err.Error()))
+			return
+		}
 
-	if err := service.UpdateRole(uint(id), updatedRole); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "角色記錄不存在:" + err.Error()})
+		updatedRole := &model.Role{
+			Name:        roleCard.BasicInfo.RoleName,
+			Description: getRoleDesc(&roleCard),
+			AvatarUrl:   req.AvatarUrl,
+		}
+		updatedRole.RoleData = roleJSON
+
+		if err := roleService.UpdateRole(c.Request.Context(), uint(id), updatedRole, common.GetSubject(c)); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, common.ErrorBody(c, "角色記錄不存在:"+err.Error()))
+				return
+			} else if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限修改该角色"))
+			} else {
+				c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "更新失败："+err.Error()))
+			}
 			return
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败：" + err.Error()})
 		}
-		return
-	}
 
-	c.JSON(http.StatusNoContent, gin.H{"message": "更新成功"})
+		c.JSON(http.StatusNoContent, gin.H{"message": "更新成功"})
+	}
 }
 
 // DeleteRoleHandler 删除角色接口
@@ -240,23 +247,33 @@ func UpdateRoleHandler(c *gin.Context) {
 //	@Success		204	{string}	string	"删除成功"
 //	@Failure		400	{string}	string	"ID格式错误"
 //	@Failure		404	{string}	string	"角色不存在"
+//	@Failure		403	{string}	string	"无权限"
 //	@Failure		500	{string}	string	"服务器内部错误"
 //	@Router			/roles/{id} [delete]
-func DeleteRoleHandler(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
-		return
-	}
+func DeleteRoleHandler(roleService *service.RoleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorBody(c, "ID格式错误"))
+			return
+		}
 
-	err = service.DeleteRole(uint(id))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗失败：" + err.Error()})
-		return
-	}
+		err = roleService.DeleteRole(c.Request.Context(), uint(id), common.GetSubject(c))
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, common.ErrorBody(c, "角色不存在"))
+				return
+			} else if errors.Is(err, policy.ErrForbidden) {
+				c.JSON(http.StatusForbidden, common.ErrorBody(c, "无权限删除该角色"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, common.ErrorBody(c, "刪除失敗失败："+err.Error()))
+			return
+		}
 
-	c.JSON(http.StatusNoContent, "")
+		c.JSON(http.StatusNoContent, "")
+	}
 }
 
 func decodeFile(input interface{}, fileHeader *multipart.FileHeader) error {
@@ -0,0 +1,134 @@
+package loadtest
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histogram HDR 風格的延遲直方圖，以微秒記錄，相對誤差小於 0.1%（三位有效數字）
+//
+// 小於 2048µs 的值每微秒一個桶；更大的值按 2 的冪分段，每段 1024 個桶。
+type Histogram struct {
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+	sum    float64
+	sumSq  float64
+}
+
+const (
+	subBucketBits  = 11
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+	// 最大記錄一小時，超過的值按一小時計
+	maxTrackable = int64(time.Hour / time.Microsecond)
+)
+
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: make([]int64, bucketIndex(maxTrackable)+1),
+		min:    math.MaxInt64,
+	}
+}
+
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	return subBucketCount + (shift-1)*subBucketHalf + int(v>>shift) - subBucketHalf
+}
+
+// highestEquivalent 桶中最大的值，百分位按這個值報告
+func highestEquivalent(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	shift := (idx-subBucketCount)/subBucketHalf + 1
+	top := int64((idx-subBucketCount)%subBucketHalf + subBucketHalf)
+	return (top+1)<<shift - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	v := d.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+	if v > maxTrackable {
+		v = maxTrackable
+	}
+	h.counts[bucketIndex(v)]++
+	h.total++
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+	h.sum += float64(v)
+	h.sumSq += float64(v) * float64(v)
+}
+
+// Merge 把另一個直方圖的記錄加到 h
+func (h *Histogram) Merge(other *Histogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.min = min(h.min, other.min)
+	h.max = max(h.max, other.max)
+	h.sum += other.sum
+	h.sumSq += other.sumSq
+}
+
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// ValueAtPercentile 返回微秒，p 取值 0 到 100
+func (h *Histogram) ValueAtPercentile(p float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(p / 100 * float64(h.total)))
+	target = max(target, 1)
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			return min(highestEquivalent(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// LatencySummary 報告中的延遲統計，單位毫秒
+type LatencySummary struct {
+	Count  int64              `json:"count"`
+	Min    float64            `json:"min_ms"`
+	Max    float64            `json:"max_ms"`
+	Mean   float64            `json:"mean_ms"`
+	StdDev float64            `json:"stddev_ms"`
+	Pcts   map[string]float64 `json:"percentiles_ms"`
+}
+
+var reportPercentiles = []struct {
+	name  string
+	value float64
+}{
+	{"p50", 50}, {"p75", 75}, {"p90", 90}, {"p95", 95}, {"p99", 99}, {"p99.9", 99.9}, {"p99.99", 99.99},
+}
+
+func (h *Histogram) Summary() LatencySummary {
+	s := LatencySummary{Count: h.total, Pcts: make(map[string]float64)}
+	if h.total == 0 {
+		return s
+	}
+	mean := h.sum / float64(h.total)
+	s.Min = float64(h.min) / 1000
+	s.Max = float64(h.max) / 1000
+	s.Mean = mean / 1000
+	s.StdDev = math.Sqrt(math.Max(h.sumSq/float64(h.total)-mean*mean, 0)) / 1000
+	for _, p := range reportPercentiles {
+		s.Pcts[p.name] = float64(h.ValueAtPercentile(p.value)) / 1000
+	}
+	return s
+}
@@ -0,0 +1,444 @@
+// Package loadtest 內置的壓測工具，取代 uplaod.lua/header.lua 兩個 wrk 腳本
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"test-git/common"
+	"time"
+)
+
+// 壓測場景
+const (
+	ScenarioUpload = "upload" // 與 uplaod.lua 相同：上傳角色卡文件到 POST /roles
+	ScenarioMix    = "mix"    // 按權重混合 list/get/create/update
+)
+
+// mix 中的操作
+const (
+	OpList   = "list"
+	OpGet    = "get"
+	OpCreate = "create"
+	OpUpdate = "update"
+)
+
+// 身份請求頭的來源
+const (
+	IdentityGateway = "gateway" // X-WX-OPENID，配置了網關密鑰時附帶簽名
+	IdentitySession = "session" // 用會話密鑰簽發 Bearer 令牌
+)
+
+type Options struct {
+	BaseURL       string
+	Scenario      string
+	RoleCard      []byte // 角色卡 JSON，上傳和創建角色使用
+	Concurrency   int
+	Duration      time.Duration
+	Users         int            // 虛擬用戶數，openid 為 loadtest-user-<n>
+	Mix           map[string]int // 操作權重
+	Identity      string
+	SessionSecret []byte
+	GatewaySecret []byte
+	Seed          int64
+	Client        *http.Client
+}
+
+// ParseMix 解析 "list=50,get=30,create=10,update=10"
+func ParseMix(v string) (map[string]int, error) {
+	mix := make(map[string]int)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		op, weightStr, ok := strings.Cut(item, "=")
+		weight, err := strconv.Atoi(weightStr)
+		if !ok || err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid mix entry %q", item)
+		}
+		switch op {
+		case OpList, OpGet, OpCreate, OpUpdate:
+			mix[op] = weight
+		default:
+			return nil, fmt.Errorf("unknown mix operation %q", op)
+		}
+	}
+	total := 0
+	for _, w := range mix {
+		total += w
+	}
+	if total == 0 {
+		return nil, errors.New("mix has no weight")
+	}
+	return mix, nil
+}
+
+// OperationReport 單個操作的統計
+type OperationReport struct {
+	Requests int64            `json:"requests"`
+	Errors   int64            `json:"errors"` // 連接錯誤和超時
+	Status   map[string]int64 `json:"status"` // 按狀態碼統計
+	Latency  LatencySummary   `json:"latency"`
+}
+
+type Report struct {
+	Scenario    string                     `json:"scenario"`
+	Target      string                     `json:"target"`
+	Concurrency int                        `json:"concurrency"`
+	Users       int                        `json:"users"`
+	Duration    float64                    `json:"duration_seconds"`
+	Requests    int64                      `json:"requests"`
+	Throughput  float64                    `json:"requests_per_second"`
+	Errors      int64                      `json:"errors"`
+	Status      map[string]int64           `json:"status"`
+	Latency     LatencySummary             `json:"latency"`
+	Operations  map[string]OperationReport `json:"operations"`
+	StartedAt   time.Time                  `json:"started_at"`
+}
+
+// virtualUser 一個虛擬用戶的身份和已經創建的角色
+type virtualUser struct {
+	openID string
+	header http.Header
+
+	mu    sync.Mutex
+	roles []uint
+}
+
+func (u *virtualUser) addRole(id uint) {
+	u.mu.Lock()
+	u.roles = append(u.roles, id)
+	u.mu.Unlock()
+}
+
+func (u *virtualUser) pickRole(rng *rand.Rand) (uint, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.roles) == 0 {
+		return 0, false
+	}
+	return u.roles[rng.Intn(len(u.roles))], true
+}
+
+// workerStats 每個 worker 獨立記錄，結束後合併，避免熱路徑上的鎖
+type workerStats struct {
+	ops map[string]*opStats
+}
+
+type opStats struct {
+	hist     *Histogram
+	requests int64
+	errors   int64
+	status   map[int]int64
+}
+
+func (w *workerStats) op(name string) *opStats {
+	s, ok := w.ops[name]
+	if !ok {
+		s = &opStats{hist: NewHistogram(), status: make(map[int]int64)}
+		w.ops[name] = s
+	}
+	return s
+}
+
+// Run 在 Duration 内用 Concurrency 個 worker 持續發送請求，ctx 取消時提前結束
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Users < 1 {
+		opts.Users = 1
+	}
+	if opts.Scenario == ScenarioMix && len(opts.Mix) == 0 {
+		return nil, errors.New("mix scenario requires operation weights")
+	}
+	if opts.Scenario != ScenarioUpload && opts.Scenario != ScenarioMix {
+		return nil, fmt.Errorf("unknown scenario %q", opts.Scenario)
+	}
+	if !json.Valid(opts.RoleCard) {
+		return nil, errors.New("role card is not valid JSON")
+	}
+
+	users, err := newVirtualUsers(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Scenario == ScenarioMix && (opts.Mix[OpGet] > 0 || opts.Mix[OpUpdate] > 0) {
+		// get/update 需要已有的角色，每個用戶先創建一個
+		for _, u := range users {
+			status, _, err := createRole(ctx, opts, u)
+			if err == nil && status != http.StatusCreated {
+				err = fmt.Errorf("status %d", status)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("seed role for %s: %w", u.openID, err)
+			}
+		}
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	start := time.Now()
+	results := make([]*workerStats, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		stats := &workerStats{ops: make(map[string]*opStats)}
+		results[i] = stats
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(opts.Seed + int64(worker)))
+			for n := 0; runCtx.Err() == nil; n++ {
+				u := users[(worker+n*opts.Concurrency)%len(users)]
+				op := ScenarioUpload
+				if opts.Scenario == ScenarioMix {
+					op = pickOperation(opts.Mix, rng)
+				}
+				executed, status, latency, err := execute(runCtx, opts, u, op, rng)
+				// 壓測結束時被取消的請求不計入
+				if runCtx.Err() != nil && err != nil {
+					return
+				}
+				s := stats.op(executed)
+				s.requests++
+				if err != nil {
+					s.errors++
+					continue
+				}
+				s.status[status]++
+				s.hist.Record(latency)
+			}
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	return buildReport(opts, start, elapsed, results), nil
+}
+
+func newVirtualUsers(opts Options) ([]*virtualUser, error) {
+	var signer *common.SessionSigner
+	if opts.Identity == IdentitySession {
+		signer = common.NewSessionSigner(opts.SessionSecret, 24*time.Hour)
+	}
+	users := make([]*virtualUser, opts.Users)
+	for i := range users {
+		u := &virtualUser{openID: fmt.Sprintf("loadtest-user-%d", i+1), header: http.Header{}}
+		u.header.Set("User-Agent", "test-git-loadtest/1.0")
+		switch opts.Identity {
+		case IdentitySession:
+			token, _, err := signer.Issue(common.SessionClaims{OpenID: u.openID})
+			if err != nil {
+				return nil, err
+			}
+			u.header.Set("Authorization", "Bearer "+token)
+		default:
+			u.header.Set(common.WxOpenID, u.openID)
+		}
+		users[i] = u
+	}
+	return users, nil
+}
+
+func pickOperation(mix map[string]int, rng *rand.Rand) string {
+	ops := []string{OpList, OpGet, OpCreate, OpUpdate}
+	total := 0
+	for _, op := range ops {
+		total += mix[op]
+	}
+	n := rng.Intn(total)
+	for _, op := range ops {
+		if n < mix[op] {
+			return op
+		}
+		n -= mix[op]
+	}
+	return OpList
+}
+
+// execute 執行一次操作，返回實際執行的操作：用戶還沒有角色時 get 改為 list，update 改為 create，
+// 延遲記在實際執行的操作下
+func execute(ctx context.Context, opts Options, u *virtualUser, op string, rng *rand.Rand) (string, int, time.Duration, error) {
+	var (
+		status  int
+		latency time.Duration
+		err     error
+	)
+	switch op {
+	case ScenarioUpload:
+		var (
+			buf  bytes.Buffer
+			part io.Writer
+		)
+		w := multipart.NewWriter(&buf)
+		if part, err = w.CreateFormFile("file", "role.json"); err != nil {
+			return op, 0, 0, err
+		}
+		part.Write(opts.RoleCard)
+		w.Close()
+		status, latency, err = do(ctx, opts, u, http.MethodPost, "/roles", w.FormDataContentType(), &buf)
+	case OpList:
+		status, latency, err = do(ctx, opts, u, http.MethodGet, "/roles?page=1&pageSize=10", "", nil)
+	case OpGet:
+		id, ok := u.pickRole(rng)
+		if !ok {
+			return execute(ctx, opts, u, OpList, rng)
+		}
+		status, latency, err = do(ctx, opts, u, http.MethodGet, "/roles/"+strconv.FormatUint(uint64(id), 10), "", nil)
+	case OpCreate:
+		status, latency, err = createRole(ctx, opts, u)
+	case OpUpdate:
+		id, ok := u.pickRole(rng)
+		if !ok {
+			return execute(ctx, opts, u, OpCreate, rng)
+		}
+		body := roleRequestBody(opts.RoleCard, u.openID)
+		status, latency, err = do(ctx, opts, u, http.MethodPut, "/roles/"+strconv.FormatUint(uint64(id), 10), "application/json", bytes.NewReader(body))
+	default:
+		err = fmt.Errorf("unknown operation %q", op)
+	}
+	return op, status, latency, err
+}
+
+func roleRequestBody(roleCard []byte, name string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"name":      name,
+		"role_data": json.RawMessage(roleCard),
+	})
+	return body
+}
+
+// createRole 創建角色並記下返回的 ID，供 get/update 使用
+func createRole(ctx context.Context, opts Options, u *virtualUser) (int, time.Duration, error) {
+	req, err := newRequest(ctx, opts, u, http.MethodPost, "/roles/create", "application/json",
+		bytes.NewReader(roleRequestBody(opts.RoleCard, u.openID)))
+	if err != nil {
+		return 0, 0, err
+	}
+	start := time.Now()
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	var created struct {
+		ID uint `json:"id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	latency := time.Since(start)
+	if resp.StatusCode == http.StatusCreated && err == nil && created.ID > 0 {
+		u.addRole(created.ID)
+	} else if resp.StatusCode == http.StatusCreated {
+		return resp.StatusCode, latency, fmt.Errorf("decode created role: %v", err)
+	}
+	return resp.StatusCode, latency, nil
+}
+
+func do(ctx context.Context, opts Options, u *virtualUser, method, path, contentType string, body io.Reader) (int, time.Duration, error) {
+	req, err := newRequest(ctx, opts, u, method, path, contentType, body)
+	if err != nil {
+		return 0, 0, err
+	}
+	start := time.Now()
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	// 延遲包含讀完響應體的時間，與 wrk 一致
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, time.Since(start), err
+}
+
+func newRequest(ctx context.Context, opts Options, u *virtualUser, method, path, contentType string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(opts.BaseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range u.header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if opts.Identity != IdentitySession && len(opts.GatewaySecret) > 0 {
+		ts := time.Now().Unix()
+		req.Header.Set(common.WxTimestamp, strconv.FormatInt(ts, 10))
+		req.Header.Set(common.WxSignature, common.SignIdentityHeaders(opts.GatewaySecret, u.openID, "", "", "", ts))
+	}
+	return req, nil
+}
+
+func buildReport(opts Options, start time.Time, elapsed time.Duration, results []*workerStats) *Report {
+	report := &Report{
+		Scenario:    opts.Scenario,
+		Target:      opts.BaseURL,
+		Concurrency: opts.Concurrency,
+		Users:       opts.Users,
+		Duration:    elapsed.Seconds(),
+		Status:      make(map[string]int64),
+		Operations:  make(map[string]OperationReport),
+		StartedAt:   start,
+	}
+
+	total := NewHistogram()
+	merged := make(map[string]*opStats)
+	for _, w := range results {
+		for name, s := range w.ops {
+			m, ok := merged[name]
+			if !ok {
+				m = &opStats{hist: NewHistogram(), status: make(map[int]int64)}
+				merged[name] = m
+			}
+			m.hist.Merge(s.hist)
+			m.requests += s.requests
+			m.errors += s.errors
+			for code, n := range s.status {
+				m.status[code] += n
+			}
+		}
+	}
+
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := merged[name]
+		op := OperationReport{
+			Requests: m.requests,
+			Errors:   m.errors,
+			Status:   make(map[string]int64),
+			Latency:  m.hist.Summary(),
+		}
+		for code, n := range m.status {
+			op.Status[strconv.Itoa(code)] = n
+			report.Status[strconv.Itoa(code)] += n
+		}
+		report.Operations[name] = op
+		report.Requests += m.requests
+		report.Errors += m.errors
+		total.Merge(m.hist)
+	}
+	report.Latency = total.Summary()
+	if elapsed > 0 {
+		report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	}
+	return report
+}
@@ -1,41 +1,234 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"test-git/common"
+	"test-git/config"
 	"test-git/db"
 	_ "test-git/docs"
 	"test-git/handler"
+	"test-git/migrations"
+	"test-git/policy"
+	"test-git/repository"
+	"test-git/service"
+	"test-git/wechat"
+	"time"
 
-	midLogger "github.com/OttoLeung-varadise/logmiddleware/logger"
-	loggerModel "github.com/OttoLeung-varadise/logmiddleware/model"
 	"github.com/arl/statsviz"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"gorm.io/gorm"
 )
 
+// commands 子命令，沒有子命令或第一個參數是選項時執行 serve
+var commands = []struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}{
+	{"serve", "啟動 HTTP 服務", runServe},
+	{"migrate", "執行、回滾或查看表結構遷移", runMigrate},
+	{"drift", "比較 gorm 模型和數據庫表結構", runDrift},
+	{"seed", "把 role.json 格式的角色卡導入到指定用戶", runSeed},
+	{"export", "導出一個用戶的角色到目錄或壓縮包", runExport},
+	{"import", "導入 export 導出的角色", runImport},
+	{"replay", "回放請求日志", runReplay},
+	{"loadtest", "壓測", runLoadTest},
+}
+
 func main() {
-	if err := db.Init(); err != nil {
-		fmt.Printf("database init fails: %v\n", err)
-		return
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runServe(os.Args[1:]))
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+	if os.Args[1] != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+	}
+	fmt.Fprintf(os.Stderr, "usage: %s [command] [options]\n\ncommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\n每個命令都接受 -config 和 -set KEY=VALUE，用 <command> -h 查看其他選項")
+	os.Exit(2)
+}
+
+// runServe 啟動 HTTP 服務，收到 SIGINT/SIGTERM 後優雅退出
+//
+//	go run . serve -config config.yaml -addr :9090 -set RATE_LIMIT_ENABLED=false
+//	go run . serve --store=memory
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	var opts config.Options
+	opts.RegisterFlags(fs)
+	opts.Flag(fs, "addr", "SERVER_ADDR", "監聽地址")
+	opts.Flag(fs, "store", "STORE", "業務數據存儲，postgres 或 memory（不需要數據庫，重啟後數據丟失）")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := config.Load(opts)
+	if err != nil {
+		// 應用日志還沒有初始化，直接輸出到標準錯誤
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		return 2
+	}
+	common.InitAppLogger(cfg.AppLog)
+	logger := slog.With("pkg", "main")
+
+	// STORE=memory 時不連接主庫，角色、書籍和用戶保存在進程內，用於本地開發
+	var migrator *db.Migrator
+	if cfg.Store.Kind == repository.StoreMemory {
+		logger.Warn("using the in-memory store, data is lost on restart")
+	} else {
+		if err := db.Init(cfg.Database); err != nil {
+			logger.Error("database init fails", "err", err)
+			return 1
+		}
+		logger.Info("database connected")
+		migrator, err = db.NewMigrator(db.DB, migrations.FS)
+		if err != nil {
+			logger.Error("migrations invalid", "err", err)
+			return 1
+		}
+		// 表結構落後時拒絕啟動，由 `migrate up` 顯式升級，避免多個副本同時改表
+		status, err := migrator.Status(context.Background())
+		if err == nil {
+			err = status.Err()
+		}
+		if err != nil {
+			logger.Error("database schema not ready", "err", err)
+			return 1
+		}
+		if status.Current > status.Latest {
+			logger.Warn("database schema is newer than this build", "current", status.Current, "latest", status.Latest)
+		}
+		if cfg.Metrics.Enabled {
+			if err := db.RegisterMetrics(common.MetricsRegistry, "main", db.DB); err != nil {
+				logger.Error("database metrics init fails", "err", err)
+			}
+		}
 	}
-	fmt.Println("database connet succ")
+	repos := repository.New(cfg.Store, db.DB)
+	users := service.NewUserService(repos.Users)
+	roles := service.NewRoleService(repos.Roles)
+	books := service.NewBookService(repos.Books)
+	admin := service.NewAdminService(repos)
+	requestLogs := service.NewRequestLogService(repos.Audits)
+
+	// 收到 SIGINT/SIGTERM 後停止接收新連接，依次等待請求結束、寫完日志、關閉連接池
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	logDB, logErr := loggerModel.InitLogDB()
-	if logErr != nil {
-		fmt.Printf("log database init fails: %v\n", logErr)
+	shutdownTracing, err := common.InitTracing(ctx, cfg.Tracing)
+	if err != nil {
+		logger.Error("tracing init fails", "err", err)
+		return 1
+	}
+	if db.DB != nil && cfg.Tracing.Exporter != common.TraceExporterNone {
+		if err := db.RegisterTracing("main", db.DB); err != nil {
+			logger.Error("database tracing init fails", "err", err)
+		}
 	}
-	r := gin.Default()
 
-	if logErr == nil {
-		// create gorouties, use the logDB connetion.
-		go midLogger.StartLogWriter(logDB)
-		midLogger.SetServiceName("test-git")
+	// 只配置了文件或標準輸出時不需要 request-log 庫，開發環境可以不部署它
+	var logDB *gorm.DB
+	if cfg.LogSink.Uses(common.LogSinkPostgres) {
+		logDB, err = db.InitLogDB(cfg.LogDatabase, cfg.Partition)
+		if err != nil {
+			logger.Error("log database init fails", "err", err)
+		}
+	}
+	if logDB != nil && cfg.Tracing.Exporter != common.TraceExporterNone {
+		if err := db.RegisterTracing("request_log", logDB); err != nil {
+			logger.Error("log database tracing init fails", "err", err)
+		}
+	}
+	if logDB != nil && cfg.Metrics.Enabled {
+		if err := db.RegisterMetrics(common.MetricsRegistry, "request_log", logDB); err != nil {
+			logger.Error("log database metrics init fails", "err", err)
+		}
+	}
+	logSink, err := common.NewLogSink(cfg.LogSink, logDB)
+	if err != nil {
+		logger.Error("request log sink init fails", "err", err)
+		return 1
+	}
+	var logWriter *common.LogWriter
+	r := gin.New()
+	if err := common.SetTrustedProxies(r, cfg.Gateway); err != nil {
+		logger.Error("trusted proxies init fails", "err", err)
+		return 1
+	}
+	// 請求 ID 和鏈路最先設置，後面的中間件、錯誤響應和日志都使用它們
+	r.Use(common.RequestIDMiddleware())
+	r.Use(common.TracingMiddleware())
+	r.Use(common.RequestLoggerMiddleware())
+	r.Use(common.RecoveryMiddleware())
+	if cfg.Metrics.Enabled {
+		// 按路由模板統計，放在最前面以包含其他中間件的耗時
+		r.Use(common.MetricsMiddleware())
+		r.GET(cfg.Metrics.Path, common.MetricsHandler(cfg.Metrics))
+	}
+
+	if logDB != nil {
+		go db.RunRequestLogMaintenance(ctx, logDB, cfg.Partition)
+	}
+	// 用戶引用的密鑰也用於追蹤和應用日志，沒有請求日志輸出時同樣需要
+	if err := common.ConfigureBodyCapture(cfg.BodyCapture); err != nil {
+		logger.Error("request log body capture init fails", "err", err)
+		return 1
+	}
+	if logSink != nil {
+		if err := common.ConfigureLogQueue(cfg.LogQueue); err != nil {
+			logger.Error("request log queue init fails", "err", err)
+			return 1
+		}
+		// create gorouties, write logs to the sinks.
+		logWriter = common.StartLogWriter(logSink)
+		common.SetServiceName("test-git")
 		// use logger middleware
-		r.Use(midLogger.RequestLogMiddleware([]string{"/debug/statsviz/*", "/swagger/*"}))
+		r.Use(common.RequestLogMiddleware([]string{"/debug/statsviz/*", "/swagger/*", "/healthz", "/readyz", cfg.Metrics.Path}))
+	}
+	// 放在請求日志之後，採樣結果會寫進同一條請求日志
+	if cfg.Profiler.SampleRate > 0 || cfg.Profiler.SlowThreshold > 0 {
+		if err := common.ConfigureProfiler(cfg.Profiler); err != nil {
+			logger.Error("profiler init fails", "err", err)
+			return 1
+		}
+		r.Use(common.ProfilerMiddleware(cfg.Profiler))
 	}
 
+	// 主庫和表結構不可用時不接流量；日志庫和日志隊列只影響請求日志，標記為 degraded
+	health := common.NewHealth(cfg.Health)
+	if migrator != nil {
+		health.Add("database", true, db.PingCheck(db.DB))
+		health.Add("migrations", true, db.MigrationCheck(migrator))
+	}
+	if cfg.LogSink.Uses(common.LogSinkPostgres) {
+		health.Add("log_database", false, db.PingCheck(logDB))
+		if logDB != nil {
+			health.Add("request_log_partitions", false, db.RequestLogPartitionCheck(logDB))
+		}
+	}
+	if logSink != nil {
+		health.Add("log_queue", false, common.LogQueueCheck(cfg.Health.LogQueueThreshold))
+	}
+	r.GET("/healthz", health.LivenessHandler())
+	r.GET("/readyz", health.ReadinessHandler())
+
 	// 注册 Swagger 路由（关键：让服务启动后能访问 Swagger 页面）
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	// 注册Statsviz路由，访问 /debug/statsviz 查看监控面板
@@ -50,20 +243,99 @@ func main() {
 		index(context.Writer, context.Request)
 	})
 
-	r.Use(common.HeaderMiddleware())
+	var signer *common.SessionSigner
+	rateLimiter := common.RateLimitMiddleware(cfg.RateLimit, common.NewRateLimitStore(cfg.RateLimit, db.DB))
+	if !cfg.Session.Disabled {
+		signer = common.NewSessionSigner(cfg.Session.Secret, cfg.Session.TTL)
+		r.POST("/auth/login", rateLimiter, handler.LoginHandler(wechat.NewClientFromConfig(cfg.WeChat), signer, users))
+	}
+
+	// 管理後台使用獨立的管理員憑證，不經過用戶登錄態
+	adminGroup := r.Group("/admin", common.AdminMiddleware(cfg.Admin))
+	{
+		adminGroup.GET("/roles", handler.AdminListRolesHandler(admin))                                                                  // 跨用戶查詢角色
+		adminGroup.POST("/roles/:id/transfer", handler.AdminTransferRoleHandler(admin))                                                 // 轉移角色
+		adminGroup.POST("/roles/:id/restore", handler.AdminRestoreRoleHandler(admin))                                                   // 恢復角色
+		adminGroup.GET("/users/:wx_user_id/stats", handler.AdminUserStatsHandler(admin))                                                // 用戶統計
+		adminGroup.GET("/request-logs", common.RequirePermission(policy.LogRead), handler.AdminListRequestLogsHandler(requestLogs))     // 查詢請求日志
+		adminGroup.GET("/request-logs/:id", common.RequirePermission(policy.LogRead), handler.AdminGetRequestLogHandler(requestLogs))   // 請求日志詳情
+		adminGroup.GET("/reports/endpoints", common.RequirePermission(policy.LogRead), handler.AdminEndpointReportHandler(requestLogs)) // 接口耗時報表
+		adminGroup.GET("/log-queue", common.RequirePermission(policy.LogRead), handler.AdminLogQueueStatusHandler)                      // 日志隊列狀態
+		adminGroup.GET("/debug/profiler", common.RequirePermission(policy.LogRead), handler.AdminProfilerTopHandler)                    // 最耗資源的路由
+		adminGroup.GET("/debug/profiler/profiles/:name", common.RequirePermission(policy.LogRead), handler.AdminCPUProfileHandler)      // 下載 CPU profile
+	}
+
+	r.Use(common.HeaderMiddleware(cfg.Gateway))
+	r.Use(common.SessionMiddleware(signer))
+	r.Use(handler.SubjectMiddleware(users))
+	r.Use(rateLimiter)
+	r.Use(common.IdempotencyMiddleware(cfg.Idempotency, common.NewIdempotencyStore(cfg.Idempotency, db.DB)))
 
 	roleGroup := r.Group("/roles")
 	{
-		roleGroup.GET("", handler.ListRoleHandler)           // 獲取角色列表
-		roleGroup.GET("/:id", handler.GetRoleHandler)        // 查詢角色詳情
-		roleGroup.POST("", handler.PreviewRoleHandler)       // 預覽角色卡
-		roleGroup.POST("/create", handler.CreateRoleHandler) // 創建角色
-		roleGroup.PUT("/:id", handler.UpdateRoleHandler)     // 更新角色
-		roleGroup.DELETE("/:id", handler.DeleteRoleHandler)  // 刪除角色
+		roleGroup.GET("", common.RequirePermission(policy.RoleRead), handler.ListRoleHandler(roles))             // 獲取角色列表
+		roleGroup.GET("/:id", common.RequirePermission(policy.RoleRead), handler.GetRoleHandler(roles))          // 查詢角色詳情
+		roleGroup.POST("", common.RequirePermission(policy.RoleCreate), handler.PreviewRoleHandler)              // 預覽角色卡
+		roleGroup.POST("/create", common.RequirePermission(policy.RoleCreate), handler.CreateRoleHandler(roles)) // 創建角色
+		roleGroup.PUT("/:id", common.RequirePermission(policy.RoleUpdate), handler.UpdateRoleHandler(roles))     // 更新角色
+		roleGroup.DELETE("/:id", common.RequirePermission(policy.RoleDelete), handler.DeleteRoleHandler(roles))  // 刪除角色
+	}
+
+	bookGroup := r.Group("/books")
+	{
+		bookGroup.GET("", common.RequirePermission(policy.BookRead), handler.ListBooksHandler(books))          // 獲取書籍列表
+		bookGroup.GET("/:id", common.RequirePermission(policy.BookRead), handler.GetBookHandler(books))        // 查詢書籍詳情
+		bookGroup.POST("", common.RequirePermission(policy.BookWrite), handler.CreateBookHandler(books))       // 創建書籍
+		bookGroup.PUT("/:id", common.RequirePermission(policy.BookWrite), handler.UpdateBookHandler(books))    // 更新書籍
+		bookGroup.DELETE("/:id", common.RequirePermission(policy.BookWrite), handler.DeleteBookHandler(books)) // 刪除書籍
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	go func() {
+		logger.Info("service started up", "addr", cfg.Server.Addr, "tls", cfg.Server.TLSEnabled())
+		var err error
+		if cfg.Server.TLSEnabled() {
+			err = server.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("service start fails", "err", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	logger.Info("service shutting down")
+	health.SetShuttingDown()
+	if cfg.Server.ShutdownDelay > 0 {
+		time.Sleep(cfg.Server.ShutdownDelay)
 	}
 
-	fmt.Println("service started up, listen no port: 8080")
-	if err := r.Run(":8080"); err != nil {
-		fmt.Printf("service start fails: %v\n", err)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("server shutdown fails", "err", err)
+	}
+	if logWriter != nil {
+		if err := logWriter.Stop(shutdownCtx); err != nil {
+			logger.Error("request log writer stop fails", "err", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("tracing shutdown fails", "err", err)
+	}
+	if err := db.Close(); err != nil {
+		logger.Error("database close fails", "err", err)
 	}
+	logger.Info("service stopped")
+	return 0
 }
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS users (
+	id bigserial NOT NULL,
+	created_at timestamptz NULL,
+	updated_at timestamptz NULL,
+	deleted_at timestamptz NULL,
+	wx_user_id varchar(255) NOT NULL,
+	roles varchar(255) NOT NULL DEFAULT 'player',
+	CONSTRAINT users_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_users_deleted_at ON users USING btree (deleted_at);
+CREATE UNIQUE INDEX idx_users_wx_user_id ON users USING btree (wx_user_id);
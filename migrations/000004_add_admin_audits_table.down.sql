@@ -0,0 +1 @@
+DROP TABLE admin_audits;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS admin_audits (
+	id bigserial NOT NULL,
+	actor varchar(255) NOT NULL,
+	"action" varchar(64) NOT NULL,
+	target_type varchar(64) NOT NULL,
+	target_id varchar(255) NOT NULL,
+	detail jsonb NULL,
+	remote_ip varchar(45) NOT NULL,
+	created_at timestamptz NOT NULL,
+	CONSTRAINT admin_audits_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_admin_audits_actor ON admin_audits USING btree (actor);
+CREATE INDEX idx_admin_audits_target_id ON admin_audits USING btree (target_id);
+CREATE INDEX idx_admin_audits_created_at ON admin_audits USING btree (created_at);
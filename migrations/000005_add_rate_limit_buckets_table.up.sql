@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+	"key" varchar(255) NOT NULL,
+	tokens double precision NOT NULL,
+	allowed boolean NOT NULL,
+	updated_at timestamptz NOT NULL,
+	CONSTRAINT rate_limit_buckets_pkey PRIMARY KEY ("key")
+);
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets USING btree (updated_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	"scope" varchar(255) NOT NULL,
+	"key" varchar(255) NOT NULL,
+	request_hash varchar(64) NOT NULL,
+	completed boolean NOT NULL,
+	status_code bigint NOT NULL,
+	content_type varchar(255) NOT NULL,
+	response_body bytea NULL,
+	created_at timestamptz NOT NULL,
+	expires_at timestamptz NOT NULL,
+	CONSTRAINT idempotency_keys_pkey PRIMARY KEY ("scope", "key")
+);
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys USING btree (expires_at);
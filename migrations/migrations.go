@@ -0,0 +1,9 @@
+// Package migrations 主庫的表結構遷移，編譯進二進制文件，由 `migrate` 子命令執行
+//
+// 文件名格式為 <版本號>_<名稱>.up.sql / .down.sql，版本號連續遞增。
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AdminAudit 管理員操作審計記錄，對應數據庫表admin_audits
+type AdminAudit struct {
+	ID         uint64         `gorm:"primaryKey" json:"id"`
+	Actor      string         `gorm:"type:varchar(255);not null;index" json:"actor"`     // 操作人
+	Action     string         `gorm:"type:varchar(64);not null" json:"action"`           // 操作類型
+	TargetType string         `gorm:"type:varchar(64);not null" json:"target_type"`      // 操作對象類型
+	TargetID   string         `gorm:"type:varchar(255);not null;index" json:"target_id"` // 操作對象ID
+	Detail     datatypes.JSON `gorm:"type:jsonb" json:"detail"`                          // 操作參數和結果
+	RemoteIP   string         `gorm:"type:varchar(45);not null" json:"remote_ip"`        // 客戶端IP
+	CreatedAt  time.Time      `gorm:"type:timestamptz;not null;index" json:"created_at"` // 操作時間
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// IdempotencyKey 冪等請求的處理結果，由 common.PostgresIdempotencyStore 用原生SQL讀寫
+type IdempotencyKey struct {
+	Scope        string    `gorm:"type:varchar(255);primaryKey" json:"scope"`         // 用戶或IP
+	Key          string    `gorm:"type:varchar(255);primaryKey" json:"key"`           // Idempotency-Key
+	RequestHash  string    `gorm:"type:varchar(64);not null" json:"request_hash"`     // 請求方法、路徑和請求體的哈希
+	Completed    bool      `gorm:"not null" json:"completed"`                         // 第一次請求是否已處理完成
+	StatusCode   int       `gorm:"not null" json:"status_code"`                       // 響應狀態碼
+	ContentType  string    `gorm:"type:varchar(255);not null" json:"content_type"`    // 響應類型
+	ResponseBody []byte    `gorm:"type:bytea" json:"response_body"`                   // 響應體
+	CreatedAt    time.Time `gorm:"type:timestamptz;not null" json:"created_at"`       // 佔用時間
+	ExpiresAt    time.Time `gorm:"type:timestamptz;not null;index" json:"expires_at"` // 過期時間
+}
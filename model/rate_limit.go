@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// RateLimitBucket 限流令牌桶，由 common.PostgresRateLimitStore 用原生SQL讀寫
+type RateLimitBucket struct {
+	Key       string    `gorm:"type:varchar(255);primaryKey" json:"key"`      // 路由+用戶標識
+	Tokens    float64   `gorm:"type:double precision;not null" json:"tokens"` // 剩餘令牌
+	Allowed   bool      `gorm:"not null" json:"allowed"`                      // 最近一次請求是否放行
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null;index" json:"updated_at"`
+}
@@ -9,20 +9,32 @@ import (
 )
 
 // RequestLog 請求日志Model，對應數據庫表request_logs
+// request_logs 按 created_at 每天分區，主鍵為 (id, created_at)，建表語句見 db.EnsureRequestLogPartitions
 type RequestLog struct {
-	ID              uint64         `gorm:"column:id;type:serial;primaryKey" json:"id"`                                        // 主鍵，自增
-	RequestID       string         `gorm:"column:request_id;type:varchar(64);not null;index" json:"request_id"`               // 請求唯一標識
-	Method          string         `gorm:"column:method;type:varchar(10);not null" json:"method"`                             // HTTP方法
-	Path            string         `gorm:"column:path;type:varchar(255);not null;index" json:"path"`                          // 請求路徑
-	QueryString     string         `gorm:"column:query_string;type:text" json:"query_string"`                                 // 查詢參數
-	StatusCode      int            `gorm:"column:status_code;not null" json:"status_code"`                                    // 響應狀態碼
-	RemoteIP        string         `gorm:"column:remote_ip;type:varchar(45);not null" json:"remote_ip"`                       // 客戶端IP
-	UserAgent       string         `gorm:"column:user_agent;type:text" json:"user_agent"`                                     // 用戶代理
-	RequestTime     float64        `gorm:"column:request_time;not null" json:"request_time"`                                  // 請求耗時（秒）
-	CreatedAt       time.Time      `gorm:"column:created_at;type:timestamptz;not null;default:now();index" json:"created_at"` // 日志創建時間（帶時區）
-	FileName        string         `gorm:"column:file_name;type:varchar(255)" json:"file_name"`                               // 上傳文件名
-	FileSize        int64          `gorm:"column:file_size" json:"file_size"`                                                 // 文件大小（字節）
-	FileContentJSON JSONRawMessage `gorm:"column:file_content_json;type:jsonb" json:"file_content_json"`                      // 文件内容（JSON格式）
+	ID              uint64         `gorm:"column:id;type:bigint;primaryKey" json:"id"`                                                   // 主鍵，取自 request_logs_id_seq
+	RequestID       string         `gorm:"column:request_id;type:varchar(64);not null;index" json:"request_id"`                          // 請求唯一標識
+	Method          string         `gorm:"column:method;type:varchar(10);not null" json:"method"`                                        // HTTP方法
+	ServiceName     string         `gorm:"column:service_name;type:varchar(255);index" json:"service_name"`                              // 服務名稱
+	Path            string         `gorm:"column:path;type:varchar(255);not null;index" json:"path"`                                     // 請求路徑
+	Route           string         `gorm:"column:route;type:varchar(255);index" json:"route"`                                            // 路由模板，如 /roles/:id
+	QueryString     string         `gorm:"column:query_string;type:text" json:"query_string"`                                            // 查詢參數
+	StatusCode      int            `gorm:"column:status_code;not null" json:"status_code"`                                               // 響應狀態碼
+	RemoteIP        string         `gorm:"column:remote_ip;type:varchar(45);not null" json:"remote_ip"`                                  // 客戶端IP
+	UserID          string         `gorm:"column:user_id;type:varchar(255)" json:"user_id"`                                              // 請求用戶的引用（common.UserRef），回放時用於還原身份
+	UserAgent       string         `gorm:"column:user_agent;type:text" json:"user_agent"`                                                // 用戶代理
+	RequestTime     float64        `gorm:"column:request_time;type:double precision;not null" json:"request_time"`                       // 請求耗時（秒）
+	CreatedAt       time.Time      `gorm:"column:created_at;type:timestamptz;not null;default:now();primaryKey;index" json:"created_at"` // 日志創建時間（帶時區），分區鍵
+	FileName        string         `gorm:"column:file_name;type:varchar(255)" json:"file_name"`                                          // 上傳文件名
+	FileSize        int64          `gorm:"column:file_size" json:"file_size"`                                                            // 文件大小（字節）
+	ContentType     string         `gorm:"column:content_type;type:varchar(45);not null;default:''" json:"content_type"`                 // 請求類型
+	FileContentJSON JSONRawMessage `gorm:"column:file_content_json;type:jsonb" json:"file_content_json"`                                 // 文件内容（JSON格式）
+	RequestBody     string         `gorm:"column:request_body;type:text" json:"request_body"`                                            // 請求體（已遮蔽敏感字段）
+	ResponseBody    string         `gorm:"column:response_body;type:text" json:"response_body"`                                          // 響應體（已遮蔽敏感字段）
+	BodyTruncated   bool           `gorm:"column:body_truncated;not null;default:false" json:"body_truncated"`                           // 請求體或響應體超過大小限制被截斷
+	RequestRedacted bool           `gorm:"column:request_redacted;not null;default:false" json:"request_redacted"`                       // 查詢參數、請求體或文件内容被遮蔽或改寫，和原請求不同
+	AllocBytes      int64          `gorm:"column:alloc_bytes" json:"alloc_bytes"`                                                        // 採樣請求期間的堆分配（字節），未採樣為 0
+	Goroutines      int            `gorm:"column:goroutines;type:integer" json:"goroutines"`                                             // 採樣請求結束時的 goroutine 數
+	CPUProfile      string         `gorm:"column:cpu_profile;type:varchar(255)" json:"cpu_profile"`                                      // 慢請求的 CPU profile 文件名
 }
 
 func (RequestLog) TableName() string {
@@ -39,6 +51,18 @@ func (j JSONRawMessage) Value() (driver.Value, error) {
 	return string(j), nil
 }
 
+// MarshalJSON 原樣輸出JSON内容，而不是按 []byte 編碼為 base64
+func (j JSONRawMessage) MarshalJSON() ([]byte, error) {
+	if j == nil {
+		return []byte("null"), nil
+	}
+	return json.RawMessage(j).MarshalJSON()
+}
+
+func (j *JSONRawMessage) UnmarshalJSON(data []byte) error {
+	return (*json.RawMessage)(j).UnmarshalJSON(data)
+}
+
 // Scan 實現sql.Scanner接口，將數據庫返回的JSON字符串轉為JSONRawMessage
 func (j *JSONRawMessage) Scan(value interface{}) error {
 	if value == nil {
@@ -52,6 +76,7 @@ func (j *JSONRawMessage) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, j)
 }
 
+// AutoMigrateRequestLog 只用於補齊轉換為分區表之前的舊表的列
 func AutoMigrateRequestLog(db *gorm.DB) error {
 	return db.AutoMigrate(&RequestLog{})
 }
@@ -0,0 +1,10 @@
+package model
+
+import "gorm.io/gorm"
+
+// User 用戶及其系統角色授權，Roles 為逗號分隔的 policy.Role
+type User struct {
+	gorm.Model
+	WxUserId string `gorm:"type:varchar(255);not null;uniqueIndex" json:"wx_user_id"`
+	Roles    string `gorm:"type:varchar(255);not null;default:'player'" json:"roles"`
+}
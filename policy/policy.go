@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrForbidden = errors.New("permission denied")
+
+// Role 用戶的系統角色（不是 COC 角色卡）
+type Role string
+
+const (
+	Player Role = "player" // 玩家：只能管理自己的角色卡
+	Keeper Role = "keeper" // 守秘人：可以查看所有玩家的角色卡，維護書籍
+	Admin  Role = "admin"  // 管理員：所有權限
+)
+
+// Permission 對資源的操作權限，":any" 結尾的權限不受所有者限制
+type Permission string
+
+const (
+	RoleRead      Permission = "roles:read"
+	RoleReadAny   Permission = "roles:read:any"
+	RoleCreate    Permission = "roles:create"
+	RoleUpdate    Permission = "roles:update"
+	RoleUpdateAny Permission = "roles:update:any"
+	RoleDelete    Permission = "roles:delete"
+	RoleDeleteAny Permission = "roles:delete:any"
+	BookRead      Permission = "books:read"
+	BookWrite     Permission = "books:write"
+	LogRead       Permission = "logs:read"
+)
+
+var grants = map[Role][]Permission{
+	Player: {RoleRead, RoleCreate, RoleUpdate, RoleDelete, BookRead},
+	Keeper: {RoleRead, RoleReadAny, RoleCreate, RoleUpdate, RoleDelete, BookRead, BookWrite},
+	Admin: {
+		RoleRead, RoleReadAny, RoleCreate, RoleUpdate, RoleUpdateAny, RoleDelete, RoleDeleteAny,
+		BookRead, BookWrite, LogRead,
+	},
+}
+
+// Subject 發起請求的用戶及其被授予的角色
+type Subject struct {
+	UserID string
+	Roles  []Role
+}
+
+func (s Subject) HasRole(role Role) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Subject) Can(p Permission) bool {
+	for _, r := range s.Roles {
+		for _, granted := range grants[r] {
+			if granted == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanAccess 判斷能否操作 owner 擁有的資源：自己的資源需要 own 權限，別人的需要 any 權限
+func (s Subject) CanAccess(owner string, own, any Permission) bool {
+	if owner != "" && owner == s.UserID && s.Can(own) {
+		return true
+	}
+	return s.Can(any)
+}
+
+func IsValidRole(role Role) bool {
+	_, ok := grants[role]
+	return ok
+}
+
+// ParseRoles 解析逗號分隔的角色列表，忽略未知角色
+func ParseRoles(value string) []Role {
+	var roles []Role
+	for _, item := range strings.Split(value, ",") {
+		role := Role(strings.TrimSpace(item))
+		if IsValidRole(role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func FormatRoles(roles []Role) string {
+	items := make([]string, 0, len(roles))
+	for _, r := range roles {
+		items = append(items, string(r))
+	}
+	return strings.Join(items, ",")
+}
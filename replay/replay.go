@@ -0,0 +1,312 @@
+// Package replay 把記錄的請求日志重新發送到目標服務，比較響應狀態碼
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"test-git/common"
+	"test-git/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 還原請求身份的方式
+const (
+	IdentitySession = "session" // 用會話密鑰為記錄的用戶簽發 Bearer 令牌
+	IdentityGateway = "gateway" // 模擬網關注入 X-WX-OPENID，配置了網關密鑰時附帶簽名
+	IdentityNone    = "none"
+)
+
+var (
+	errFileExpired    = errors.New("file content expired")
+	errBodyTruncated  = errors.New("captured body truncated")
+	errRedacted       = errors.New("captured request redacted")
+	errBodyMissing    = errors.New("request body not captured")
+	errAdminForbidden = errors.New("admin request without admin token")
+	errUserRef        = errors.New("user reference cannot be resolved")
+)
+
+type Options struct {
+	BaseURL       string
+	Speed         float64 // 1 為原始節奏，2 為兩倍速，0 不等待
+	Concurrency   int
+	Identity      string
+	SessionSecret []byte
+	GatewaySecret []byte
+	UserRefKey    []byte // 還原日志中用戶引用的密鑰，與服務的 REQUEST_LOG_USER_KEY（未設置時為 SESSION_SECRET）相同
+	AdminToken    string // 為空時跳過 /admin 下的請求
+	Client        *http.Client
+}
+
+// Mismatch 狀態碼與記錄不一致的請求
+type Mismatch struct {
+	RequestID string `json:"request_id"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Recorded  int    `json:"recorded"`
+	Actual    int    `json:"actual"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Total      int            `json:"total"`
+	Sent       int            `json:"sent"`
+	Matched    int            `json:"matched"`
+	Mismatched int            `json:"mismatched"`
+	Errors     int            `json:"errors"`
+	Skipped    map[string]int `json:"skipped"`     // 按原因統計沒有發送的請求
+	ByEndpoint map[string]int `json:"by_endpoint"` // "POST /roles/create 201->500" 的次數
+	Samples    []Mismatch     `json:"samples"`     // 最多保留的不一致樣本
+	Duration   string         `json:"duration"`
+}
+
+const maxSamples = 50
+
+// LoadFromDB 按時間順序讀取 [from, to) 内的請求日志
+func LoadFromDB(ctx context.Context, db *gorm.DB, from, to time.Time, limit int) ([]model.RequestLog, error) {
+	var logs []model.RequestLog
+	err := db.WithContext(ctx).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Order("created_at, id").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
+
+// ReadNDJSON 讀取文件或標準輸出輸出的 NDJSON 日志，只保留 [from, to) 内的記錄
+func ReadNDJSON(r io.Reader, from, to time.Time, limit int) ([]model.RequestLog, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 128<<20)
+	var logs []model.RequestLog
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var reqLog model.RequestLog
+		if err := json.Unmarshal(scanner.Bytes(), &reqLog); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if reqLog.CreatedAt.Before(from) || !reqLog.CreatedAt.Before(to) {
+			continue
+		}
+		logs = append(logs, reqLog)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].CreatedAt.Before(logs[j].CreatedAt) })
+	if limit > 0 && len(logs) > limit {
+		logs = logs[:limit]
+	}
+	return logs, nil
+}
+
+// Run 按記錄的時間間隔（除以 Speed）發送請求，ctx 取消後停止發送新請求
+func Run(ctx context.Context, logs []model.RequestLog, opts Options) *Report {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	var signer *common.SessionSigner
+	if opts.Identity == IdentitySession {
+		signer = common.NewSessionSigner(opts.SessionSecret, time.Hour)
+	}
+
+	report := &Report{
+		Total:      len(logs),
+		Skipped:    make(map[string]int),
+		ByEndpoint: make(map[string]int),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Concurrency)
+	start := time.Now()
+
+	for _, reqLog := range logs {
+		if opts.Speed > 0 && len(logs) > 0 {
+			offset := time.Duration(float64(reqLog.CreatedAt.Sub(logs[0].CreatedAt)) / opts.Speed)
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		req, err := BuildRequest(ctx, reqLog, opts, signer)
+		if err != nil {
+			mu.Lock()
+			report.Skipped[err.Error()]++
+			mu.Unlock()
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(reqLog model.RequestLog, req *http.Request) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			status, err := send(opts.Client, req)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Sent++
+			if err == nil && status == reqLog.StatusCode {
+				report.Matched++
+				return
+			}
+			m := Mismatch{
+				RequestID: reqLog.RequestID,
+				Method:    reqLog.Method,
+				Path:      reqLog.Path,
+				Recorded:  reqLog.StatusCode,
+				Actual:    status,
+			}
+			if err != nil {
+				report.Errors++
+				m.Error = err.Error()
+			} else {
+				report.Mismatched++
+			}
+			report.ByEndpoint[fmt.Sprintf("%s %s %d->%d", reqLog.Method, endpoint(reqLog), reqLog.StatusCode, status)]++
+			if len(report.Samples) < maxSamples {
+				report.Samples = append(report.Samples, m)
+			}
+		}(reqLog, req)
+	}
+	wg.Wait()
+	report.Duration = time.Since(start).Round(time.Millisecond).String()
+	return report
+}
+
+func send(client *http.Client, req *http.Request) (int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func endpoint(reqLog model.RequestLog) string {
+	if reqLog.Route != "" {
+		return reqLog.Route
+	}
+	return reqLog.Path
+}
+
+// BuildRequest 根據日志還原請求：路徑、查詢參數、身份，以及記錄的請求體或上傳文件
+func BuildRequest(ctx context.Context, reqLog model.RequestLog, opts Options, signer *common.SessionSigner) (*http.Request, error) {
+	target, err := url.Parse(strings.TrimRight(opts.BaseURL, "/") + reqLog.Path)
+	if err != nil {
+		return nil, err
+	}
+	target.RawQuery = reqLog.QueryString
+
+	// 遮蔽過的查詢參數、請求體或文件内容和原請求不同，發送出去的結果沒有對比意義
+	if reqLog.RequestRedacted {
+		return nil, errRedacted
+	}
+	body, contentType, err := requestBody(reqLog)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, reqLog.Method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if reqLog.UserAgent != "" {
+		req.Header.Set("User-Agent", reqLog.UserAgent)
+	}
+	req.Header.Set("X-Replay-Of", reqLog.RequestID)
+
+	if strings.HasPrefix(reqLog.Path, "/admin/") || reqLog.Path == "/admin" {
+		if opts.AdminToken == "" {
+			return nil, errAdminForbidden
+		}
+		req.Header.Set(common.AdminToken, opts.AdminToken)
+		return req, nil
+	}
+	if reqLog.UserID == "" || opts.Identity == IdentityNone {
+		return req, nil
+	}
+	userID, err := common.ResolveUserRef(opts.UserRefKey, reqLog.UserID)
+	if err != nil {
+		return nil, errUserRef
+	}
+
+	switch opts.Identity {
+	case IdentitySession:
+		token, _, err := signer.Issue(common.SessionClaims{OpenID: userID})
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case IdentityGateway:
+		req.Header.Set(common.WxOpenID, userID)
+		if len(opts.GatewaySecret) > 0 {
+			ts := time.Now().Unix()
+			req.Header.Set(common.WxTimestamp, strconv.FormatInt(ts, 10))
+			req.Header.Set(common.WxSignature, common.SignIdentityHeaders(opts.GatewaySecret, userID, "", "", "", ts))
+		}
+	}
+	return req, nil
+}
+
+func requestBody(reqLog model.RequestLog) (io.Reader, string, error) {
+	if reqLog.FileName != "" {
+		if len(reqLog.FileContentJSON) == 0 {
+			return nil, "", errFileExpired
+		}
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		part, err := w.CreateFormFile("file", reqLog.FileName)
+		if err != nil {
+			return nil, "", err
+		}
+		part.Write(reqLog.FileContentJSON)
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		return &buf, w.FormDataContentType(), nil
+	}
+
+	if reqLog.BodyTruncated {
+		return nil, "", errBodyTruncated
+	}
+	if reqLog.RequestBody != "" {
+		return strings.NewReader(reqLog.RequestBody), reqLog.ContentType, nil
+	}
+	switch reqLog.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		// 有請求類型說明原請求帶了請求體，但沒有記錄下來
+		if reqLog.ContentType != "" {
+			return nil, "", errBodyMissing
+		}
+	}
+	return http.NoBody, "", nil
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"test-git/db"
+	"test-git/model"
+
+	"gorm.io/gorm"
+)
+
+type GormRoleRepository struct {
+	db *gorm.DB
+}
+
+func NewGormRoleRepository(db *gorm.DB) *GormRoleRepository {
+	return &GormRoleRepository{db: db}
+}
+
+func (r *GormRoleRepository) List(ctx context.Context, filter RoleFilter, offset, limit int) ([]model.Role, int64, error) {
+	// Count 會修改查詢條件，統計和分頁各自構造查詢
+	query := func() *gorm.DB {
+		tx := r.db.WithContext(ctx).Model(&model.Role{})
+		switch filter.Deleted {
+		case DeletedInclude:
+			tx = tx.Unscoped()
+		case DeletedOnly:
+			tx = tx.Unscoped().Where("deleted_at IS NOT NULL")
+		}
+		if filter.WxUserID != "" {
+			tx = tx.Where("wx_user_id = ?", filter.WxUserID)
+		}
+		if filter.Keyword != "" {
+			like := "%" + db.EscapeLike(filter.Keyword) + "%"
+			tx = tx.Where("name ILIKE ? OR description ILIKE ?", like, like)
+		}
+		return tx
+	}
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	order := "id"
+	switch filter.Order {
+	case OrderIDDesc:
+		order = "id DESC"
+	case OrderUpdatedDesc:
+		order = "updated_at DESC, id DESC"
+	}
+	var roles []model.Role
+	if err := query().Order(order).Offset(offset).Limit(limit).Find(&roles).Error; err != nil {
+		return nil, 0, err
+	}
+	return roles, total, nil
+}
+
+func (r *GormRoleRepository) Get(ctx context.Context, id uint) (*model.Role, error) {
+	var role model.Role
+	if err := r.db.WithContext(ctx).First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *GormRoleRepository) GetUnscoped(ctx context.Context, id uint) (*model.Role, error) {
+	var role model.Role
+	if err := r.db.WithContext(ctx).Unscoped().First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *GormRoleRepository) Create(ctx context.Context, role *model.Role) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+func (r *GormRoleRepository) Update(ctx context.Context, id uint, changes *model.Role) error {
+	return updates(r.db.WithContext(ctx).Model(&model.Role{}), id, changes)
+}
+
+func (r *GormRoleRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&model.Role{}, id).Error
+}
+
+func (r *GormRoleRepository) HardDelete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Unscoped().Delete(&model.Role{}, id).Error
+}
+
+func (r *GormRoleRepository) Restore(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Unscoped().Model(&model.Role{}).Where("id = ?", id).Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+type GormBookRepository struct {
+	db *gorm.DB
+}
+
+func NewGormBookRepository(db *gorm.DB) *GormBookRepository {
+	return &GormBookRepository{db: db}
+}
+
+func (r *GormBookRepository) List(ctx context.Context, offset, limit int) ([]model.Book, int64, error) {
+	tx := r.db.WithContext(ctx)
+	var total int64
+	if err := tx.Model(&model.Book{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var books []model.Book
+	if err := tx.Order("id").Offset(offset).Limit(limit).Find(&books).Error; err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+func (r *GormBookRepository) Get(ctx context.Context, id uint) (*model.Book, error) {
+	var book model.Book
+	if err := r.db.WithContext(ctx).First(&book, id).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (r *GormBookRepository) Create(ctx context.Context, book *model.Book) error {
+	return r.db.WithContext(ctx).Create(book).Error
+}
+
+func (r *GormBookRepository) Update(ctx context.Context, id uint, changes *model.Book) error {
+	return updates(r.db.WithContext(ctx).Model(&model.Book{}), id, changes)
+}
+
+func (r *GormBookRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&model.Book{}, id).Error
+}
+
+func (r *GormBookRepository) HardDelete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Unscoped().Delete(&model.Book{}, id).Error
+}
+
+// updates 按結構體更新非零字段，沒有匹配的行（不存在或已刪除）時返回 gorm.ErrRecordNotFound
+func updates(tx *gorm.DB, id uint, changes interface{}) error {
+	result := tx.Where("id = ?", id).Updates(changes)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+func NewGormUserRepository(db *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{db: db}
+}
+
+func (r *GormUserRepository) FindByWxUserID(ctx context.Context, wxUserID string) (*model.User, error) {
+	var user model.User
+	if err := r.db.WithContext(ctx).Where("wx_user_id = ?", wxUserID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *GormUserRepository) FirstOrCreate(ctx context.Context, user *model.User) (bool, error) {
+	result := r.db.WithContext(ctx).Where(model.User{WxUserId: user.WxUserId}).FirstOrCreate(user)
+	return result.RowsAffected > 0, result.Error
+}
+
+type GormAuditRepository struct {
+	db *gorm.DB
+}
+
+func NewGormAuditRepository(db *gorm.DB) *GormAuditRepository {
+	return &GormAuditRepository{db: db}
+}
+
+func (r *GormAuditRepository) Create(ctx context.Context, audit *model.AdminAudit) error {
+	return r.db.WithContext(ctx).Create(audit).Error
+}
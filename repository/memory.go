@@ -0,0 +1,377 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"test-git/model"
+	"test-git/policy"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryRoleRepository 進程內的角色存取，只適用於測試和單副本的開發環境
+type MemoryRoleRepository struct {
+	table *table[model.Role]
+}
+
+func NewMemoryRoleRepository() *MemoryRoleRepository {
+	return &MemoryRoleRepository{table: newTable(
+		func(r *model.Role) *gorm.Model { return &r.Model },
+		func(r model.Role) model.Role {
+			r.RoleData = append([]byte(nil), r.RoleData...)
+			return r
+		},
+	)}
+}
+
+func (r *MemoryRoleRepository) List(_ context.Context, filter RoleFilter, offset, limit int) ([]model.Role, int64, error) {
+	keyword := strings.ToLower(filter.Keyword)
+	match := func(role *model.Role) bool {
+		if filter.Deleted == DeletedOnly && !role.DeletedAt.Valid {
+			return false
+		}
+		if filter.WxUserID != "" && role.WxUserId != filter.WxUserID {
+			return false
+		}
+		return keyword == "" ||
+			strings.Contains(strings.ToLower(role.Name), keyword) ||
+			strings.Contains(strings.ToLower(role.Description), keyword)
+	}
+	var less func(a, b *model.Role) bool
+	switch filter.Order {
+	case OrderIDDesc:
+		less = func(a, b *model.Role) bool { return a.ID > b.ID }
+	case OrderUpdatedDesc:
+		less = func(a, b *model.Role) bool {
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.After(b.UpdatedAt)
+			}
+			return a.ID > b.ID
+		}
+	}
+	unscoped := filter.Deleted == DeletedInclude || filter.Deleted == DeletedOnly
+	roles, total := r.table.list(unscoped, match, less, offset, limit)
+	return roles, total, nil
+}
+
+func (r *MemoryRoleRepository) Get(_ context.Context, id uint) (*model.Role, error) {
+	return r.table.get(id, false)
+}
+
+func (r *MemoryRoleRepository) GetUnscoped(_ context.Context, id uint) (*model.Role, error) {
+	return r.table.get(id, true)
+}
+
+func (r *MemoryRoleRepository) Create(_ context.Context, role *model.Role) error {
+	return r.table.create(role)
+}
+
+func (r *MemoryRoleRepository) Update(_ context.Context, id uint, changes *model.Role) error {
+	return r.table.update(id, func(role *model.Role) {
+		if changes.Name != "" {
+			role.Name = changes.Name
+		}
+		if changes.WxUserId != "" {
+			role.WxUserId = changes.WxUserId
+		}
+		if changes.AvatarUrl != "" {
+			role.AvatarUrl = changes.AvatarUrl
+		}
+		if changes.Description != "" {
+			role.Description = changes.Description
+		}
+		if len(changes.RoleData) > 0 {
+			role.RoleData = append([]byte(nil), changes.RoleData...)
+		}
+	})
+}
+
+func (r *MemoryRoleRepository) Delete(_ context.Context, id uint) error {
+	r.table.softDelete(id)
+	return nil
+}
+
+func (r *MemoryRoleRepository) HardDelete(_ context.Context, id uint) error {
+	r.table.hardDelete(id)
+	return nil
+}
+
+func (r *MemoryRoleRepository) Restore(_ context.Context, id uint) error {
+	return r.table.restore(id)
+}
+
+// MemoryBookRepository 進程內的書籍存取
+type MemoryBookRepository struct {
+	table *table[model.Book]
+}
+
+func NewMemoryBookRepository() *MemoryBookRepository {
+	return &MemoryBookRepository{table: newTable(
+		func(b *model.Book) *gorm.Model { return &b.Model },
+		func(b model.Book) model.Book { return b },
+	)}
+}
+
+func (r *MemoryBookRepository) List(_ context.Context, offset, limit int) ([]model.Book, int64, error) {
+	books, total := r.table.list(false, func(*model.Book) bool { return true }, nil, offset, limit)
+	return books, total, nil
+}
+
+func (r *MemoryBookRepository) Get(_ context.Context, id uint) (*model.Book, error) {
+	return r.table.get(id, false)
+}
+
+func (r *MemoryBookRepository) Create(_ context.Context, book *model.Book) error {
+	return r.table.create(book)
+}
+
+func (r *MemoryBookRepository) Update(_ context.Context, id uint, changes *model.Book) error {
+	return r.table.update(id, func(book *model.Book) {
+		if changes.Title != "" {
+			book.Title = changes.Title
+		}
+		if changes.Author != "" {
+			book.Author = changes.Author
+		}
+		if changes.Price != 0 {
+			book.Price = changes.Price
+		}
+		if changes.Description != "" {
+			book.Description = changes.Description
+		}
+	})
+}
+
+func (r *MemoryBookRepository) Delete(_ context.Context, id uint) error {
+	r.table.softDelete(id)
+	return nil
+}
+
+func (r *MemoryBookRepository) HardDelete(_ context.Context, id uint) error {
+	r.table.hardDelete(id)
+	return nil
+}
+
+// MemoryUserRepository 進程內的用戶存取
+type MemoryUserRepository struct {
+	mu    sync.Mutex
+	table *table[model.User]
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{table: newTable(
+		func(u *model.User) *gorm.Model { return &u.Model },
+		func(u model.User) model.User { return u },
+	)}
+}
+
+func (r *MemoryUserRepository) FindByWxUserID(_ context.Context, wxUserID string) (*model.User, error) {
+	return r.table.find(func(u *model.User) bool { return u.WxUserId == wxUserID })
+}
+
+func (r *MemoryUserRepository) FirstOrCreate(_ context.Context, user *model.User) (bool, error) {
+	// 查找和創建需要在同一把鎖內，對應數據庫的唯一索引
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, err := r.table.find(func(u *model.User) bool { return u.WxUserId == user.WxUserId })
+	if err == nil {
+		*user = *existing
+		return false, nil
+	}
+	if user.Roles == "" {
+		user.Roles = string(policy.Player)
+	}
+	return true, r.table.create(user)
+}
+
+// MemoryAuditRepository 進程內的審計記錄
+type MemoryAuditRepository struct {
+	mu     sync.Mutex
+	audits []model.AdminAudit
+}
+
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (r *MemoryAuditRepository) Create(_ context.Context, audit *model.AdminAudit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	audit.ID = uint64(len(r.audits)) + 1
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = time.Now()
+	}
+	r.audits = append(r.audits, *audit)
+	return nil
+}
+
+// List 按寫入順序返回全部審計記錄
+func (r *MemoryAuditRepository) List() []model.AdminAudit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]model.AdminAudit(nil), r.audits...)
+}
+
+// snapshot 記錄只追加，回滾時截斷到快照時的長度
+func (r *MemoryAuditRepository) snapshot() func() {
+	r.mu.Lock()
+	n := len(r.audits)
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.audits = r.audits[:n]
+	}
+}
+
+// table 按 ID 保存記錄，軟刪除和時間戳的處理與 gorm.Model 一致，讀寫都複製一份，調用方修改返回值不影響存儲
+type table[T any] struct {
+	mu     sync.RWMutex
+	rows   map[uint]T
+	nextID uint
+	base   func(*T) *gorm.Model
+	clone  func(T) T
+}
+
+func newTable[T any](base func(*T) *gorm.Model, clone func(T) T) *table[T] {
+	return &table[T]{rows: make(map[uint]T), nextID: 1, base: base, clone: clone}
+}
+
+func (t *table[T]) live(row *T) bool {
+	return !t.base(row).DeletedAt.Valid
+}
+
+// sorted 返回滿足條件的記錄，unscoped 時包含已軟刪除的記錄；less 為空時按 ID 升序。調用方需持有鎖
+func (t *table[T]) sorted(unscoped bool, match func(*T) bool, less func(a, b *T) bool) []T {
+	var rows []T
+	for _, row := range t.rows {
+		if (unscoped || t.live(&row)) && match(&row) {
+			rows = append(rows, t.clone(row))
+		}
+	}
+	if less == nil {
+		less = func(a, b *T) bool { return t.base(a).ID < t.base(b).ID }
+	}
+	sort.Slice(rows, func(i, j int) bool { return less(&rows[i], &rows[j]) })
+	return rows
+}
+
+// list 分頁規則與 gorm 相同：offset 小於等於 0 從頭開始，limit 小於 0 不限制
+func (t *table[T]) list(unscoped bool, match func(*T) bool, less func(a, b *T) bool, offset, limit int) ([]T, int64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	rows := t.sorted(unscoped, match, less)
+	total := int64(len(rows))
+	if offset > 0 {
+		rows = rows[min(offset, len(rows)):]
+	}
+	if limit >= 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows, total
+}
+
+func (t *table[T]) get(id uint, unscoped bool) (*T, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	row, ok := t.rows[id]
+	if !ok || !(unscoped || t.live(&row)) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	row = t.clone(row)
+	return &row, nil
+}
+
+func (t *table[T]) find(match func(*T) bool) (*T, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	rows := t.sorted(false, match, nil)
+	if len(rows) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &rows[0], nil
+}
+
+// create 分配 ID 並填寫創建、更新時間，回寫到 row
+func (t *table[T]) create(row *T) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := t.base(row)
+	if m.ID == 0 {
+		m.ID = t.nextID
+	} else if _, ok := t.rows[m.ID]; ok {
+		return fmt.Errorf("duplicate primary key %d", m.ID)
+	}
+	t.nextID = max(t.nextID, m.ID+1)
+	now := time.Now()
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = now
+	}
+	if m.UpdatedAt.IsZero() {
+		m.UpdatedAt = now
+	}
+	t.rows[m.ID] = t.clone(*row)
+	return nil
+}
+
+func (t *table[T]) update(id uint, apply func(*T)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row, ok := t.rows[id]
+	if !ok || !t.live(&row) {
+		return gorm.ErrRecordNotFound
+	}
+	apply(&row)
+	t.base(&row).UpdatedAt = time.Now()
+	t.rows[id] = row
+	return nil
+}
+
+func (t *table[T]) softDelete(id uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if row, ok := t.rows[id]; ok && t.live(&row) {
+		t.base(&row).DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		t.rows[id] = row
+	}
+}
+
+func (t *table[T]) hardDelete(id uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.rows, id)
+}
+
+func (t *table[T]) restore(id uint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row, ok := t.rows[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	t.base(&row).DeletedAt = gorm.DeletedAt{}
+	t.base(&row).UpdatedAt = time.Now()
+	t.rows[id] = row
+	return nil
+}
+
+// snapshot 複製當前的全部記錄，返回的函數把表恢復到複製時的狀態
+func (t *table[T]) snapshot() func() {
+	t.mu.RLock()
+	rows := make(map[uint]T, len(t.rows))
+	for id, row := range t.rows {
+		rows[id] = t.clone(row)
+	}
+	nextID := t.nextID
+	t.mu.RUnlock()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.rows = rows
+		t.nextID = nextID
+	}
+}
@@ -0,0 +1,172 @@
+// Package repository 角色、書籍、用戶和審計記錄的存取接口，service 只依賴這裡的接口
+//
+// GormXxxRepository 讀寫 Postgres；MemoryXxxRepository 把數據放在進程內，
+// 行為與 gorm 實現一致（軟刪除、按所有者過濾、找不到時返回 gorm.ErrRecordNotFound），
+// 用於單元測試和 STORE=memory 的開發模式。
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"test-git/model"
+
+	"gorm.io/gorm"
+)
+
+// 存儲後端
+const (
+	StorePostgres = "postgres"
+	StoreMemory   = "memory"
+)
+
+// StoreConfig 業務數據的存儲後端
+//
+//	STORE=postgres   默認，使用主庫
+//	STORE=memory     數據只保存在進程內，重啟後丟失，不需要部署數據庫
+type StoreConfig struct {
+	Kind string
+}
+
+func LoadStoreConfig(lookup func(string) (string, bool)) (StoreConfig, error) {
+	cfg := StoreConfig{Kind: StorePostgres}
+	if v, _ := lookup("STORE"); v != "" {
+		if v != StorePostgres && v != StoreMemory {
+			return cfg, fmt.Errorf("invalid STORE %q", v)
+		}
+		cfg.Kind = v
+	}
+	return cfg, nil
+}
+
+// 已軟刪除記錄的查詢範圍
+const (
+	DeletedExclude = ""        // 只查未刪除
+	DeletedInclude = "include" // 包含已刪除
+	DeletedOnly    = "only"    // 只查已刪除
+)
+
+// 角色列表的排序
+const (
+	OrderIDAsc       = ""             // ID 升序
+	OrderIDDesc      = "id_desc"      // ID 降序
+	OrderUpdatedDesc = "updated_desc" // 最近更新的在前
+)
+
+// RoleFilter 查詢角色的條件，零值表示不過濾、只查未刪除、按 ID 升序
+type RoleFilter struct {
+	WxUserID string
+	Keyword  string // 按字面、不區分大小寫匹配名稱和描述
+	Deleted  string
+	Order    string
+}
+
+// RoleRepository 角色存取，除 Deleted 過濾、GetUnscoped 和 Restore 外不包含已軟刪除的角色
+type RoleRepository interface {
+	// List 分頁查詢，total 是過濾後的總數；limit 小於 0 表示不限制
+	List(ctx context.Context, filter RoleFilter, offset, limit int) (roles []model.Role, total int64, err error)
+	Get(ctx context.Context, id uint) (*model.Role, error)
+	// GetUnscoped 與 Get 相同，但包含已軟刪除的角色
+	GetUnscoped(ctx context.Context, id uint) (*model.Role, error)
+	// Create 寫入後回填 ID 和創建時間
+	Create(ctx context.Context, role *model.Role) error
+	// Update 只更新 changes 中的非零字段
+	Update(ctx context.Context, id uint, changes *model.Role) error
+	// Delete 軟刪除，角色不存在時不報錯
+	Delete(ctx context.Context, id uint) error
+	HardDelete(ctx context.Context, id uint) error
+	// Restore 撤銷軟刪除，角色不存在時返回 gorm.ErrRecordNotFound
+	Restore(ctx context.Context, id uint) error
+}
+
+// BookRepository 書籍存取，不包含已軟刪除的書籍
+type BookRepository interface {
+	List(ctx context.Context, offset, limit int) (books []model.Book, total int64, err error)
+	Get(ctx context.Context, id uint) (*model.Book, error)
+	Create(ctx context.Context, book *model.Book) error
+	Update(ctx context.Context, id uint, changes *model.Book) error
+	Delete(ctx context.Context, id uint) error
+	HardDelete(ctx context.Context, id uint) error
+}
+
+// UserRepository 用戶存取，用於登錄和加載授權
+type UserRepository interface {
+	FindByWxUserID(ctx context.Context, wxUserID string) (*model.User, error)
+	// FirstOrCreate 按 WxUserId 查找用戶，不存在時用 user 創建，created 表示是否新建
+	FirstOrCreate(ctx context.Context, user *model.User) (created bool, err error)
+}
+
+// AuditRepository 管理員操作審計記錄，只追加
+type AuditRepository interface {
+	// Create 寫入後回填 ID
+	Create(ctx context.Context, audit *model.AdminAudit) error
+}
+
+// Repositories service 層使用的全部存取接口
+type Repositories struct {
+	Roles  RoleRepository
+	Books  BookRepository
+	Users  UserRepository
+	Audits AuditRepository
+
+	transact func(ctx context.Context, fn func(tx Repositories) error) error
+}
+
+// Transaction 在一個事務中執行 fn，fn 返回錯誤時撤銷其中的全部寫入；fn 內只能使用參數 tx 訪問數據。
+// 沒有事務支持的 Repositories（例如測試中手工組裝的）直接執行 fn
+func (r Repositories) Transaction(ctx context.Context, fn func(tx Repositories) error) error {
+	if r.transact == nil {
+		return fn(r)
+	}
+	return r.transact(ctx, fn)
+}
+
+// New 按配置創建存取接口，memory 時忽略 db
+func New(cfg StoreConfig, db *gorm.DB) Repositories {
+	if cfg.Kind == StoreMemory {
+		return NewMemory()
+	}
+	return NewGorm(db)
+}
+
+func NewGorm(db *gorm.DB) Repositories {
+	repos := Repositories{
+		Roles:  NewGormRoleRepository(db),
+		Books:  NewGormBookRepository(db),
+		Users:  NewGormUserRepository(db),
+		Audits: NewGormAuditRepository(db),
+	}
+	repos.transact = func(ctx context.Context, fn func(tx Repositories) error) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(NewGorm(tx))
+		})
+	}
+	return repos
+}
+
+// NewMemory 創建進程內的存取接口。事務互斥執行，失敗時把所有表恢復到事務開始時的狀態，
+// 期間事務外的寫入也會一併撤銷，所以只適用於測試和開發環境
+func NewMemory() Repositories {
+	roles := NewMemoryRoleRepository()
+	books := NewMemoryBookRepository()
+	users := NewMemoryUserRepository()
+	audits := NewMemoryAuditRepository()
+	repos := Repositories{Roles: roles, Books: books, Users: users, Audits: audits}
+
+	// fn 拿到的 tx 不帶事務，嵌套的 Transaction 直接在外層事務中執行，不會重複加鎖
+	tx := repos
+	var mu sync.Mutex
+	repos.transact = func(_ context.Context, fn func(tx Repositories) error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		restores := []func(){roles.table.snapshot(), books.table.snapshot(), users.table.snapshot(), audits.snapshot()}
+		if err := fn(tx); err != nil {
+			for _, restore := range restores {
+				restore()
+			}
+			return err
+		}
+		return nil
+	}
+	return repos
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"test-git/common"
+	"test-git/model"
+	"test-git/policy"
+	"test-git/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AuditSearchRoles   = "roles.search"
+	AuditTransferRole  = "roles.transfer"
+	AuditRestoreRole   = "roles.restore"
+	AuditViewUserStats = "users.stats"
+)
+
+var ErrRoleNotDeleted = errors.New("角色未被删除")
+
+// AdminActor 執行管理操作的人，寫入審計記錄
+type AdminActor struct {
+	Name     string
+	RemoteIP string
+}
+
+// AdminRoleFilter 跨用戶查詢角色的條件，零值表示不過濾
+type AdminRoleFilter struct {
+	WxUserID string `json:"wx_user_id,omitempty"`
+	Keyword  string `json:"keyword,omitempty"` // 模糊匹配角色名稱和描述
+	Deleted  string `json:"deleted,omitempty"` // "" 只查未刪除，"include" 包含已刪除，"only" 只查已刪除
+}
+
+// UserStats 單個用戶的角色統計
+type UserStats struct {
+	WxUserID      string
+	Roles         string
+	RegisteredAt  *time.Time
+	ActiveRoles   int64
+	DeletedRoles  int64
+	LastUpdatedAt *time.Time
+}
+
+// AdminService 管理後台跨用戶的角色操作，每次操作都寫審計記錄
+type AdminService struct {
+	repos repository.Repositories
+}
+
+func NewAdminService(repos repository.Repositories) *AdminService {
+	return &AdminService{repos: repos}
+}
+
+func (s *AdminService) SearchRoles(ctx context.Context, actor AdminActor, filter AdminRoleFilter, page, pageSize int) ([]model.Role, int64, error) {
+	ctx, span := common.StartSpan(ctx, "service.SearchRoles")
+	defer span.End()
+	offset := (page - 1) * pageSize
+	roles, total, err := s.repos.Roles.List(ctx, repository.RoleFilter{
+		WxUserID: filter.WxUserID,
+		Keyword:  filter.Keyword,
+		Deleted:  filter.Deleted,
+		Order:    repository.OrderIDDesc,
+	}, offset, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = recordAudit(ctx, s.repos.Audits, actor, AuditSearchRoles, "role", "", map[string]interface{}{
+		"filter": filter,
+		"page":   page,
+		"total":  total,
+	})
+	return roles, total, err
+}
+
+// TransferRole 把角色轉給另一個用戶，目標用戶不存在時以 player 身份創建，並記錄在審計中
+func (s *AdminService) TransferRole(ctx context.Context, actor AdminActor, id uint, toWxUserID string) (*model.Role, error) {
+	ctx, span := common.StartSpan(ctx, "service.TransferRole")
+	defer span.End()
+	var role *model.Role
+	err := s.repos.Transaction(ctx, func(tx repository.Repositories) error {
+		current, err := tx.Roles.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		target := model.User{WxUserId: toWxUserID, Roles: string(policy.Player)}
+		created, err := tx.Users.FirstOrCreate(ctx, &target)
+		if err != nil {
+			return err
+		}
+		if created {
+			logger(ctx).Info("transfer target user created", "admin", actor.Name, "user_id", target.ID)
+		}
+
+		if err := tx.Roles.Update(ctx, id, &model.Role{WxUserId: toWxUserID}); err != nil {
+			return err
+		}
+		if role, err = tx.Roles.Get(ctx, id); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx.Audits, actor, AuditTransferRole, "role", strconv.FormatUint(uint64(id), 10), map[string]interface{}{
+			"from_wx_user_id":     current.WxUserId,
+			"to_wx_user_id":       toWxUserID,
+			"target_user_created": created,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger(ctx).Info("role transferred", "admin", actor.Name, "role_id", id, "to", toWxUserID)
+	return role, nil
+}
+
+// RestoreRole 恢復被軟刪除的角色
+func (s *AdminService) RestoreRole(ctx context.Context, actor AdminActor, id uint) (*model.Role, error) {
+	ctx, span := common.StartSpan(ctx, "service.RestoreRole")
+	defer span.End()
+	var role *model.Role
+	err := s.repos.Transaction(ctx, func(tx repository.Repositories) error {
+		deleted, err := tx.Roles.GetUnscoped(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !deleted.DeletedAt.Valid {
+			return ErrRoleNotDeleted
+		}
+
+		if err := tx.Roles.Restore(ctx, id); err != nil {
+			return err
+		}
+		if role, err = tx.Roles.Get(ctx, id); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx.Audits, actor, AuditRestoreRole, "role", strconv.FormatUint(uint64(id), 10), map[string]interface{}{
+			"wx_user_id": role.WxUserId,
+			"deleted_at": deleted.DeletedAt.Time,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger(ctx).Info("role restored", "admin", actor.Name, "role_id", id)
+	return role, nil
+}
+
+func (s *AdminService) GetUserStats(ctx context.Context, actor AdminActor, wxUserID string) (*UserStats, error) {
+	ctx, span := common.StartSpan(ctx, "service.GetUserStats")
+	defer span.End()
+	stats := &UserStats{WxUserID: wxUserID}
+
+	user, err := s.repos.Users.FindByWxUserID(ctx, wxUserID)
+	if err == nil {
+		stats.Roles = user.Roles
+		stats.RegisteredAt = &user.CreatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// limit 為 0 只統計總數
+	if _, stats.ActiveRoles, err = s.repos.Roles.List(ctx, repository.RoleFilter{WxUserID: wxUserID}, 0, 0); err != nil {
+		return nil, err
+	}
+	deleted := repository.RoleFilter{WxUserID: wxUserID, Deleted: repository.DeletedOnly}
+	if _, stats.DeletedRoles, err = s.repos.Roles.List(ctx, deleted, 0, 0); err != nil {
+		return nil, err
+	}
+
+	latest := repository.RoleFilter{WxUserID: wxUserID, Deleted: repository.DeletedInclude, Order: repository.OrderUpdatedDesc}
+	last, _, err := s.repos.Roles.List(ctx, latest, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(last) > 0 {
+		stats.LastUpdatedAt = &last[0].UpdatedAt
+	}
+
+	if err := recordAudit(ctx, s.repos.Audits, actor, AuditViewUserStats, "user", wxUserID, nil); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func recordAudit(ctx context.Context, audits repository.AuditRepository, actor AdminActor, action, targetType, targetID string, detail interface{}) error {
+	audit := model.AdminAudit{
+		Actor:      actor.Name,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RemoteIP:   actor.RemoteIP,
+		CreatedAt:  time.Now(),
+	}
+	if detail != nil {
+		raw, err := json.Marshal(detail)
+		if err != nil {
+			return err
+		}
+		audit.Detail = raw
+	}
+	return audits.Create(ctx, &audit)
+}
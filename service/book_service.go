@@ -1,52 +1,89 @@
 package service
 
 import (
-	"test-git/db"
+	"context"
+	"errors"
+	"test-git/common"
 	"test-git/model"
+	"test-git/policy"
+	"test-git/repository"
+
+	"gorm.io/gorm"
 )
 
-func CreateBook(book *model.Book) error {
-	return db.DB.Create(book).Error
+type BookService struct {
+	books repository.BookRepository
 }
 
-func GetBookByID(id uint) (*model.Book, error) {
-	var book model.Book
-	result := db.DB.First(&book, id)
-	if result.Error != nil {
-		return nil, result.Error
-	}
-	return &book, nil
+func NewBookService(books repository.BookRepository) *BookService {
+	return &BookService{books: books}
 }
 
-func GetAllBooks(page, pageSize int) ([]model.Book, int64, error) {
-	var books []model.Book
-	var total int64
+func (s *BookService) CreateBook(ctx context.Context, book *model.Book, subject policy.Subject) error {
+	ctx, span := common.StartSpan(ctx, "service.CreateBook")
+	defer span.End()
+	if !subject.Can(policy.BookWrite) {
+		return policy.ErrForbidden
+	}
+	if err := s.books.Create(ctx, book); err != nil {
+		logger(ctx).Error("create book fails", "err", err)
+		return err
+	}
+	logger(ctx).Info("book created", "book_id", book.ID)
+	return nil
+}
 
-	if err := db.DB.Model(&model.Book{}).Count(&total).Error; err != nil {
-		return nil, 0, err
+func (s *BookService) GetBookByID(ctx context.Context, id uint, subject policy.Subject) (*model.Book, error) {
+	ctx, span := common.StartSpan(ctx, "service.GetBookByID")
+	defer span.End()
+	if !subject.Can(policy.BookRead) {
+		return nil, policy.ErrForbidden
 	}
+	return s.books.Get(ctx, id)
+}
 
-	offset := (page - 1) * pageSize
-	if err := db.DB.Offset(offset).Limit(pageSize).Find(&books).Error; err != nil {
-		return nil, 0, err
+func (s *BookService) GetAllBooks(ctx context.Context, subject policy.Subject, page, pageSize int) ([]model.Book, int64, error) {
+	ctx, span := common.StartSpan(ctx, "service.GetAllBooks")
+	defer span.End()
+	if !subject.Can(policy.BookRead) {
+		return nil, 0, policy.ErrForbidden
 	}
 
-	return books, total, nil
+	offset := (page - 1) * pageSize
+	return s.books.List(ctx, offset, pageSize)
 }
 
-func UpdateBook(id uint, updatedBook *model.Book) error {
-	var book model.Book
-	if err := db.DB.First(&book, id).Error; err != nil {
+func (s *BookService) UpdateBook(ctx context.Context, id uint, updatedBook *model.Book, subject policy.Subject) error {
+	ctx, span := common.StartSpan(ctx, "service.UpdateBook")
+	defer span.End()
+	if !subject.Can(policy.BookWrite) {
+		return policy.ErrForbidden
+	}
+	if err := s.books.Update(ctx, id, updatedBook); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		logger(ctx).Error("update book fails", "book_id", id, "err", err)
 		return err
 	}
-
-	return db.DB.Model(&book).Updates(updatedBook).Error
+	logger(ctx).Info("book updated", "book_id", id)
+	return nil
 }
 
-func DeleteBook(id uint) error {
-	return db.DB.Delete(&model.Book{}, id).Error
+func (s *BookService) DeleteBook(ctx context.Context, id uint, subject policy.Subject) error {
+	ctx, span := common.StartSpan(ctx, "service.DeleteBook")
+	defer span.End()
+	if !subject.Can(policy.BookWrite) {
+		return policy.ErrForbidden
+	}
+	if err := s.books.Delete(ctx, id); err != nil {
+		logger(ctx).Error("delete book fails", "book_id", id, "err", err)
+		return err
+	}
+	logger(ctx).Info("book deleted", "book_id", id)
+	return nil
 }
 
-func HardDeleteBook(id uint) error {
-	return db.DB.Unscoped().Delete(&model.Book{}, id).Error
+func (s *BookService) HardDeleteBook(ctx context.Context, id uint) error {
+	return s.books.HardDelete(ctx, id)
 }
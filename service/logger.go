@@ -0,0 +1,12 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"test-git/common"
+)
+
+// logger 帶有請求上下文（request_id、openid、route）的 service 包 logger
+func logger(ctx context.Context) *slog.Logger {
+	return common.Logger(ctx).With("pkg", "service")
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"test-git/common"
+	"test-git/db"
+	"time"
+)
+
+const AuditViewEndpointReport = "reports.endpoints"
+
+// EndpointReportQuery 統計窗口和分桶大小，Method/Route 只影響時間序列
+type EndpointReportQuery struct {
+	From   time.Time     `json:"from"`
+	To     time.Time     `json:"to"`
+	Bucket time.Duration `json:"bucket"`
+	Method string        `json:"method,omitempty"`
+	Route  string        `json:"route,omitempty"`
+	Limit  int           `json:"limit"`
+}
+
+// EndpointStats 單個 method+route 的統計，耗時單位為秒
+type EndpointStats struct {
+	Method       string  `gorm:"column:method"`
+	Route        string  `gorm:"column:route"`
+	Count        int64   `gorm:"column:count"`
+	ServerErrors int64   `gorm:"column:server_errors"`
+	ClientErrors int64   `gorm:"column:client_errors"`
+	P50          float64 `gorm:"column:p50"`
+	P90          float64 `gorm:"column:p90"`
+	P99          float64 `gorm:"column:p99"`
+	Max          float64 `gorm:"column:max"`
+	Slowest      string  `gorm:"column:slowest"` // 逗號分隔的最慢請求ID
+}
+
+func (s EndpointStats) SlowestRequestIDs() []string {
+	if s.Slowest == "" {
+		return nil
+	}
+	return strings.Split(s.Slowest, ",")
+}
+
+// SeriesPoint 一個時間桶的統計，耗時單位為秒
+type SeriesPoint struct {
+	BucketStart  time.Time `gorm:"column:bucket_start"`
+	Count        int64     `gorm:"column:count"`
+	ServerErrors int64     `gorm:"column:server_errors"`
+	P50          float64   `gorm:"column:p50"`
+	P99          float64   `gorm:"column:p99"`
+}
+
+type EndpointReport struct {
+	Endpoints []EndpointStats
+	Series    []SeriesPoint
+}
+
+// 沒有路由模板的舊數據和未匹配路由按原始路徑分組
+const endpointStatsSQL = `
+SELECT method,
+	COALESCE(NULLIF(route, ''), path) AS route,
+	count(*) AS count,
+	count(*) FILTER (WHERE status_code >= 500) AS server_errors,
+	count(*) FILTER (WHERE status_code >= 400 AND status_code < 500) AS client_errors,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY request_time) AS p50,
+	percentile_cont(0.9) WITHIN GROUP (ORDER BY request_time) AS p90,
+	percentile_cont(0.99) WITHIN GROUP (ORDER BY request_time) AS p99,
+	max(request_time) AS max,
+	array_to_string((array_agg(request_id ORDER BY request_time DESC))[1:5], ',') AS slowest
+FROM request_logs
+WHERE created_at >= @from AND created_at < @to
+GROUP BY 1, 2
+ORDER BY count DESC
+LIMIT @limit`
+
+const endpointSeriesSQL = `
+SELECT to_timestamp(floor(extract(epoch FROM created_at) / @bucket) * @bucket) AS bucket_start,
+	count(*) AS count,
+	count(*) FILTER (WHERE status_code >= 500) AS server_errors,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY request_time) AS p50,
+	percentile_cont(0.99) WITHIN GROUP (ORDER BY request_time) AS p99
+FROM request_logs
+WHERE created_at >= @from AND created_at < @to
+	AND (@method = '' OR method = @method)
+	AND (@route = '' OR COALESCE(NULLIF(route, ''), path) = @route)
+GROUP BY 1
+ORDER BY 1`
+
+// GetEndpointReport 按 method+route 匯總請求日志，並按時間分桶生成序列
+func (s *RequestLogService) GetEndpointReport(ctx context.Context, actor AdminActor, query EndpointReportQuery) (*EndpointReport, error) {
+	ctx, span := common.StartSpan(ctx, "service.GetEndpointReport")
+	defer span.End()
+	if db.LogDB == nil {
+		return nil, ErrLogDBUnavailable
+	}
+
+	report := &EndpointReport{}
+	err := db.LogDB.WithContext(ctx).Raw(endpointStatsSQL,
+		sql.Named("from", query.From),
+		sql.Named("to", query.To),
+		sql.Named("limit", query.Limit),
+	).Find(&report.Endpoints).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.LogDB.WithContext(ctx).Raw(endpointSeriesSQL,
+		sql.Named("from", query.From),
+		sql.Named("to", query.To),
+		sql.Named("bucket", query.Bucket.Seconds()),
+		sql.Named("method", strings.ToUpper(query.Method)),
+		sql.Named("route", query.Route),
+	).Find(&report.Series).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordAudit(ctx, s.audits, actor, AuditViewEndpointReport, "request_log", "", query); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"test-git/common"
+	"test-git/db"
+	"test-git/model"
+	"test-git/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AuditSearchRequestLogs = "request_logs.search"
+	AuditViewRequestLog    = "request_logs.view"
+)
+
+var (
+	ErrLogDBUnavailable = errors.New("请求日志库不可用")
+	ErrInvalidCursor    = errors.New("分页游标无效")
+)
+
+// RequestLogFilter 請求日志查詢條件，零值表示不過濾
+type RequestLogFilter struct {
+	From        *time.Time `json:"from,omitempty"`
+	To          *time.Time `json:"to,omitempty"`
+	Path        string     `json:"path,omitempty"` // 以 "*" 結尾表示前綴匹配
+	Method      string     `json:"method,omitempty"`
+	StatusMin   int        `json:"status_min,omitempty"`
+	StatusMax   int        `json:"status_max,omitempty"`
+	RemoteIP    string     `json:"remote_ip,omitempty"`
+	RequestID   string     `json:"request_id,omitempty"`
+	MinLatency  float64    `json:"min_latency,omitempty"`  // 秒
+	ServiceName string     `json:"service_name,omitempty"` // 多個服務共用日志庫時區分來源
+	ContentType string     `json:"content_type,omitempty"` // 如 multipart/form-data，只看上傳文件的請求
+}
+
+// requestLogListColumns 列表不返回 file_content_json，避免一次讀出大量上傳文件
+var requestLogListColumns = []string{
+	"id", "request_id", "method", "service_name", "path", "route", "query_string", "status_code",
+	"remote_ip", "user_id", "user_agent", "request_time", "created_at", "file_name", "file_size", "content_type",
+}
+
+// RequestLogService 管理後台查詢請求日志和報表；日志在日志庫中，審計記錄通過 audits 寫入主存儲
+type RequestLogService struct {
+	audits repository.AuditRepository
+}
+
+func NewRequestLogService(audits repository.AuditRepository) *RequestLogService {
+	return &RequestLogService{audits: audits}
+}
+
+// ListRequestLogs 按 created_at、id 倒序分頁查詢，cursor 為上一頁返回的游標
+func (s *RequestLogService) ListRequestLogs(ctx context.Context, actor AdminActor, filter RequestLogFilter, cursor string, limit int) ([]model.RequestLog, string, error) {
+	ctx, span := common.StartSpan(ctx, "service.ListRequestLogs")
+	defer span.End()
+	if db.LogDB == nil {
+		return nil, "", ErrLogDBUnavailable
+	}
+
+	query, err := RequestLogPageQuery(db.LogDB.WithContext(ctx), filter, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	var logs []model.RequestLog
+	if err := query.Find(&logs).Error; err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(logs) > limit {
+		logs = logs[:limit]
+		last := logs[len(logs)-1]
+		next = EncodeLogCursor(last.CreatedAt, last.ID)
+	}
+
+	err = recordAudit(ctx, s.audits, actor, AuditSearchRequestLogs, "request_log", "", map[string]interface{}{
+		"filter": filter,
+		"cursor": cursor,
+	})
+	return logs, next, err
+}
+
+// GetRequestLog 查詢單條日志，包含保存的文件内容
+func (s *RequestLogService) GetRequestLog(ctx context.Context, actor AdminActor, id uint64) (*model.RequestLog, error) {
+	ctx, span := common.StartSpan(ctx, "service.GetRequestLog")
+	defer span.End()
+	if db.LogDB == nil {
+		return nil, ErrLogDBUnavailable
+	}
+
+	var reqLog model.RequestLog
+	if err := db.LogDB.WithContext(ctx).First(&reqLog, id).Error; err != nil {
+		return nil, err
+	}
+
+	err := recordAudit(ctx, s.audits, actor, AuditViewRequestLog, "request_log", strconv.FormatUint(id, 10), map[string]interface{}{
+		"request_id": reqLog.RequestID,
+	})
+	return &reqLog, err
+}
+
+// RequestLogPageQuery 構造一頁日志的查詢：滿足過濾條件、排在游標之後，按 created_at、id 倒序，
+// 多查一條判斷是否還有下一頁
+func RequestLogPageQuery(tx *gorm.DB, filter RequestLogFilter, cursor string, limit int) (*gorm.DB, error) {
+	query := applyRequestLogFilter(tx.Model(&model.RequestLog{}).Select(requestLogListColumns), filter)
+	if cursor != "" {
+		createdAt, id, err := DecodeLogCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+	return query.Order("created_at DESC, id DESC").Limit(limit + 1), nil
+}
+
+func applyRequestLogFilter(tx *gorm.DB, filter RequestLogFilter) *gorm.DB {
+	if filter.From != nil {
+		tx = tx.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		tx = tx.Where("created_at < ?", *filter.To)
+	}
+	if prefix, ok := strings.CutSuffix(filter.Path, "*"); ok {
+		tx = tx.Where("path LIKE ?", db.EscapeLike(prefix)+"%")
+	} else if filter.Path != "" {
+		tx = tx.Where("path = ?", filter.Path)
+	}
+	if filter.Method != "" {
+		tx = tx.Where("method = ?", strings.ToUpper(filter.Method))
+	}
+	if filter.StatusMin > 0 {
+		tx = tx.Where("status_code >= ?", filter.StatusMin)
+	}
+	if filter.StatusMax > 0 {
+		tx = tx.Where("status_code <= ?", filter.StatusMax)
+	}
+	if filter.RemoteIP != "" {
+		tx = tx.Where("remote_ip = ?", filter.RemoteIP)
+	}
+	if filter.RequestID != "" {
+		tx = tx.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.MinLatency > 0 {
+		tx = tx.Where("request_time >= ?", filter.MinLatency)
+	}
+	if filter.ServiceName != "" {
+		tx = tx.Where("service_name = ?", filter.ServiceName)
+	}
+	if filter.ContentType != "" {
+		tx = tx.Where("content_type = ?", filter.ContentType)
+	}
+	return tx
+}
+
+// EncodeLogCursor 游標格式: base64url("<created_at unix 納秒>:<id>")
+func EncodeLogCursor(createdAt time.Time, id uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", createdAt.UnixNano(), id)))
+}
+
+// DecodeLogCursor 格式不對時返回 ErrInvalidCursor
+func DecodeLogCursor(cursor string) (time.Time, uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	nanoStr, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	nano, err := strconv.ParseInt(nanoStr, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, nano), id, nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"test-git/common"
+	"test-git/model"
+	"test-git/policy"
+	"test-git/repository"
+)
+
+const (
+	AuditExportRoles = "roles.export"
+	AuditImportRoles = "roles.import"
+)
+
+// ImportResult 導入的角色數，跳過的是同一用戶下名稱和角色卡都相同的角色
+type ImportResult struct {
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+}
+
+// ExportRoles 按 ID 順序導出一個用戶的全部角色
+func (s *AdminService) ExportRoles(ctx context.Context, actor AdminActor, wxUserID string, includeDeleted bool) ([]model.Role, error) {
+	ctx, span := common.StartSpan(ctx, "service.ExportRoles")
+	defer span.End()
+	filter := repository.RoleFilter{WxUserID: wxUserID, Order: repository.OrderIDAsc}
+	if includeDeleted {
+		filter.Deleted = repository.DeletedInclude
+	}
+	roles, _, err := s.repos.Roles.List(ctx, filter, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(ctx, s.repos.Audits, actor, AuditExportRoles, "user", wxUserID, map[string]interface{}{
+		"roles":           len(roles),
+		"include_deleted": includeDeleted,
+	})
+	return roles, err
+}
+
+// ImportRoles 把角色導入到 wxUserID 名下，用戶不存在時自動創建，全部成功或全部回滾
+func (s *AdminService) ImportRoles(ctx context.Context, actor AdminActor, wxUserID string, roles []model.Role, skipExisting bool, source string) (ImportResult, error) {
+	ctx, span := common.StartSpan(ctx, "service.ImportRoles")
+	defer span.End()
+	var result ImportResult
+	err := s.repos.Transaction(ctx, func(tx repository.Repositories) error {
+		user := model.User{WxUserId: wxUserID, Roles: string(policy.Player)}
+		if _, err := tx.Users.FirstOrCreate(ctx, &user); err != nil {
+			return err
+		}
+
+		// 已有的角色包括已刪除的，同一批中重複的角色也只導入一次
+		existing := make(map[string]bool)
+		if skipExisting {
+			current, _, err := tx.Roles.List(ctx, repository.RoleFilter{WxUserID: wxUserID, Deleted: repository.DeletedInclude}, 0, -1)
+			if err != nil {
+				return err
+			}
+			for _, role := range current {
+				existing[importKey(role)] = true
+			}
+		}
+
+		for _, role := range roles {
+			key := importKey(role)
+			if skipExisting && existing[key] {
+				result.Skipped++
+				continue
+			}
+			// 保留原來的創建、更新和刪除時間
+			role.ID = 0
+			role.WxUserId = wxUserID
+			if err := tx.Roles.Create(ctx, &role); err != nil {
+				return err
+			}
+			existing[key] = true
+			result.Created++
+		}
+
+		return recordAudit(ctx, tx.Audits, actor, AuditImportRoles, "user", wxUserID, map[string]interface{}{
+			"source":  source,
+			"created": result.Created,
+			"skipped": result.Skipped,
+		})
+	})
+	if err != nil {
+		logger(ctx).Error("import roles fails", "admin", actor.Name, "wx_user_id", wxUserID, "err", err)
+		return ImportResult{}, err
+	}
+	logger(ctx).Info("roles imported", "admin", actor.Name, "wx_user_id", wxUserID, "created", result.Created, "skipped", result.Skipped)
+	return result, nil
+}
+
+// importKey 判斷角色是否相同：名稱相同且角色卡的 JSON 相同，和 jsonb 一樣忽略鍵的順序和空白
+func importKey(role model.Role) string {
+	data := []byte(role.RoleData)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err == nil {
+		if normalized, err := json.Marshal(v); err == nil {
+			data = normalized
+		}
+	}
+	return role.Name + "\x00" + string(data)
+}
@@ -1,59 +1,104 @@
 package service
 
 import (
-	"errors"
-	"test-git/db"
+	"context"
+	"test-git/common"
 	"test-git/model"
+	"test-git/policy"
+	"test-git/repository"
 )
 
-func GetAllRoles(userID string, page, pageSize int) ([]model.Role, int64, error) {
-	var roles []model.Role
-	var total int64
+// RoleService 用戶自己的角色，管理後台跨用戶的操作見 admin_service.go
+type RoleService struct {
+	roles repository.RoleRepository
+}
 
-	if err := db.DB.Model(&model.Role{}).Count(&total).Error; err != nil {
-		return nil, 0, err
-	}
+func NewRoleService(roles repository.RoleRepository) *RoleService {
+	return &RoleService{roles: roles}
+}
 
-	offset := (page - 1) * pageSize
-	if err := db.DB.Where("wx_user_id = ?", userID).Offset(offset).Limit(pageSize).Find(&roles).Error; err != nil {
-		return nil, 0, err
+func (s *RoleService) GetAllRoles(ctx context.Context, subject policy.Subject, page, pageSize int) ([]model.Role, int64, error) {
+	ctx, span := common.StartSpan(ctx, "service.GetAllRoles")
+	defer span.End()
+	if !subject.Can(policy.RoleRead) {
+		return nil, 0, policy.ErrForbidden
 	}
 
-	return roles, total, nil
+	offset := (page - 1) * pageSize
+	return s.roles.List(ctx, repository.RoleFilter{WxUserID: subject.UserID}, offset, pageSize)
 }
 
-func GetRoleByID(id uint, userID string) (*model.Role, error) {
-	var role model.Role
-	result := db.DB.First(&role, id)
-	if result.Error != nil {
-		return nil, result.Error
+func (s *RoleService) GetRoleByID(ctx context.Context, id uint, subject policy.Subject) (*model.Role, error) {
+	ctx, span := common.StartSpan(ctx, "service.GetRoleByID")
+	defer span.End()
+	role, err := s.roles.Get(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	if role.WxUserId != userID {
-		return nil, errors.New("无权限查看该角色")
+	if !subject.CanAccess(role.WxUserId, policy.RoleRead, policy.RoleReadAny) {
+		logger(ctx).Warn("read role forbidden", "role_id", id, "owner", role.WxUserId)
+		return nil, policy.ErrForbidden
 	}
-	return &role, nil
+	return role, nil
 }
 
-func CreateRole(role *model.Role) error {
-	return db.DB.Create(role).Error
+func (s *RoleService) CreateRole(ctx context.Context, role *model.Role, subject policy.Subject) error {
+	ctx, span := common.StartSpan(ctx, "service.CreateRole")
+	defer span.End()
+	if !subject.Can(policy.RoleCreate) {
+		return policy.ErrForbidden
+	}
+	role.WxUserId = subject.UserID
+	if err := s.roles.Create(ctx, role); err != nil {
+		logger(ctx).Error("create role fails", "err", err)
+		return err
+	}
+	logger(ctx).Info("role created", "role_id", role.ID)
+	return nil
 }
 
-func UpdateRole(id uint, updateRole *model.Role) error {
-	var role model.Role
-	if err := db.DB.First(&role, id).Error; err != nil {
+// UpdateRole 更新角色，所有者不會被修改
+func (s *RoleService) UpdateRole(ctx context.Context, id uint, updateRole *model.Role, subject policy.Subject) error {
+	ctx, span := common.StartSpan(ctx, "service.UpdateRole")
+	defer span.End()
+	role, err := s.roles.Get(ctx, id)
+	if err != nil {
 		return err
 	}
 
-	if role.WxUserId != updateRole.WxUserId {
-		return errors.New("无权限修改该角色")
+	if !subject.CanAccess(role.WxUserId, policy.RoleUpdate, policy.RoleUpdateAny) {
+		logger(ctx).Warn("update role forbidden", "role_id", id, "owner", role.WxUserId)
+		return policy.ErrForbidden
 	}
-	return db.DB.Model(&role).Updates(updateRole).Error
+	updateRole.WxUserId = ""
+	if err := s.roles.Update(ctx, id, updateRole); err != nil {
+		logger(ctx).Error("update role fails", "role_id", id, "err", err)
+		return err
+	}
+	logger(ctx).Info("role updated", "role_id", id)
+	return nil
 }
 
-func DeleteRole(id uint) error {
-	return db.DB.Delete(&model.Role{}, id).Error
+func (s *RoleService) DeleteRole(ctx context.Context, id uint, subject policy.Subject) error {
+	ctx, span := common.StartSpan(ctx, "service.DeleteRole")
+	defer span.End()
+	role, err := s.roles.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !subject.CanAccess(role.WxUserId, policy.RoleDelete, policy.RoleDeleteAny) {
+		logger(ctx).Warn("delete role forbidden", "role_id", id, "owner", role.WxUserId)
+		return policy.ErrForbidden
+	}
+	if err := s.roles.Delete(ctx, id); err != nil {
+		logger(ctx).Error("delete role fails", "role_id", id, "err", err)
+		return err
+	}
+	logger(ctx).Info("role deleted", "role_id", id)
+	return nil
 }
 
-func HardDeleteRole(id uint) error {
-	return db.DB.Unscoped().Delete(&model.Role{}, id).Error
+func (s *RoleService) HardDeleteRole(ctx context.Context, id uint) error {
+	return s.roles.HardDelete(ctx, id)
 }
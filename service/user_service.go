@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"test-git/common"
+	"test-git/model"
+	"test-git/policy"
+	"test-git/repository"
+
+	"gorm.io/gorm"
+)
+
+type UserService struct {
+	users repository.UserRepository
+}
+
+func NewUserService(users repository.UserRepository) *UserService {
+	return &UserService{users: users}
+}
+
+// EnsureUser 登錄時建立用戶記錄，新用戶默認授予 player
+func (s *UserService) EnsureUser(ctx context.Context, wxUserID string) (*model.User, error) {
+	ctx, span := common.StartSpan(ctx, "service.EnsureUser")
+	defer span.End()
+	user := model.User{WxUserId: wxUserID, Roles: string(policy.Player)}
+	created, err := s.users.FirstOrCreate(ctx, &user)
+	if err != nil {
+		logger(ctx).Error("ensure user fails", "err", err)
+		return nil, err
+	}
+	if created {
+		logger(ctx).Info("user registered", "user_id", user.ID)
+	}
+	return &user, nil
+}
+
+// GetSubject 加載用戶的角色授權，沒有用戶記錄時按 player 處理
+func (s *UserService) GetSubject(ctx context.Context, wxUserID string) (policy.Subject, error) {
+	subject := policy.Subject{UserID: wxUserID, Roles: []policy.Role{policy.Player}}
+	if wxUserID == "" {
+		return policy.Subject{}, nil
+	}
+
+	ctx, span := common.StartSpan(ctx, "service.GetSubject")
+	defer span.End()
+	user, err := s.users.FindByWxUserID(ctx, wxUserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return subject, nil
+	}
+	if err != nil {
+		return policy.Subject{}, err
+	}
+
+	subject.Roles = policy.ParseRoles(user.Roles)
+	return subject, nil
+}
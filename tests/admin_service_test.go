@@ -0,0 +1,256 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"test-git/model"
+	"test-git/repository"
+	"test-git/service"
+
+	"gorm.io/gorm"
+)
+
+func newAdminService(t *testing.T) (*service.AdminService, repository.Repositories, *repository.MemoryAuditRepository) {
+	t.Helper()
+	repos := repository.NewMemory()
+	return service.NewAdminService(repos), repos, repos.Audits.(*repository.MemoryAuditRepository)
+}
+
+func createRole(t *testing.T, repos repository.Repositories, name, owner string) *model.Role {
+	t.Helper()
+	role := &model.Role{Name: name, WxUserId: owner, RoleData: []byte(`{}`)}
+	if err := repos.Roles.Create(context.Background(), role); err != nil {
+		t.Fatal(err)
+	}
+	return role
+}
+
+func auditDetail(t *testing.T, audit model.AdminAudit) map[string]interface{} {
+	t.Helper()
+	var detail map[string]interface{}
+	if err := json.Unmarshal(audit.Detail, &detail); err != nil {
+		t.Fatalf("audit detail %s: %v", audit.Detail, err)
+	}
+	return detail
+}
+
+var testActor = service.AdminActor{Name: "ops", RemoteIP: "10.0.0.1"}
+
+func TestTransferRoleCreatesTargetUser(t *testing.T) {
+	ctx := context.Background()
+	admin, repos, audits := newAdminService(t)
+	role := createRole(t, repos, "alice", "from")
+
+	got, err := admin.TransferRole(ctx, testActor, role.ID, "to")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.WxUserId != "to" {
+		t.Errorf("returned role owner = %q, want to", got.WxUserId)
+	}
+	if stored, _ := repos.Roles.Get(ctx, role.ID); stored.WxUserId != "to" {
+		t.Errorf("stored role owner = %q, want to", stored.WxUserId)
+	}
+	user, err := repos.Users.FindByWxUserID(ctx, "to")
+	if err != nil || user.Roles != "player" {
+		t.Fatalf("target user = %+v, %v, want a new player", user, err)
+	}
+
+	list := audits.List()
+	if len(list) != 1 {
+		t.Fatalf("audits = %+v, want one", list)
+	}
+	audit := list[0]
+	if audit.Action != service.AuditTransferRole || audit.Actor != "ops" || audit.RemoteIP != "10.0.0.1" ||
+		audit.TargetType != "role" || audit.TargetID != "1" {
+		t.Errorf("audit = %+v", audit)
+	}
+	detail := auditDetail(t, audit)
+	if detail["from_wx_user_id"] != "from" || detail["to_wx_user_id"] != "to" || detail["target_user_created"] != true {
+		t.Errorf("audit detail = %v", detail)
+	}
+
+	// 目標用戶已存在時不重建，審計中標記為未創建
+	if _, err := admin.TransferRole(ctx, testActor, role.ID, "to"); err != nil {
+		t.Fatal(err)
+	}
+	if detail := auditDetail(t, audits.List()[1]); detail["target_user_created"] != false {
+		t.Errorf("second transfer audit detail = %v", detail)
+	}
+}
+
+func TestTransferMissingRoleRollsBack(t *testing.T) {
+	ctx := context.Background()
+	admin, repos, audits := newAdminService(t)
+
+	if _, err := admin.TransferRole(ctx, testActor, 42, "to"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("TransferRole missing role err = %v, want ErrRecordNotFound", err)
+	}
+	if _, err := repos.Users.FindByWxUserID(ctx, "to"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("target user created for a failed transfer: %v", err)
+	}
+	if list := audits.List(); len(list) != 0 {
+		t.Errorf("audits for a failed transfer = %+v", list)
+	}
+}
+
+func TestRestoreRole(t *testing.T) {
+	ctx := context.Background()
+	admin, repos, audits := newAdminService(t)
+	role := createRole(t, repos, "alice", "owner")
+
+	if _, err := admin.RestoreRole(ctx, testActor, role.ID); !errors.Is(err, service.ErrRoleNotDeleted) {
+		t.Fatalf("RestoreRole live role err = %v, want ErrRoleNotDeleted", err)
+	}
+	if _, err := admin.RestoreRole(ctx, testActor, 42); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("RestoreRole missing role err = %v, want ErrRecordNotFound", err)
+	}
+	if list := audits.List(); len(list) != 0 {
+		t.Fatalf("audits for failed restores = %+v", list)
+	}
+
+	if err := repos.Roles.Delete(ctx, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := admin.RestoreRole(ctx, testActor, role.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DeletedAt.Valid {
+		t.Errorf("restored role is still deleted: %+v", got)
+	}
+	if _, err := repos.Roles.Get(ctx, role.ID); err != nil {
+		t.Errorf("Get restored role: %v", err)
+	}
+
+	list := audits.List()
+	if len(list) != 1 || list[0].Action != service.AuditRestoreRole || list[0].TargetID != "1" {
+		t.Fatalf("audits = %+v", list)
+	}
+	detail := auditDetail(t, list[0])
+	if detail["wx_user_id"] != "owner" || detail["deleted_at"] == nil {
+		t.Errorf("audit detail = %v", detail)
+	}
+}
+
+func TestSearchRolesKeywordIsLiteral(t *testing.T) {
+	ctx := context.Background()
+	admin, repos, audits := newAdminService(t)
+	createRole(t, repos, "100%_done", "a")
+	createRole(t, repos, "100 done", "b")
+	deleted := createRole(t, repos, "1000_done", "a")
+	if err := repos.Roles.Delete(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	roles, total, err := admin.SearchRoles(ctx, testActor, service.AdminRoleFilter{Keyword: "%_"}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || roles[0].Name != "100%_done" {
+		t.Errorf("SearchRoles %%_ = %d roles, %+v", total, roles)
+	}
+
+	roles, total, err = admin.SearchRoles(ctx, testActor, service.AdminRoleFilter{Keyword: "_DONE", Deleted: "include"}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || roles[0].ID != deleted.ID {
+		t.Errorf("SearchRoles _DONE including deleted = %d roles, %+v, want newest first", total, roles)
+	}
+
+	list := audits.List()
+	if len(list) != 2 || list[0].Action != service.AuditSearchRoles {
+		t.Fatalf("audits = %+v", list)
+	}
+	if detail := auditDetail(t, list[1]); detail["total"] != float64(2) {
+		t.Errorf("audit detail = %v", detail)
+	}
+}
+
+func TestGetUserStats(t *testing.T) {
+	ctx := context.Background()
+	admin, repos, audits := newAdminService(t)
+	if _, err := repos.Users.FirstOrCreate(ctx, &model.User{WxUserId: "owner", Roles: "keeper"}); err != nil {
+		t.Fatal(err)
+	}
+	createRole(t, repos, "a", "owner")
+	createRole(t, repos, "b", "other")
+	deleted := createRole(t, repos, "c", "owner")
+	if err := repos.Roles.Delete(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := admin.GetUserStats(ctx, testActor, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Roles != "keeper" || stats.RegisteredAt == nil || stats.ActiveRoles != 1 || stats.DeletedRoles != 1 || stats.LastUpdatedAt == nil {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	stats, err = admin.GetUserStats(ctx, testActor, "nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RegisteredAt != nil || stats.ActiveRoles != 0 || stats.LastUpdatedAt != nil {
+		t.Errorf("stats for unknown user = %+v", stats)
+	}
+	if list := audits.List(); len(list) != 2 || list[1].Action != service.AuditViewUserStats || list[1].TargetID != "nobody" {
+		t.Errorf("audits = %+v", list)
+	}
+}
+
+func TestImportExportRoles(t *testing.T) {
+	ctx := context.Background()
+	admin, repos, audits := newAdminService(t)
+	existing := &model.Role{Name: "alice", WxUserId: "o-import", RoleData: []byte(`{"str": 50, "dex": 60}`)}
+	if err := repos.Roles.Create(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// 鍵順序不同的相同角色卡跳過，同一批中重複的角色只導入一次
+	roles := []model.Role{
+		{Name: "alice", RoleData: []byte(`{"dex":60,"str":50}`)},
+		{Name: "bob", RoleData: []byte(`{"str":40}`)},
+		{Name: "bob", RoleData: []byte(`{"str":40}`)},
+	}
+	result, err := admin.ImportRoles(ctx, testActor, "o-import", roles, true, "backup.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Created != 1 || result.Skipped != 2 {
+		t.Errorf("result = %+v, want 1 created and 2 skipped", result)
+	}
+	if user, err := repos.Users.FindByWxUserID(ctx, "o-import"); err != nil || user.Roles != "player" {
+		t.Errorf("imported user = %+v, %v, want a new player", user, err)
+	}
+
+	exported, err := admin.ExportRoles(ctx, testActor, "o-import", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 2 || exported[0].Name != "alice" || exported[1].Name != "bob" {
+		t.Fatalf("exported = %+v", exported)
+	}
+	if err := repos.Roles.Delete(ctx, exported[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if exported, err := admin.ExportRoles(ctx, testActor, "o-import", false); err != nil || len(exported) != 1 {
+		t.Errorf("export without deleted = %d roles, %v", len(exported), err)
+	}
+	if exported, err := admin.ExportRoles(ctx, testActor, "o-import", true); err != nil || len(exported) != 2 {
+		t.Errorf("export with deleted = %d roles, %v", len(exported), err)
+	}
+
+	list := audits.List()
+	if len(list) != 4 || list[0].Action != service.AuditImportRoles || list[1].Action != service.AuditExportRoles {
+		t.Fatalf("audits = %+v", list)
+	}
+	if detail := auditDetail(t, list[0]); detail["source"] != "backup.zip" || detail["created"] != float64(1) {
+		t.Errorf("import audit detail = %v", detail)
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"test-git/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAppLoggerPackageLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := common.NewAppLogger(&buf, common.AppLogConfig{
+		Format:        common.AppLogText,
+		Level:         slog.LevelInfo,
+		PackageLevels: map[string]slog.Level{"db": slog.LevelDebug, "http": slog.LevelWarn},
+	})
+
+	logger.Debug("root debug")
+	logger.With("pkg", "db").Debug("db debug")
+	logger.With("pkg", "http").Info("http info")
+	logger.With("pkg", "http").Warn("http warn")
+
+	out := buf.String()
+	for _, want := range []string{"db debug", "http warn"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in %s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"root debug", "http info"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("%q should be filtered out", unwanted)
+		}
+	}
+}
+
+func TestRequestScopedLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(common.NewAppLogger(&buf, common.AppLogConfig{Format: common.AppLogJSON, Level: slog.LevelInfo}))
+	defer slog.SetDefault(prev)
+
+	key := []byte("logger-user-key")
+	if err := common.ConfigureBodyCapture(common.BodyCaptureConfig{UserRefKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	defer common.ConfigureBodyCapture(common.BodyCaptureConfig{})
+
+	signer := common.NewSessionSigner([]byte("logger-test-secret"), time.Hour)
+	token, _, err := signer.Issue(common.SessionClaims{OpenID: "o-logger"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(common.RequestIDMiddleware(), common.RequestLoggerMiddleware(), common.RecoveryMiddleware())
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	r.Use(common.SessionMiddleware(signer))
+	r.GET("/roles/:id", func(c *gin.Context) {
+		common.Logger(c.Request.Context()).Info("loading role")
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/roles/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(common.RequestIDHeader, "req-logger-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic status = %d", w.Code)
+	}
+
+	records := map[string]map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid JSON log line %q", line)
+		}
+		if rec["request_id"] == "req-logger-1" || rec["msg"] == "panic recovered" {
+			records[rec["msg"].(string)] = rec
+		}
+	}
+	handler := records["loading role"]
+	if handler == nil || handler["route"] != "/roles/:id" {
+		t.Fatalf("handler log = %v", handler)
+	}
+	// 日志中只有用戶引用，沒有 openid 原文
+	ref, _ := handler["user_ref"].(string)
+	if userID, err := common.ResolveUserRef(key, ref); err != nil || userID != "o-logger" || strings.Contains(buf.String(), "o-logger") {
+		t.Fatalf("handler log user_ref = %q (%q, %v)", ref, userID, err)
+	}
+	access := records["request completed"]
+	if access == nil || access["status"] != float64(200) || access["pkg"] != "http" {
+		t.Fatalf("access log = %v", access)
+	}
+	if records["panic recovered"] == nil {
+		t.Fatal("panic should be logged")
+	}
+}
@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"test-git/config"
+)
+
+// isolateConfigEnv 清空配置相關的環境變量，測試結束後恢復原值；只保留必填的 SESSION_SECRET
+func isolateConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range append(config.Keys(), "CONFIG_FILE") {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	os.Setenv("SESSION_SECRET", "test-session-secret")
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	isolateConfigEnv(t)
+	secret := writeConfigFile(t, "db_password", "s3cr:t/@pw\n")
+	file := writeConfigFile(t, "config.yaml", `
+server:
+  addr: ":9443"
+  read_timeout: 30s
+db:
+  host: db.internal
+  name: app
+  password_file: `+secret+`
+  max_open_conns: 20
+request_log:
+  sinks: [file, stdout]
+  db:
+    name: logs
+rate_limit:
+  enabled: false
+`)
+	os.Setenv("SERVER_ADDR", ":7000")
+	os.Setenv("DB_SSLMODE", "require")
+
+	cfg, err := config.Load(config.Options{File: file, Set: map[string]string{"SERVER_ADDR": ":8000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":8000" {
+		t.Errorf("addr = %q, flags must override env and file", cfg.Server.Addr)
+	}
+	if cfg.Server.ReadTimeout != 30*time.Second {
+		t.Errorf("read timeout = %v, want 30s from file", cfg.Server.ReadTimeout)
+	}
+	if cfg.Database.Password != "s3cr:t/@pw" || cfg.Database.MaxOpenConns != 20 || cfg.Database.SSLMode != "require" {
+		t.Errorf("database = %+v", cfg.Database)
+	}
+	if want := "postgres://:s3cr%3At%2F%40pw@db.internal:5432/app?sslmode=require"; cfg.Database.DataSourceName() != want {
+		t.Errorf("dsn = %q, want %q", cfg.Database.DataSourceName(), want)
+	}
+	if cfg.LogDatabase.Host != "db.internal" || cfg.LogDatabase.Name != "logs" || cfg.LogDatabase.Password != "s3cr:t/@pw" {
+		t.Errorf("log database = %+v, want main connection with its own name", cfg.LogDatabase)
+	}
+	if !reflect.DeepEqual(cfg.LogSink.Sinks, []string{"file", "stdout"}) {
+		t.Errorf("sinks = %v", cfg.LogSink.Sinks)
+	}
+	if cfg.RateLimit.Enabled {
+		t.Error("rate limit should be disabled by the file")
+	}
+	// 合併結果不寫回環境變量，從文件讀取的密鑰不會被子進程繼承
+	for _, key := range []string{"DB_PASSWORD", "DB_HOST"} {
+		if v, ok := os.LookupEnv(key); ok {
+			t.Errorf("%s = %q leaked into the environment", key, v)
+		}
+	}
+	if v := os.Getenv("SERVER_ADDR"); v != ":7000" {
+		t.Errorf("SERVER_ADDR = %q, the environment must not be overwritten", v)
+	}
+}
+
+func TestConfigTOML(t *testing.T) {
+	isolateConfigEnv(t)
+	file := writeConfigFile(t, "config.toml", `
+[server]
+addr = ":9000"
+
+[otel.traces]
+exporter = "file"
+sampler_arg = 0.5
+`)
+	cfg, err := config.Load(config.Options{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9000" || cfg.Tracing.Exporter != "file" || cfg.Tracing.SampleRatio != 0.5 {
+		t.Errorf("server = %+v, tracing = %+v", cfg.Server, cfg.Tracing)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	isolateConfigEnv(t)
+	file := writeConfigFile(t, "config.yaml", "server:\n  adr: \":80\"\n")
+	if _, err := config.Load(config.Options{File: file}); err == nil || !strings.Contains(err.Error(), "server.adr") {
+		t.Errorf("unknown file key error = %v", err)
+	}
+
+	if _, err := config.Load(config.Options{Set: map[string]string{"NO_SUCH_KEY": "1"}}); err == nil {
+		t.Error("unknown -set key accepted")
+	}
+
+	// 所有無效配置一次報告
+	_, err := config.Load(config.Options{Set: map[string]string{
+		"DB_SSLMODE":           "sometimes",
+		"IDEMPOTENCY_TTL":      "forever",
+		"SESSION_TTL":          "7d",
+		"SERVER_TLS_CERT_FILE": "cert.pem",
+	}})
+	if err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	for _, want := range []string{"DB_SSLMODE", "IDEMPOTENCY_TTL", "SESSION_TTL", "SERVER_TLS_KEY_FILE"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+
+	// 內存模式沒有主庫，共享狀態不能存 Postgres
+	isolateConfigEnv(t)
+	_, err = config.Load(config.Options{Set: map[string]string{"STORE": "memory", "RATE_LIMIT_STORE": "postgres"}})
+	if err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_STORE") {
+		t.Errorf("STORE=memory with RATE_LIMIT_STORE=postgres error = %v", err)
+	}
+
+	// 沒有會話密鑰時必須顯式關閉會話
+	isolateConfigEnv(t)
+	os.Unsetenv("SESSION_SECRET")
+	if _, err := config.Load(config.Options{}); err == nil || !strings.Contains(err.Error(), "SESSION_SECRET") {
+		t.Errorf("missing SESSION_SECRET error = %v", err)
+	}
+	cfg, err := config.Load(config.Options{Set: map[string]string{"SESSION_DISABLED": "true"}})
+	if err != nil || !cfg.Session.Disabled {
+		t.Errorf("SESSION_DISABLED=true: %+v, %v", cfg, err)
+	}
+
+	isolateConfigEnv(t)
+	os.Setenv("SESSION_SECRET", "inline")
+	os.Setenv("SESSION_SECRET_FILE", writeConfigFile(t, "secret", "from-file"))
+	if _, err := config.Load(config.Options{}); err == nil {
+		t.Error("SESSION_SECRET and SESSION_SECRET_FILE both set should fail")
+	}
+}
+
+func TestUserRefKeyDefaultsToSessionSecret(t *testing.T) {
+	isolateConfigEnv(t)
+	cfg, err := config.Load(config.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cfg.BodyCapture.UserRefKey) != "test-session-secret" {
+		t.Errorf("user ref key = %q, want the session secret", cfg.BodyCapture.UserRefKey)
+	}
+
+	cfg, err = config.Load(config.Options{Set: map[string]string{"REQUEST_LOG_USER_KEY": "user-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cfg.BodyCapture.UserRefKey) != "user-key" {
+		t.Errorf("user ref key = %q, want REQUEST_LOG_USER_KEY", cfg.BodyCapture.UserRefKey)
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"test-git/fixture"
+	"test-git/handler"
+	"test-git/model"
+
+	"gorm.io/gorm"
+)
+
+func TestFixtureRoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	deleted := gorm.DeletedAt{Time: created.Add(time.Hour), Valid: true}
+	roles := []model.Role{
+		{Name: "a", Description: "first", AvatarUrl: "https://example.com/a.png", RoleData: []byte(`{"basic_info":{"name":"a"}}`)},
+		{Name: "b", RoleData: []byte(`{"basic_info":{"name":"b"}}`)},
+	}
+	roles[0].CreatedAt, roles[0].UpdatedAt = created, created
+	roles[1].CreatedAt, roles[1].UpdatedAt, roles[1].DeletedAt = created, created, deleted
+
+	records := make([]fixture.RoleRecord, len(roles))
+	for i, role := range roles {
+		records[i] = fixture.FromRole(role)
+	}
+
+	for _, name := range []string{"export", "export.tar.gz", "export.zip"} {
+		t.Run(name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), name)
+			if err := fixture.Write(dst, fixture.Manifest{WxUserID: "openid-1", ExportedAt: created}, records); err != nil {
+				t.Fatal(err)
+			}
+			if err := fixture.Write(dst, fixture.Manifest{}, records); err == nil {
+				t.Error("second Write overwrote the existing export")
+			}
+
+			manifest, got, err := fixture.Read(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.Version != fixture.FormatVersion || manifest.WxUserID != "openid-1" || manifest.Roles != 2 {
+				t.Errorf("manifest = %+v", manifest)
+			}
+			if len(got) != len(roles) {
+				t.Fatalf("read %d roles, want %d", len(got), len(roles))
+			}
+			for i, record := range got {
+				role := record.Role()
+				want := roles[i]
+				if role.Name != want.Name || role.Description != want.Description || role.AvatarUrl != want.AvatarUrl {
+					t.Errorf("role %d = %+v", i, role)
+				}
+				var compact bytes.Buffer
+				if err := json.Compact(&compact, role.RoleData); err != nil || compact.String() != string(want.RoleData) {
+					t.Errorf("role %d data = %s", i, role.RoleData)
+				}
+				if !role.CreatedAt.Equal(want.CreatedAt) || role.DeletedAt.Valid != want.DeletedAt.Valid {
+					t.Errorf("role %d timestamps = %v %v", i, role.CreatedAt, role.DeletedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCardFiles(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("../role.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.json", "a.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cards, err := fixture.ReadCardFiles([]string{dir, "../role.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 3 || filepath.Base(cards[0].Path) != "a.json" || filepath.Base(cards[1].Path) != "b.json" {
+		t.Fatalf("cards = %v", cards)
+	}
+
+	role, err := handler.RoleFromCardJSON(cards[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.Name == "" || role.Description == "" || !json.Valid(role.RoleData) {
+		t.Errorf("role = %+v", role)
+	}
+	if _, err := handler.RoleFromCardJSON([]byte(`{"basic_info":{}}`)); err == nil {
+		t.Error("card without a name was accepted")
+	}
+}
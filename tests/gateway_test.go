@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"test-git/common"
+)
+
+func TestGatewayVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := []byte("gateway-secret")
+	cfg := common.GatewayConfig{
+		Enabled:        true,
+		TrustedProxies: mustParseCIDRs(t, "10.0.0.0/8, 127.0.0.1"),
+		Secret:         secret,
+		ReplayWindow:   time.Minute,
+	}
+
+	signed := func(remoteAddr string, ts time.Time, signature string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/roles", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(common.WxOpenID, "openid-1")
+		req.Header.Set(common.WxAppID, "app")
+		req.Header.Set(common.WxTimestamp, strconv.FormatInt(ts.Unix(), 10))
+		if signature == "" {
+			signature = common.SignIdentityHeaders(secret, "openid-1", "app", "", "", ts.Unix())
+		}
+		req.Header.Set(common.WxSignature, signature)
+		return req
+	}
+
+	tests := []struct {
+		name string
+		cfg  common.GatewayConfig
+		req  *http.Request
+		want error
+	}{
+		{"valid", cfg, signed("10.1.2.3:5000", now, ""), nil},
+		{"single ip", cfg, signed("127.0.0.1:5000", now, ""), nil},
+		{"untrusted peer", cfg, signed("203.0.113.9:5000", now, ""), common.ErrUntrustedSource},
+		{"disabled", common.GatewayConfig{}, signed("10.1.2.3:5000", now, ""), common.ErrUntrustedSource},
+		{"bad signature", cfg, signed("10.1.2.3:5000", now, "deadbeef"), common.ErrInvalidSignature},
+		{"replayed", cfg, signed("10.1.2.3:5000", now.Add(-2*time.Minute), ""), common.ErrSignatureExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Verify(tt.req, now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func mustParseCIDRs(t *testing.T, value string) []*net.IPNet {
+	t.Helper()
+	nets, err := common.ParseCIDRs(value)
+	if err != nil {
+		t.Fatalf("ParseCIDRs(%q) error = %v", value, err)
+	}
+	return nets
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"test-git/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func readiness(t *testing.T, r *gin.Engine) (int, common.ReadinessReport) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report common.ReadinessReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode readiness: %v", err)
+	}
+	return w.Code, report
+}
+
+func TestReadinessChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	health := common.NewHealth(common.HealthConfig{Timeout: 50 * time.Millisecond})
+	var logDBDown, dbDown bool
+	health.Add("database", true, func(ctx context.Context) (map[string]interface{}, error) {
+		if dbDown {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return map[string]interface{}{"open_connections": 1}, nil
+	})
+	health.Add("log_database", false, func(context.Context) (map[string]interface{}, error) {
+		if logDBDown {
+			return nil, errors.New("connection refused")
+		}
+		return nil, nil
+	})
+	r := gin.New()
+	r.GET("/healthz", health.LivenessHandler())
+	r.GET("/readyz", health.ReadinessHandler())
+
+	code, report := readiness(t, r)
+	if code != http.StatusOK || report.Status != common.HealthOK {
+		t.Fatalf("all up = %d %s, want 200 ok", code, report.Status)
+	}
+	if report.Checks["database"].Details["open_connections"] != float64(1) {
+		t.Errorf("details = %v", report.Checks["database"].Details)
+	}
+
+	logDBDown = true
+	code, report = readiness(t, r)
+	if code != http.StatusOK || report.Status != common.HealthDegraded {
+		t.Fatalf("log db down = %d %s, want 200 degraded", code, report.Status)
+	}
+	if got := report.Checks["log_database"]; got.Status != "down" || got.Error != "connection refused" {
+		t.Errorf("log_database = %+v", got)
+	}
+
+	// 超時的關鍵依賴使整體不可用
+	dbDown = true
+	code, report = readiness(t, r)
+	if code != http.StatusServiceUnavailable || report.Status != common.HealthUnavailable {
+		t.Fatalf("db down = %d %s, want 503 unavailable", code, report.Status)
+	}
+	if got := report.Checks["database"]; got.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("database error = %q, want deadline exceeded", got.Error)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("liveness = %d, want 200 regardless of dependencies", w.Code)
+	}
+}
+
+func TestReadinessShuttingDown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	health := common.NewHealth(common.HealthConfig{Timeout: time.Second})
+	r := gin.New()
+	r.GET("/readyz", health.ReadinessHandler())
+
+	if code, _ := readiness(t, r); code != http.StatusOK {
+		t.Fatalf("before shutdown = %d, want 200", code)
+	}
+	health.SetShuttingDown()
+	code, report := readiness(t, r)
+	if code != http.StatusServiceUnavailable || !report.ShuttingDown {
+		t.Fatalf("shutting down = %d %+v, want 503", code, report)
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"test-git/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	created := 0
+	r := gin.New()
+	r.Use(common.IdempotencyMiddleware(common.IdempotencyConfig{TTL: time.Hour}, common.NewMemoryIdempotencyStore()))
+	r.POST("/roles/create", func(c *gin.Context) {
+		created++
+		c.JSON(http.StatusCreated, gin.H{"id": created})
+	})
+
+	do := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/roles/create", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(common.IdempotencyKey, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do("k1", `{"name":"a"}`)
+	if first.Code != http.StatusCreated || first.Body.String() != `{"id":1}` {
+		t.Fatalf("first = %d %s", first.Code, first.Body.String())
+	}
+
+	retry := do("k1", `{"name":"a"}`)
+	if retry.Code != http.StatusCreated || retry.Body.String() != `{"id":1}` || retry.Header().Get(common.IdempotencyReplayed) != "true" {
+		t.Errorf("retry = %d %s, replayed %q", retry.Code, retry.Body.String(), retry.Header().Get(common.IdempotencyReplayed))
+	}
+
+	if conflict := do("k1", `{"name":"b"}`); conflict.Code != http.StatusUnprocessableEntity {
+		t.Errorf("conflicting payload status = %d, want 422", conflict.Code)
+	}
+
+	do("", `{"name":"a"}`)
+	do("k2", `{"name":"a"}`)
+	if created != 3 {
+		t.Errorf("handler ran %d times, want 3", created)
+	}
+}
+
+func TestIdempotencyMiddlewareRejectsUnhashableBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handled := 0
+	r := gin.New()
+	r.Use(common.IdempotencyMiddleware(common.IdempotencyConfig{TTL: time.Hour, MaxBytes: 16}, common.NewMemoryIdempotencyStore()))
+	r.POST("/roles/create", func(c *gin.Context) {
+		handled++
+		c.Status(http.StatusCreated)
+	})
+
+	do := func(key, contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/roles/create", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if key != "" {
+			req.Header.Set(common.IdempotencyKey, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do("k1", "application/json", `{"name":"a long role name"}`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversize body status = %d, want 413", code)
+	}
+	if code := do("k2", "multipart/form-data; boundary=x", "--x--"); code != http.StatusBadRequest {
+		t.Errorf("multipart body status = %d, want 400", code)
+	}
+	if handled != 0 {
+		t.Errorf("handler ran %d times for rejected requests", handled)
+	}
+
+	// 不帶 key 的請求不受上限影響
+	if code := do("", "application/json", `{"name":"a long role name"}`); code != http.StatusCreated {
+		t.Errorf("oversize body without key status = %d", code)
+	}
+	if code := do("k3", "application/json", `{"name":"a"}`); code != http.StatusCreated {
+		t.Errorf("body within limit status = %d", code)
+	}
+}
+
+func TestPostgresIdempotencyReserveRetriesVanishedRecord(t *testing.T) {
+	// 插入一直被衝突擋住，而已有記錄每次讀取時都已被釋放
+	gdb, conn := scriptedDB(t, nil)
+	store := common.NewPostgresIdempotencyStore(gdb)
+	record, err := store.Reserve(context.Background(), "user", "k1", "hash", time.Now(), time.Hour)
+	if err == nil || record != nil {
+		t.Fatalf("Reserve = %+v, %v; want an error instead of an empty record", record, err)
+	}
+	inserts := 0
+	for _, stmt := range conn.executed() {
+		if strings.Contains(stmt, "INSERT INTO idempotency_keys") {
+			inserts++
+		}
+	}
+	if inserts != 3 {
+		t.Errorf("reserve attempts = %d, want 3", inserts)
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"test-git/common"
+	"test-git/loadtest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	h := loadtest.NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	if h.Count() != 10000 {
+		t.Fatalf("count = %d", h.Count())
+	}
+	for _, tc := range []struct {
+		p    float64
+		want int64
+	}{{50, 5000}, {90, 9000}, {99, 9900}, {100, 10000}} {
+		got := h.ValueAtPercentile(tc.p)
+		if diff := float64(got-tc.want) / float64(tc.want); diff < 0 || diff > 0.001 {
+			t.Errorf("p%v = %d, want %d within 0.1%%", tc.p, got, tc.want)
+		}
+	}
+
+	other := loadtest.NewHistogram()
+	other.Record(time.Second)
+	h.Merge(other)
+	if s := h.Summary(); s.Count != 10001 || s.Max != 1000 || s.Min != 0.001 {
+		t.Fatalf("summary after merge = %+v", s)
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := loadtest.ParseMix("list=50, get=30,create=10,update=10")
+	if err != nil || mix[loadtest.OpList] != 50 || mix[loadtest.OpUpdate] != 10 {
+		t.Fatalf("ParseMix = %v, %v", mix, err)
+	}
+	for _, v := range []string{"list", "list=x", "delete=1", "list=0"} {
+		if _, err := loadtest.ParseMix(v); err == nil {
+			t.Errorf("ParseMix(%q) should fail", v)
+		}
+	}
+}
+
+func TestLoadTestMix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var (
+		mu     sync.Mutex
+		owners = map[int]string{}
+		nextID int64
+		users  sync.Map
+	)
+	r := gin.New()
+	secret := []byte("loadtest-gateway-secret")
+	r.Use(common.HeaderMiddleware(common.GatewayConfig{
+		Enabled:        true,
+		TrustedProxies: mustParseCIDRs(t, "127.0.0.1"),
+		Secret:         secret,
+		ReplayWindow:   time.Minute,
+	}))
+	r.Use(func(c *gin.Context) {
+		if common.GetUserID(c) == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		users.Store(common.GetUserID(c), true)
+	})
+	r.GET("/roles", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"data": []int{}}) })
+	r.POST("/roles/create", func(c *gin.Context) {
+		id := int(atomic.AddInt64(&nextID, 1))
+		mu.Lock()
+		owners[id] = common.GetUserID(c)
+		mu.Unlock()
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+	})
+	owned := func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		mu.Lock()
+		defer mu.Unlock()
+		if owners[id] != common.GetUserID(c) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id})
+	}
+	r.GET("/roles/:id", owned)
+	r.PUT("/roles/:id", owned)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	report, err := loadtest.Run(context.Background(), loadtest.Options{
+		BaseURL:       srv.URL,
+		Scenario:      loadtest.ScenarioMix,
+		RoleCard:      []byte(`{"name":"調查員"}`),
+		Concurrency:   4,
+		Duration:      200 * time.Millisecond,
+		Users:         3,
+		Mix:           map[string]int{loadtest.OpList: 1, loadtest.OpGet: 1, loadtest.OpCreate: 1, loadtest.OpUpdate: 1},
+		Identity:      loadtest.IdentityGateway,
+		GatewaySecret: secret,
+		Seed:          7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests == 0 || report.Errors != 0 || report.Latency.Count != report.Requests {
+		t.Fatalf("report = %+v", report)
+	}
+	// 每個用戶只訪問自己創建的角色
+	if report.Status["404"] != 0 || report.Status["401"] != 0 {
+		t.Fatalf("unexpected status counts: %v", report.Status)
+	}
+	if len(report.Operations) != 4 {
+		t.Fatalf("operations = %v", report.Operations)
+	}
+	n := 0
+	users.Range(func(_, _ interface{}) bool { n++; return true })
+	if n != 3 {
+		t.Fatalf("saw %d virtual users, want 3", n)
+	}
+}
+
+func TestLoadTestSeedFailsOnRejectedCreate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/roles/create", func(c *gin.Context) { c.JSON(http.StatusForbidden, gin.H{"error": "禁止創建"}) })
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	_, err := loadtest.Run(context.Background(), loadtest.Options{
+		BaseURL:  srv.URL,
+		Scenario: loadtest.ScenarioMix,
+		RoleCard: []byte(`{"name":"調查員"}`),
+		Duration: 50 * time.Millisecond,
+		Mix:      map[string]int{loadtest.OpGet: 1},
+	})
+	if err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Fatalf("seed with rejected create: err = %v", err)
+	}
+}
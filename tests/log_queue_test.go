@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"test-git/common"
+	"test-git/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func sendLoggedRequests(t *testing.T, n int) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(common.RequestLogMiddleware(nil))
+	r.GET("/books", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for i := 0; i < n; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/books", nil))
+	}
+}
+
+// waitLogStats 日志在後台 goroutine 中入隊，等計數達到預期
+func waitLogStats(t *testing.T, ok func(common.LogQueueStats) bool) common.LogQueueStats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := common.GetLogQueueStats()
+		if ok(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLogQueueOverflow(t *testing.T) {
+	defer common.ConfigureLogQueue(common.LogQueueConfig{Size: 10000, Overflow: common.OverflowDropNewest})
+
+	before := common.GetLogQueueStats()
+	if err := common.ConfigureLogQueue(common.LogQueueConfig{Size: 2, Overflow: common.OverflowDropOldest}); err != nil {
+		t.Fatal(err)
+	}
+	sendLoggedRequests(t, 5)
+	stats := waitLogStats(t, func(s common.LogQueueStats) bool { return s.Enqueued-before.Enqueued == 5 })
+	if stats.Depth != 2 || stats.Dropped-before.Dropped != 3 {
+		t.Fatalf("drop-oldest stats = %+v", stats)
+	}
+
+	dir := t.TempDir()
+	before = stats
+	if err := common.ConfigureLogQueue(common.LogQueueConfig{Size: 1, Overflow: common.OverflowSpill, SpillDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	sendLoggedRequests(t, 3)
+	stats = waitLogStats(t, func(s common.LogQueueStats) bool {
+		return s.Enqueued-before.Enqueued+s.Spilled-before.Spilled == 3
+	})
+	if stats.Depth != 1 || stats.Spilled-before.Spilled != 2 || stats.Dropped != before.Dropped {
+		t.Fatalf("spill stats = %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "spill-current.ndjson")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadLogQueueConfig(t *testing.T) {
+	t.Setenv("REQUEST_LOG_OVERFLOW", "block")
+	t.Setenv("REQUEST_LOG_BLOCK_TIMEOUT", "20ms")
+	cfg, err := common.LoadLogQueueConfig(os.LookupEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Overflow != common.OverflowBlock || cfg.BlockTimeout != 20*time.Millisecond {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+
+	t.Setenv("REQUEST_LOG_OVERFLOW", "discard")
+	if _, err := common.LoadLogQueueConfig(os.LookupEnv); err == nil {
+		t.Fatal("unknown overflow policy should fail")
+	}
+}
+
+// partialSink 只接受滿批的寫入，模擬寫到一半時輸出目標不可用
+type partialSink struct{ captureSink }
+
+func (s *partialSink) Write(ctx context.Context, logs []model.RequestLog) error {
+	if len(logs) < 100 {
+		return errors.New("sink unavailable")
+	}
+	return s.captureSink.Write(ctx, logs)
+}
+
+func spillFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "spill-*.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSpilledLogsKeptWhenSinkFails(t *testing.T) {
+	defer common.ConfigureLogQueue(common.LogQueueConfig{Size: 10000, Overflow: common.OverflowDropNewest})
+	dir := t.TempDir()
+	if err := common.ConfigureLogQueue(common.LogQueueConfig{Size: 1, Overflow: common.OverflowSpill, SpillDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	before := common.GetLogQueueStats()
+	sendLoggedRequests(t, 151)
+	waitLogStats(t, func(s common.LogQueueStats) bool { return s.Spilled-before.Spilled == 150 })
+
+	stop := func(sink common.LogSink) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := common.StartLogWriter(sink).Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 第一批 100 條寫出，剩下的 50 條寫出失敗，留在文件裡
+	partial := &partialSink{}
+	stop(partial)
+	if len(partial.logs) != 100 {
+		t.Fatalf("written before the outage = %d, want 100", len(partial.logs))
+	}
+	files := spillFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("spill files after failed replay = %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 50 {
+		t.Fatalf("spill file keeps %d logs, want the 50 unwritten ones", lines)
+	}
+
+	// 輸出目標恢復後重放剩下的日志並刪除文件
+	sink := &captureSink{}
+	stop(sink)
+	if len(sink.logs) != 50 {
+		t.Fatalf("replayed after recovery = %d, want 50", len(sink.logs))
+	}
+	if files := spillFiles(t, dir); len(files) != 0 {
+		t.Fatalf("spill files after replay = %v", files)
+	}
+}
+
+func TestLogQueueBlockHoldsRequest(t *testing.T) {
+	defer common.ConfigureLogQueue(common.LogQueueConfig{Size: 10000, Overflow: common.OverflowDropNewest})
+	const timeout = 200 * time.Millisecond
+	if err := common.ConfigureLogQueue(common.LogQueueConfig{Size: 1, Overflow: common.OverflowBlock, BlockTimeout: timeout}); err != nil {
+		t.Fatal(err)
+	}
+	sendLoggedRequests(t, 1)
+
+	// 隊列已滿，請求本身等到超時才返回，返回時日志已經被丟棄
+	before := common.GetLogQueueStats()
+	start := time.Now()
+	sendLoggedRequests(t, 1)
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("request returned after %v, want it held for the block timeout %v", elapsed, timeout)
+	}
+	if stats := common.GetLogQueueStats(); stats.Dropped-before.Dropped != 1 {
+		t.Errorf("block stats = %+v, want the log dropped before the request returns", stats)
+	}
+}
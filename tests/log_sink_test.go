@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"test-git/common"
+	"test-git/model"
+)
+
+func TestFileLogSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := common.NewFileLogSink(dir, 200, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	batch := []model.RequestLog{{RequestID: "r1", Method: "GET", Path: "/roles"}}
+	for i := 0; i < 5; i++ {
+		if err := sink.Write(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 當前文件加上最多兩個輪轉文件
+	if len(entries) != 3 {
+		t.Fatalf("files = %d, want 3", len(entries))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "request-logs.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got model.RequestLog
+	if err := json.Unmarshal(bytes.TrimSpace(data), &got); err != nil || got.RequestID != "r1" {
+		t.Fatalf("line = %s, err = %v", data, err)
+	}
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(context.Context, []model.RequestLog) error { return errors.New("down") }
+func (failingSink) Close() error                                    { return nil }
+
+func TestFanoutLogSink(t *testing.T) {
+	var out bytes.Buffer
+	sink := common.NewFanoutLogSink(failingSink{}, common.NewStdoutLogSink(&out))
+
+	logs := []model.RequestLog{
+		{RequestID: "a", FileContentJSON: model.JSONRawMessage(`{"name":"x"}`)},
+		{RequestID: "b"},
+	}
+	if err := sink.Write(context.Background(), logs); err == nil {
+		t.Fatal("expected error from failing sink")
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", out.String())
+	}
+	// 文件内容原樣輸出為 JSON 對象
+	if !strings.Contains(lines[0], `"file_content_json":{"name":"x"}`) {
+		t.Fatalf("line = %s", lines[0])
+	}
+}
+
+func TestLoadLogSinkConfig(t *testing.T) {
+	t.Setenv("REQUEST_LOG_SINKS", "file, stdout")
+	cfg, err := common.LoadLogSinkConfig(os.LookupEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Uses(common.LogSinkPostgres) || !cfg.Uses(common.LogSinkFile) || !cfg.Uses(common.LogSinkStdout) {
+		t.Fatalf("sinks = %v", cfg.Sinks)
+	}
+
+	t.Setenv("REQUEST_LOG_SINKS", "kafka")
+	if _, err := common.LoadLogSinkConfig(os.LookupEnv); err == nil {
+		t.Fatal("unknown sink should fail")
+	}
+}
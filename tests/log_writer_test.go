@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"test-git/common"
+	"test-git/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type captureSink struct {
+	mu     sync.Mutex
+	logs   []model.RequestLog
+	closed bool
+}
+
+func (s *captureSink) Write(ctx context.Context, logs []model.RequestLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, logs...)
+	return nil
+}
+
+func (s *captureSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestStopLogWriterDrainsQueue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &captureSink{}
+	writer := common.StartLogWriter(sink)
+
+	err := common.ConfigureBodyCapture(common.BodyCaptureConfig{
+		Routes:       []string{"POST /auth/login"},
+		ContentTypes: []string{"application/json"},
+		MaxBytes:     1024,
+		RedactPaths:  []string{"$..code", "$..token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer common.ConfigureBodyCapture(common.BodyCaptureConfig{})
+
+	r := gin.New()
+	r.Use(common.RequestLogMiddleware(nil))
+	r.GET("/roles/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/auth/login", func(c *gin.Context) {
+		var req struct{ Code string }
+		if err := c.ShouldBindJSON(&req); err != nil || req.Code != "wx-code" {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": "secret-token", "expires_at": "later"})
+	})
+	for i := 0; i < 2; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/roles/1", nil))
+	}
+	login := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"code":"wx-code"}`))
+	login.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, login)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login = %d, body must still reach the handler", w.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := writer.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.logs) != 3 || !sink.closed {
+		t.Fatalf("logs = %d, closed = %v", len(sink.logs), sink.closed)
+	}
+	// 每個請求的日志在各自的 goroutine 中入隊，順序不固定，按路由查找
+	var roleLog, loginLog model.RequestLog
+	for _, l := range sink.logs {
+		switch l.Route {
+		case "/roles/:id":
+			roleLog = l
+		case "/auth/login":
+			loginLog = l
+		}
+	}
+	if roleLog.RequestID == "" || roleLog.RequestBody != "" || roleLog.RequestRedacted {
+		t.Fatalf("role log = %+v", roleLog)
+	}
+	if loginLog.RequestBody != `{"code":"[REDACTED]"}` || !loginLog.RequestRedacted ||
+		loginLog.ResponseBody != `{"expires_at":"later","token":"[REDACTED]"}` {
+		t.Fatalf("bodies = %s / %s", loginLog.RequestBody, loginLog.ResponseBody)
+	}
+}
+
+func TestLogWriterRestart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(common.RequestLogMiddleware(nil))
+	r.GET("/roles/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 2; i++ {
+		sink := &captureSink{}
+		writer := common.StartLogWriter(sink)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/roles/1", nil))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := writer.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+		// 重複停止直接返回
+		if err := writer.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		sink.mu.Lock()
+		if len(sink.logs) != 1 || !sink.closed {
+			t.Errorf("run %d: logs = %d, closed = %v", i, len(sink.logs), sink.closed)
+		}
+		sink.mu.Unlock()
+	}
+}
+
+func TestInvalidUploadMarkedRedacted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &captureSink{}
+	writer := common.StartLogWriter(sink)
+
+	r := gin.New()
+	r.Use(common.RequestLogMiddleware(nil))
+	r.POST("/roles", func(c *gin.Context) {
+		if _, err := c.FormFile("file"); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "role.json")
+	part.Write([]byte("not json"))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/roles", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := writer.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	// 記錄的是錯誤說明而不是文件本身，回放時不能當作文件發送
+	if len(sink.logs) != 1 || !sink.logs[0].RequestRedacted ||
+		!strings.Contains(string(sink.logs[0].FileContentJSON), "not valid JSON") {
+		t.Fatalf("logs = %+v", sink.logs)
+	}
+}
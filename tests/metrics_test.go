@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"test-git/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricValue 返回指標輸出中某個序列的值，不存在時為 0
+func metricValue(out, series string) float64 {
+	for _, line := range strings.Split(out, "\n") {
+		if v, ok := strings.CutPrefix(line, series+" "); ok {
+			f, _ := strconv.ParseFloat(v, 64)
+			return f
+		}
+	}
+	return 0
+}
+
+func TestMetricsRouteLabels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := common.MetricsConfig{Enabled: true, Path: "/metrics", Token: "scrape-token"}
+	r := gin.New()
+	r.Use(common.MetricsMiddleware())
+	r.GET(cfg.Path, common.MetricsHandler(cfg))
+	r.GET("/roles/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	scrape := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer scrape-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		body, _ := io.ReadAll(w.Body)
+		return string(body)
+	}
+	// 指標註冊在進程級的 MetricsRegistry 上，按本次測試前後的差值比較
+	series := map[string]float64{
+		`http_requests_total{method="GET",route="/roles/:id",status="200"}`:                            3,
+		`http_requests_total{method="GET",route="unmatched",status="404"}`:                             1,
+		`http_request_duration_seconds_bucket{method="GET",route="/roles/:id",status="200",le="+Inf"}`: 3,
+	}
+	before := scrape()
+
+	for _, path := range []string{"/roles/1", "/roles/2", "/roles/3", "/no-such-path"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("scrape without token = %d, want 401", w.Code)
+	}
+
+	out := scrape()
+	for name, want := range series {
+		if got := metricValue(out, name) - metricValue(before, name); got != want {
+			t.Errorf("%s increased by %v, want %v", name, got, want)
+		}
+	}
+	for _, want := range []string{
+		`request_log_queue_capacity `,
+		`request_logs_total{outcome="dropped"}`,
+		`go_goroutines `,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+	if strings.Contains(out, `route="/roles/1"`) {
+		t.Error("raw paths must not be used as labels")
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"test-git/db"
+	"test-git/migrations"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migs, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) < 6 {
+		t.Fatalf("loaded %d migrations, want at least 6", len(migs))
+	}
+	for i, mig := range migs {
+		if mig.Version != uint(i+1) {
+			t.Errorf("migration %d has version %d", i, mig.Version)
+		}
+		if strings.TrimSpace(mig.Down) == "" {
+			t.Errorf("migration %d_%s has no down script", mig.Version, mig.Name)
+		}
+	}
+	if migs[1].Name != "add_roles_table" || !strings.Contains(migs[1].Up, "CREATE TABLE IF NOT EXISTS roles") {
+		t.Errorf("migration 2 = %s", migs[1].Name)
+	}
+}
+
+func TestLoadMigrationsValidation(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+	for name, fsys := range map[string]fstest.MapFS{
+		"gap": {
+			"000001_a.up.sql": file("SELECT 1"),
+			"000003_c.up.sql": file("SELECT 1"),
+		},
+		"empty up": {
+			"000001_a.up.sql":   file("  \n"),
+			"000001_a.down.sql": file("SELECT 1"),
+		},
+		"name mismatch": {
+			"000001_a.up.sql":   file("SELECT 1"),
+			"000001_b.down.sql": file("SELECT 1"),
+		},
+	} {
+		if _, err := db.LoadMigrations(fsys); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	migs, err := db.LoadMigrations(fstest.MapFS{
+		"README.md":         file("ignored"),
+		"000002_b.up.sql":   file("SELECT 2"),
+		"000001_a.up.sql":   file("SELECT 1"),
+		"000001_a.down.sql": file("SELECT -1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 2 || migs[0].Down != "SELECT -1" || migs[1].Up != "SELECT 2" {
+		t.Errorf("migrations = %+v", migs)
+	}
+}
+
+func TestMigrationStatusErr(t *testing.T) {
+	if err := (db.MigrationStatus{Current: 6, Latest: 6}).Err(); err != nil {
+		t.Errorf("up to date: %v", err)
+	}
+	if err := (db.MigrationStatus{Current: 7, Latest: 6}).Err(); err != nil {
+		t.Errorf("newer schema should be allowed: %v", err)
+	}
+	if err := (db.MigrationStatus{Current: 4, Latest: 6}).Err(); err == nil || !strings.Contains(err.Error(), "migrate up") {
+		t.Errorf("behind: %v", err)
+	}
+	if err := (db.MigrationStatus{Current: 6, Latest: 6, Dirty: true}).Err(); !errors.Is(err, db.ErrSchemaDirty) {
+		t.Errorf("dirty: %v", err)
+	}
+}
+
+func TestMigrateUpRefusesExistingTables(t *testing.T) {
+	// 沒有版本記錄，但 AutoMigrate 已經創建了 roles
+	gdb, conn := scriptedDB(t, map[string][]driver.Value{
+		"to_regclass($1) IS NOT NULL": {false},
+		"pg_table_is_visible":         {"roles"},
+	})
+	migrator, err := db.NewMigrator(gdb, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up(context.Background(), 0)
+	if err == nil || !strings.Contains(err.Error(), "table roles") ||
+		!strings.Contains(err.Error(), "`migrate up 1`, then `migrate force 2`") {
+		t.Fatalf("up on an AutoMigrate database: %v", err)
+	}
+	if i := indexOf(conn.executed(), "CREATE TABLE IF NOT EXISTS books"); i >= 0 {
+		t.Error("migrations ran before the existing table was reported")
+	}
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"testing"
+
+	"test-git/policy"
+)
+
+func TestSubjectCanAccess(t *testing.T) {
+	player := policy.Subject{UserID: "alice", Roles: []policy.Role{policy.Player}}
+	keeper := policy.Subject{UserID: "kate", Roles: []policy.Role{policy.Keeper}}
+	admin := policy.Subject{UserID: "root", Roles: []policy.Role{policy.Admin}}
+	anonymous := policy.Subject{}
+
+	tests := []struct {
+		name    string
+		subject policy.Subject
+		owner   string
+		own     policy.Permission
+		any     policy.Permission
+		want    bool
+	}{
+		{"player reads own role", player, "alice", policy.RoleRead, policy.RoleReadAny, true},
+		{"player reads other role", player, "bob", policy.RoleRead, policy.RoleReadAny, false},
+		{"player deletes other role", player, "bob", policy.RoleDelete, policy.RoleDeleteAny, false},
+		{"keeper reads other role", keeper, "bob", policy.RoleRead, policy.RoleReadAny, true},
+		{"keeper updates other role", keeper, "bob", policy.RoleUpdate, policy.RoleUpdateAny, false},
+		{"admin deletes other role", admin, "bob", policy.RoleDelete, policy.RoleDeleteAny, true},
+		{"anonymous reads unowned role", anonymous, "", policy.RoleRead, policy.RoleReadAny, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.subject.CanAccess(tt.owner, tt.own, tt.any); got != tt.want {
+				t.Errorf("CanAccess(%q, %s, %s) = %v, want %v", tt.owner, tt.own, tt.any, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubjectCan(t *testing.T) {
+	tests := []struct {
+		roles string
+		perm  policy.Permission
+		want  bool
+	}{
+		{"player", policy.BookRead, true},
+		{"player", policy.BookWrite, false},
+		{"player,keeper", policy.BookWrite, true},
+		{"keeper", policy.LogRead, false},
+		{"admin", policy.LogRead, true},
+		{"superuser", policy.BookRead, false},
+	}
+	for _, tt := range tests {
+		subject := policy.Subject{Roles: policy.ParseRoles(tt.roles)}
+		if got := subject.Can(tt.perm); got != tt.want {
+			t.Errorf("roles %q Can(%s) = %v, want %v", tt.roles, tt.perm, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"test-git/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProfilerMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	var recorded []common.RequestProfile
+
+	r := gin.New()
+	r.Use(common.RequestIDMiddleware())
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		if p, ok := common.GetRequestProfile(c); ok {
+			recorded = append(recorded, p)
+		}
+	})
+	cfg := common.ProfilerConfig{
+		SampleRate:     1,
+		RingSize:       10,
+		SlowThreshold:  20 * time.Millisecond,
+		ProfileDir:     dir,
+		MaxProfileTime: 5 * time.Second,
+		MaxProfiles:    5,
+	}
+	if err := common.ConfigureProfiler(cfg); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(common.ProfilerMiddleware(cfg))
+	r.GET("/fast", func(c *gin.Context) {
+		_ = make([]byte, 8<<20)
+		c.Status(http.StatusOK)
+	})
+	r.GET("/slow/:id", func(c *gin.Context) {
+		time.Sleep(80 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow/1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, the profiler must not touch the response", w.Code)
+	}
+
+	if len(recorded) != 4 {
+		t.Fatalf("recorded %d profiles, want 4", len(recorded))
+	}
+	if recorded[0].AllocBytes < 8<<20 || recorded[0].Goroutines == 0 {
+		t.Fatalf("fast profile = %+v", recorded[0])
+	}
+	slow := recorded[3]
+	if slow.CPUProfile == "" || slow.Route != "/slow/:id" {
+		t.Fatalf("slow request should carry a cpu profile: %+v", slow)
+	}
+	if _, ok := common.CPUProfilePath(slow.CPUProfile); !ok {
+		t.Fatalf("cpu profile %q not found", slow.CPUProfile)
+	}
+	if _, ok := common.CPUProfilePath("../secrets.pprof"); ok {
+		t.Fatal("path traversal must be rejected")
+	}
+
+	top := common.TopRouteProfiles(1, common.ProfileByDuration)
+	if len(top) != 1 || top[0].Route != "/slow/:id" || len(top[0].CPUProfiles) != 1 {
+		t.Fatalf("top by duration = %+v", top)
+	}
+	top = common.TopRouteProfiles(5, common.ProfileByAlloc)
+	if len(top) != 2 || top[0].Route != "/fast" || top[0].Count != 3 {
+		t.Fatalf("top by alloc = %+v", top)
+	}
+}
+
+func profileNames(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.pprof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestProfilerKeepsLastProfiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	// 之前運行留下的文件
+	old := []string{"20200101T000000-a.pprof", "20200101T000001-b.pprof", "20200101T000002-c.pprof"}
+	for _, name := range old {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := common.ProfilerConfig{
+		SampleRate:     1,
+		RingSize:       1,
+		SlowThreshold:  20 * time.Millisecond,
+		ProfileDir:     dir,
+		MaxProfileTime: 5 * time.Second,
+		MaxProfiles:    2,
+	}
+	if err := common.ConfigureProfiler(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if names := profileNames(t, dir); len(names) != 2 || names[0] != old[1] {
+		t.Fatalf("profiles after configure = %v, want the last 2", names)
+	}
+
+	r := gin.New()
+	r.Use(common.RequestIDMiddleware())
+	r.Use(common.ProfilerMiddleware(cfg))
+	r.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(80 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+
+	// 新的 profile 擠掉最舊的文件
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	names := profileNames(t, dir)
+	if len(names) != 2 || names[0] != old[2] {
+		t.Fatalf("profiles after slow request = %v", names)
+	}
+	// 採樣在環形緩衝區中被覆蓋後，它的 profile 也刪除
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if names := profileNames(t, dir); len(names) != 1 || names[0] != old[2] {
+		t.Fatalf("profiles after ring overwrite = %v", names)
+	}
+}
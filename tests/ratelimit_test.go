@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"test-git/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    common.RateLimit
+		wantErr bool
+	}{
+		{"10/s:20", common.RateLimit{Rate: 10, Burst: 20}, false},
+		{"60/m:5", common.RateLimit{Rate: 1, Burst: 5}, false},
+		{"10/d:5", common.RateLimit{}, true},
+		{"10/s", common.RateLimit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := common.ParseRateLimit(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRateLimit(%q) = %+v, %v; want %+v, err %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := common.NewMemoryRateLimitStore()
+	limit := common.RateLimit{Rate: 1, Burst: 2}
+	now := time.Unix(1700000000, 0)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := store.Take(ctx, "k", limit, now); !ok {
+			t.Fatalf("take %d within burst rejected", i)
+		}
+	}
+	ok, retryAfter, _ := store.Take(ctx, "k", limit, now)
+	if ok || retryAfter != time.Second {
+		t.Fatalf("take over burst = %v, %v; want false, 1s", ok, retryAfter)
+	}
+	if ok, _, _ := store.Take(ctx, "other", limit, now); !ok {
+		t.Errorf("other key should have its own bucket")
+	}
+	if ok, _, _ := store.Take(ctx, "k", limit, now.Add(time.Second)); !ok {
+		t.Errorf("take after refill rejected")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := common.RateLimitConfig{
+		Enabled: true,
+		Default: common.RateLimit{Rate: 100, Burst: 100},
+		Routes:  map[string]common.RateLimit{"POST /roles": {Rate: 0.5, Burst: 1}},
+	}
+	r := gin.New()
+	r.Use(common.RateLimitMiddleware(cfg, common.NewMemoryRateLimitStore()))
+	r.POST("/roles", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/roles", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/roles", nil))
+		return w
+	}
+
+	if w := do(http.MethodPost); w.Code != http.StatusOK {
+		t.Fatalf("first POST status = %d", w.Code)
+	}
+	w := do(http.MethodPost)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("second POST = %d, Retry-After %q; want 429, 2", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := do(http.MethodGet); w.Code != http.StatusOK {
+		t.Errorf("GET uses default limit, status = %d", w.Code)
+	}
+}
+
+func TestRateLimitIgnoresForgedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := common.RateLimitConfig{Enabled: true, Default: common.RateLimit{Rate: 0.5, Burst: 1}}
+	proxies, err := common.ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	if err := common.SetTrustedProxies(r, common.GatewayConfig{TrustedProxies: proxies}); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(common.RateLimitMiddleware(cfg, common.NewMemoryRateLimitStore()))
+	r.GET("/roles", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/roles", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 不可信的對端每次換一個 X-Forwarded-For，仍然按對端地址限流
+	if code := do("203.0.113.7:1234", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request status = %d", code)
+	}
+	if code := do("203.0.113.7:1234", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("forged X-Forwarded-For status = %d, want 429", code)
+	}
+
+	// 可信代理轉發的不同客戶端各自限流
+	if code := do("10.0.0.1:1234", "198.51.100.3"); code != http.StatusOK {
+		t.Errorf("client behind trusted proxy status = %d", code)
+	}
+	if code := do("10.0.0.1:1234", "198.51.100.4"); code != http.StatusOK {
+		t.Errorf("another client behind trusted proxy status = %d", code)
+	}
+}
+
+// readCounter 記錄請求體被讀取的字節數
+type readCounter struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func TestRateLimitedUploadIsNotParsed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &captureSink{}
+	writer := common.StartLogWriter(sink)
+	cfg := common.RateLimitConfig{Enabled: true, Default: common.RateLimit{Rate: 0.5, Burst: 1}}
+	r := gin.New()
+	r.Use(common.RequestLogMiddleware(nil))
+	r.Use(common.RateLimitMiddleware(cfg, common.NewMemoryRateLimitStore()))
+	r.POST("/roles", func(c *gin.Context) {
+		if _, err := c.FormFile("file"); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	upload := func() (int, int64) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "role.json")
+		part.Write([]byte(`{"name":"n"}`))
+		mw.Close()
+		counter := &readCounter{r: &body}
+		req := httptest.NewRequest(http.MethodPost, "/roles", counter)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, counter.n.Load()
+	}
+
+	if code, read := upload(); code != http.StatusOK || read == 0 {
+		t.Fatalf("first upload = %d, read %d bytes", code, read)
+	}
+	if code, read := upload(); code != http.StatusTooManyRequests || read != 0 {
+		t.Fatalf("throttled upload = %d, read %d bytes; want 429 without reading the body", code, read)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := writer.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	files := map[int]string{}
+	for _, l := range sink.logs {
+		files[l.StatusCode] = l.FileName
+	}
+	if len(sink.logs) != 2 || files[http.StatusOK] != "role.json" || files[http.StatusTooManyRequests] != "" {
+		t.Errorf("logged files = %v", files)
+	}
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"testing"
+
+	"test-git/common"
+)
+
+func TestRedactorJSONPaths(t *testing.T) {
+	r, err := common.NewRedactor([]string{"$..token", "$.user.openid", "$.items[*].secret", "$.list[1]"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := `{"token":"t1","data":{"token":"t2","keep":1},"user":{"openid":"o1","name":"n"},` +
+		`"items":[{"secret":"s1"},{"secret":"s2","id":2}],"list":[1,2,3]}`
+	want := `{"data":{"keep":1,"token":"[REDACTED]"},"items":[{"secret":"[REDACTED]"},{"id":2,"secret":"[REDACTED]"}],` +
+		`"list":[1,"[REDACTED]",3],"token":"[REDACTED]","user":{"name":"n","openid":"[REDACTED]"}}`
+	if got := string(r.RedactJSON([]byte(in))); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestRedactorPatterns(t *testing.T) {
+	r, err := common.NewRedactor(nil, []string{`(?i)bearer\s+([A-Za-z0-9._-]+)`, `(?:^|&)openid=([^&]*)`, `\d{11}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"Authorization: Bearer abc.def":  "Authorization: Bearer [REDACTED]",
+		"page=1&openid=o123&pageSize=10": "page=1&openid=[REDACTED]&pageSize=10",
+		"phone 13800138000":              "phone [REDACTED]",
+		"nothing here":                   "nothing here",
+	}
+	for in, want := range cases {
+		if got := r.RedactString(in); got != want {
+			t.Errorf("RedactString(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	// 沒有路徑規則時，截斷的 JSON 只應用正則
+	if got := string(r.RedactJSON([]byte(`{"auth":"Bearer xyz","cut`))); got != `{"auth":"Bearer [REDACTED]","cut` {
+		t.Fatalf("truncated = %s", got)
+	}
+}
+
+func TestRedactorTruncatedJSON(t *testing.T) {
+	r, err := common.NewRedactor([]string{"$..openid", "$..token", "$.user.code"}, []string{`(?i)bearer\s+([A-Za-z0-9._-]+)`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := `{"user":{"openid":"o123","token":"abc\"def","code":1024,"name":"n"},"auth":"Bearer xyz","openid":"o4`
+	want := `{"user":{"openid":"[REDACTED]","token":"[REDACTED]","code":"[REDACTED]","name":"n"},"auth":"Bearer [REDACTED]","openid":"[REDACTED]"`
+	if got := string(r.RedactJSON([]byte(in))); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// 以下標結尾的路徑無法按 key 匹配，整段遮蔽
+	r, err = common.NewRedactor([]string{"$..openid", "$.list[1]"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(r.RedactJSON([]byte(`{"list":["a","b`))); got != "[REDACTED]" {
+		t.Fatalf("truncated with index path = %s", got)
+	}
+}
+
+func TestNewRedactorRejectsInvalidRules(t *testing.T) {
+	if _, err := common.NewRedactor([]string{"token"}, nil); err == nil {
+		t.Fatal("path without $ should fail")
+	}
+	if _, err := common.NewRedactor(nil, []string{"("}); err == nil {
+		t.Fatal("invalid regex should fail")
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"test-git/common"
+	"test-git/model"
+	"test-git/replay"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReplayRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("replay-test-secret")
+	r := gin.New()
+	r.Use(common.SessionMiddleware(common.NewSessionSigner(secret, time.Hour)))
+	r.POST("/roles", func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil || file.Filename != "role.json" {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	r.PUT("/roles/:id", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		if common.GetUserID(c) != "o-user" || string(body) != `{"name":"n"}` {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/books", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	userKey := []byte("replay-user-key")
+	now := time.Now()
+	logs := []model.RequestLog{
+		{RequestID: "1", Method: "POST", Path: "/roles", UserID: "o-user", StatusCode: 200, CreatedAt: now,
+			FileName: "role.json", ContentType: "multipart/form-data", FileContentJSON: model.JSONRawMessage(`{"a":1}`)},
+		{RequestID: "2", Method: "PUT", Path: "/roles/3", Route: "/roles/:id", UserID: common.UserRef(userKey, "o-user"), StatusCode: 204, CreatedAt: now,
+			ContentType: "application/json", RequestBody: `{"name":"n"}`},
+		{RequestID: "3", Method: "GET", Path: "/books", UserID: "o-user", StatusCode: 200, CreatedAt: now},
+		{RequestID: "4", Method: "POST", Path: "/roles", UserID: "o-user", StatusCode: 200, CreatedAt: now, FileName: "role.json"},
+		{RequestID: "5", Method: "GET", Path: "/admin/roles", StatusCode: 200, CreatedAt: now},
+		{RequestID: "6", Method: "GET", Path: "/books", UserID: common.UserRef([]byte("other-key"), "o-user"), StatusCode: 500, CreatedAt: now},
+		{RequestID: "7", Method: "PUT", Path: "/roles/3", Route: "/roles/:id", UserID: "o-user", StatusCode: 204, CreatedAt: now,
+			ContentType: "application/json", RequestBody: `{"name":"[REDACTED]"}`, RequestRedacted: true},
+	}
+	report := replay.Run(context.Background(), logs, replay.Options{
+		BaseURL:       srv.URL,
+		Concurrency:   2,
+		Identity:      replay.IdentitySession,
+		SessionSecret: secret,
+		UserRefKey:    userKey,
+	})
+
+	if report.Sent != 3 || report.Matched != 2 || report.Mismatched != 1 || report.Errors != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.ByEndpoint["GET /books 200->500"] != 1 {
+		t.Fatalf("by endpoint = %v", report.ByEndpoint)
+	}
+	if report.Skipped["file content expired"] != 1 || report.Skipped["admin request without admin token"] != 1 ||
+		report.Skipped["user reference cannot be resolved"] != 1 || report.Skipped["captured request redacted"] != 1 {
+		t.Fatalf("skipped = %v", report.Skipped)
+	}
+}
+
+func TestReplayReadNDJSON(t *testing.T) {
+	input := `{"request_id":"b","method":"GET","path":"/books","created_at":"2026-10-19T10:00:02Z"}
+{"request_id":"a","method":"GET","path":"/books","created_at":"2026-10-19T10:00:01Z"}
+
+{"request_id":"late","method":"GET","path":"/books","created_at":"2026-10-19T11:00:00Z"}
+`
+	from := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	logs, err := replay.ReadNDJSON(strings.NewReader(input), from, from.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[0].RequestID != "a" || logs[1].RequestID != "b" {
+		t.Fatalf("logs = %+v", logs)
+	}
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"test-git/db"
+	"test-git/handler"
+	"test-git/repository"
+	"test-git/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder 記錄 DryRun 模式下生成的 SQL
+type sqlRecorder struct {
+	mu   sync.Mutex
+	sqls []string
+}
+
+func (r *sqlRecorder) LogMode(logger.LogLevel) logger.Interface      { return r }
+func (r *sqlRecorder) Info(context.Context, string, ...interface{})  {}
+func (r *sqlRecorder) Warn(context.Context, string, ...interface{})  {}
+func (r *sqlRecorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sqls = append(r.sqls, sql)
+}
+
+func (r *sqlRecorder) all() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.sqls, "\n")
+}
+
+// dryRunDatabases 把日志庫換成只生成 SQL 的連接，主庫置空，和內存存儲模式一樣；測試結束後恢復
+func dryRunDatabases(t *testing.T) *sqlRecorder {
+	t.Helper()
+	recorder := &sqlRecorder{}
+	gdb := dialectOnlyDB(t).Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true, Logger: recorder})
+	mainDB, logDB := db.DB, db.LogDB
+	db.DB, db.LogDB = nil, gdb
+	t.Cleanup(func() { db.DB, db.LogDB = mainDB, logDB })
+	return recorder
+}
+
+func serveReport(audits repository.AuditRepository, query string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin/reports/endpoints", handler.AdminEndpointReportHandler(service.NewRequestLogService(audits)))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/reports/endpoints?"+query, nil))
+	return w
+}
+
+func TestEndpointReportHandlerRejectsBadParams(t *testing.T) {
+	for _, query := range []string{
+		"limit=abc",
+		"limit=0",
+		"limit=-5",
+		"from=yesterday",
+		"to=2025-03-01",
+		"from=2025-03-02T00:00:00Z&to=2025-03-01T00:00:00Z",
+		"bucket=fast",
+		"from=2025-03-01T00:00:00Z&to=2025-03-02T00:00:00Z&bucket=1s",
+	} {
+		if w := serveReport(repository.NewMemoryAuditRepository(), query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestEndpointReportWithoutLogDB(t *testing.T) {
+	logDB := db.LogDB
+	db.LogDB = nil
+	t.Cleanup(func() { db.LogDB = logDB })
+	if w := serveReport(repository.NewMemoryAuditRepository(), ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+}
+
+func TestEndpointReportQuery(t *testing.T) {
+	recorder := dryRunDatabases(t)
+	audits := repository.NewMemoryAuditRepository()
+	w := serveReport(audits, "from=2025-03-01T00:00:00Z&to=2025-03-01T01:00:00Z&bucket=5m&method=post&route=/roles/:id&limit=1000")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp handler.EndpointReportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.From != "2025-03-01T00:00:00Z" || resp.To != "2025-03-01T01:00:00Z" || resp.BucketSeconds != 300 ||
+		resp.Endpoints == nil || resp.Series == nil {
+		t.Errorf("response = %+v", resp)
+	}
+
+	sql := recorder.all()
+	for _, want := range []string{
+		"LIMIT 200", // limit 超過上限時按上限查詢
+		"created_at >= '2025-03-01 00:00:00'",
+		"/ 300) * 300",
+		"'POST' = '' OR method = 'POST'",
+		"'/roles/:id' = '' OR COALESCE(NULLIF(route, ''), path) = '/roles/:id'",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("queries missing %q:\n%s", want, sql)
+		}
+	}
+	// 審計記錄寫入注入的存儲，不依賴主庫
+	if list := audits.List(); len(list) != 1 || list[0].Action != service.AuditViewEndpointReport {
+		t.Errorf("audits = %+v", list)
+	}
+}
+
+func TestEndpointReportDefaults(t *testing.T) {
+	recorder := dryRunDatabases(t)
+	w := serveReport(repository.NewMemoryAuditRepository(), "from=2025-03-01T00:00:00Z&to=2025-03-01T01:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp handler.EndpointReportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// 默認分 60 個桶
+	if resp.BucketSeconds != 60 {
+		t.Errorf("bucket_seconds = %d, want 60", resp.BucketSeconds)
+	}
+	if sql := recorder.all(); !strings.Contains(sql, "LIMIT 50") || !strings.Contains(sql, "'' = '' OR method = ''") {
+		t.Errorf("default queries:\n%s", sql)
+	}
+}
@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"test-git/db"
+	"test-git/migrations"
+	"test-git/model"
+	"test-git/repository"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestMemoryRepositories(t *testing.T) {
+	testRepositories(t, repository.NewMemory())
+}
+
+// TestGormRepositories 與 TestSchemaDrift 一樣需要 TEST_DATABASE_DSN，確認內存實現和 gorm 實現行為一致
+func TestGormRepositories(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	gdb, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := db.NewMigrator(gdb, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	testRepositories(t, repository.NewGorm(gdb))
+}
+
+func testRepositories(t *testing.T, repos repository.Repositories) {
+	t.Run("roles", func(t *testing.T) { testRoleRepository(t, repos.Roles) })
+	t.Run("books", func(t *testing.T) { testBookRepository(t, repos.Books) })
+	t.Run("users", func(t *testing.T) { testUserRepository(t, repos.Users) })
+	t.Run("transaction", func(t *testing.T) { testTransaction(t, repos) })
+}
+
+func testRoleRepository(t *testing.T, repo repository.RoleRepository) {
+	ctx := context.Background()
+	// 每次運行使用新的所有者，共享的測試庫裡不會讀到其他運行的數據
+	owner := fmt.Sprintf("owner-%d", time.Now().UnixNano())
+	other := owner + "-other"
+
+	var ids []uint
+	for i, wxUserID := range []string{owner, other, owner, owner} {
+		role := &model.Role{
+			Name:        fmt.Sprintf("role-%d", i),
+			WxUserId:    wxUserID,
+			Description: "desc",
+			RoleData:    []byte(`{"basic_info":{}}`),
+		}
+		if err := repo.Create(ctx, role); err != nil {
+			t.Fatal(err)
+		}
+		if role.ID == 0 || role.CreatedAt.IsZero() {
+			t.Fatalf("Create did not fill ID and timestamps: %+v", role)
+		}
+		ids = append(ids, role.ID)
+	}
+	t.Cleanup(func() {
+		for _, id := range ids {
+			repo.HardDelete(ctx, id)
+		}
+	})
+
+	roles, total, err := repo.List(ctx, repository.RoleFilter{WxUserID: owner}, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(roles) != 1 || roles[0].ID != ids[2] {
+		t.Fatalf("List page 2 = %d roles of %d, want role %d of 3", len(roles), total, ids[2])
+	}
+
+	// 零值字段不更新
+	if err := repo.Update(ctx, ids[0], &model.Role{Name: "renamed"}); err != nil {
+		t.Fatal(err)
+	}
+	role, err := repo.Get(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.Name != "renamed" || role.Description != "desc" || role.WxUserId != owner {
+		t.Errorf("after Update = %+v", role)
+	}
+	role.Name = "changed by caller"
+	if again, _ := repo.Get(ctx, ids[0]); again.Name != "renamed" {
+		t.Error("modifying a returned role changed the stored role")
+	}
+
+	if err := repo.Delete(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, ids[0]); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Get deleted role err = %v, want ErrRecordNotFound", err)
+	}
+	if err := repo.Update(ctx, ids[0], &model.Role{Name: "x"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Update deleted role err = %v, want ErrRecordNotFound", err)
+	}
+	if _, total, _ := repo.List(ctx, repository.RoleFilter{WxUserID: owner}, 0, -1); total != 2 {
+		t.Errorf("List after delete total = %d, want 2", total)
+	}
+	if err := repo.Delete(ctx, ids[0]); err != nil {
+		t.Errorf("deleting twice: %v", err)
+	}
+
+	deleted, _, err := repo.List(ctx, repository.RoleFilter{WxUserID: owner, Deleted: repository.DeletedOnly}, 0, -1)
+	if err != nil || len(deleted) != 1 || deleted[0].ID != ids[0] {
+		t.Errorf("List only deleted = %+v, %v", deleted, err)
+	}
+	all, _, err := repo.List(ctx, repository.RoleFilter{WxUserID: owner, Deleted: repository.DeletedInclude, Order: repository.OrderIDDesc}, 0, -1)
+	if err != nil || len(all) != 3 || all[0].ID != ids[3] || all[2].ID != ids[0] {
+		t.Errorf("List including deleted, newest first = %+v, %v", all, err)
+	}
+	if role, err := repo.GetUnscoped(ctx, ids[0]); err != nil || !role.DeletedAt.Valid {
+		t.Errorf("GetUnscoped deleted role = %+v, %v", role, err)
+	}
+	if err := repo.Restore(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, ids[0]); err != nil {
+		t.Errorf("Get restored role: %v", err)
+	}
+	if err := repo.Restore(ctx, 1<<31); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Restore missing role err = %v, want ErrRecordNotFound", err)
+	}
+
+	// 關鍵字按字面匹配，% 和 _ 不是通配符
+	if err := repo.Update(ctx, ids[2], &model.Role{Name: "Done 100%_ok"}); err != nil {
+		t.Fatal(err)
+	}
+	for keyword, want := range map[string]int64{"100%_": 1, "done": 1, "%": 1, "_": 1, "role-": 1, "DESC": 3} {
+		if _, total, err := repo.List(ctx, repository.RoleFilter{WxUserID: owner, Keyword: keyword}, 0, 0); err != nil || total != want {
+			t.Errorf("List keyword %q total = %d, %v, want %d", keyword, total, err, want)
+		}
+	}
+
+	if err := repo.HardDelete(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := repo.List(ctx, repository.RoleFilter{WxUserID: other}, 0, 10); total != 0 {
+		t.Errorf("List after hard delete total = %d, want 0", total)
+	}
+}
+
+func testBookRepository(t *testing.T, repo repository.BookRepository) {
+	ctx := context.Background()
+	_, before, err := repo.List(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book := &model.Book{Title: "title", Author: "author", Price: 9.5}
+	if err := repo.Create(ctx, book); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.HardDelete(ctx, book.ID) })
+
+	books, total, err := repo.List(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != before+1 || len(books) != 0 {
+		t.Errorf("List with limit 0 = %d books of %d, want 0 of %d", len(books), total, before+1)
+	}
+
+	if err := repo.Update(ctx, book.ID, &model.Book{Price: 12}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.Get(ctx, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "title" || got.Price != 12 {
+		t.Errorf("after Update = %+v", got)
+	}
+	if err := repo.Update(ctx, book.ID+1_000_000, &model.Book{Price: 1}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Update missing book err = %v, want ErrRecordNotFound", err)
+	}
+
+	if err := repo.Delete(ctx, book.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, book.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Get deleted book err = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func testUserRepository(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	wxUserID := fmt.Sprintf("user-%d", time.Now().UnixNano())
+	if _, err := repo.FindByWxUserID(ctx, wxUserID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("FindByWxUserID before create err = %v", err)
+	}
+
+	user := &model.User{WxUserId: wxUserID, Roles: "keeper"}
+	created, err := repo.FirstOrCreate(ctx, user)
+	if err != nil || !created || user.ID == 0 {
+		t.Fatalf("FirstOrCreate = %v, %v, %+v", created, err, user)
+	}
+	again := &model.User{WxUserId: wxUserID, Roles: "player"}
+	created, err = repo.FirstOrCreate(ctx, again)
+	if err != nil || created || again.ID != user.ID || again.Roles != "keeper" {
+		t.Errorf("second FirstOrCreate = %v, %v, %+v", created, err, again)
+	}
+
+	found, err := repo.FindByWxUserID(ctx, wxUserID)
+	if err != nil || found.ID != user.ID {
+		t.Errorf("FindByWxUserID = %+v, %v", found, err)
+	}
+}
+
+// testTransaction 事務失敗時撤銷其中的全部寫入
+func testTransaction(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	owner := fmt.Sprintf("tx-%d", time.Now().UnixNano())
+	var id uint
+	errAbort := errors.New("abort")
+	err := repos.Transaction(ctx, func(tx repository.Repositories) error {
+		role := &model.Role{Name: "tx", WxUserId: owner, RoleData: []byte(`{}`)}
+		if err := tx.Roles.Create(ctx, role); err != nil {
+			return err
+		}
+		id = role.ID
+		if _, err := tx.Users.FirstOrCreate(ctx, &model.User{WxUserId: owner}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Transaction err = %v, want the error returned by fn", err)
+	}
+	if _, err := repos.Roles.GetUnscoped(ctx, id); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("role created in a rolled back transaction: %v", err)
+	}
+	if _, err := repos.Users.FindByWxUserID(ctx, owner); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("user created in a rolled back transaction: %v", err)
+	}
+
+	err = repos.Transaction(ctx, func(tx repository.Repositories) error {
+		role := &model.Role{Name: "tx", WxUserId: owner, RoleData: []byte(`{}`)}
+		if err := tx.Roles.Create(ctx, role); err != nil {
+			return err
+		}
+		id = role.ID
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repos.Roles.HardDelete(ctx, id) })
+	if _, err := repos.Roles.Get(ctx, id); err != nil {
+		t.Errorf("role created in a committed transaction: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"test-git/db"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestLoadRequestLogPartitionConfig(t *testing.T) {
+	t.Setenv("REQUEST_LOG_RETENTION_DAYS", "14")
+	t.Setenv("REQUEST_LOG_FILE_RETENTION_DAYS", "3")
+	cfg, err := db.LoadRequestLogPartitionConfig(os.LookupEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Retention != 14 || cfg.FileContentRetention != 3 || cfg.Premake != 3 || cfg.Interval != time.Hour {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+
+	t.Setenv("REQUEST_LOG_FILE_RETENTION_DAYS", "30")
+	if _, err := db.LoadRequestLogPartitionConfig(os.LookupEnv); err == nil {
+		t.Fatal("file retention longer than retention should fail")
+	}
+
+	t.Setenv("REQUEST_LOG_FILE_RETENTION_DAYS", "0")
+	if _, err := db.LoadRequestLogPartitionConfig(os.LookupEnv); err == nil {
+		t.Fatal("zero days should fail")
+	}
+}
+
+func TestRequestLogPartitionName(t *testing.T) {
+	// 分區按 UTC 日期劃分
+	day := time.Date(2026, 10, 20, 1, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	if got := db.RequestLogPartitionName(day); got != "request_logs_p20261019" {
+		t.Fatalf("name = %s", got)
+	}
+}
+
+// scriptedConn 記錄執行的語句，查詢按最長匹配的 SQL 片段返回預設的單列結果；用來檢查需要事務的維護流程生成的 SQL
+type scriptedConn struct {
+	mu      sync.Mutex
+	stmts   []string
+	results map[string][]driver.Value // SQL 片段 -> 每行一個值
+}
+
+func (c *scriptedConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *scriptedConn) Driver() driver.Driver                        { return nil }
+func (c *scriptedConn) Prepare(query string) (driver.Stmt, error) {
+	return &scriptedStmt{conn: c, query: query}, nil
+}
+func (c *scriptedConn) Close() error              { return nil }
+func (c *scriptedConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *scriptedConn) Commit() error             { return nil }
+func (c *scriptedConn) Rollback() error           { return nil }
+
+func (c *scriptedConn) record(query string) []driver.Value {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stmts = append(c.stmts, query)
+	var match string
+	for fragment := range c.results {
+		if strings.Contains(query, fragment) && len(fragment) > len(match) {
+			match = fragment
+		}
+	}
+	return c.results[match]
+}
+
+func (c *scriptedConn) executed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.stmts...)
+}
+
+type scriptedStmt struct {
+	conn  *scriptedConn
+	query string
+}
+
+func (s *scriptedStmt) Close() error  { return nil }
+func (s *scriptedStmt) NumInput() int { return -1 }
+func (s *scriptedStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.conn.record(s.query)
+	return driver.RowsAffected(0), nil
+}
+func (s *scriptedStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &scriptedRows{values: s.conn.record(s.query)}, nil
+}
+
+type scriptedRows struct {
+	values []driver.Value
+}
+
+func (r *scriptedRows) Columns() []string { return []string{"value"} }
+func (r *scriptedRows) Close() error      { return nil }
+func (r *scriptedRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func scriptedDB(t *testing.T, results map[string][]driver.Value) (*gorm.DB, *scriptedConn) {
+	t.Helper()
+	conn := &scriptedConn{results: results}
+	gdb, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(conn)}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gdb, conn
+}
+
+func indexOf(stmts []string, fragment string) int {
+	for i, stmt := range stmts {
+		if strings.Contains(stmt, fragment) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestEnsureRequestLogPartitionsCreatesDefaultPartition(t *testing.T) {
+	// 表不存在，所有日分區都還沒有
+	gdb, conn := scriptedDB(t, map[string][]driver.Value{
+		"relkind":                     {},
+		"to_regclass($1) IS NOT NULL": {false},
+	})
+	if err := db.EnsureRequestLogPartitions(gdb, db.RequestLogPartitionConfig{Retention: 30, Premake: 1}); err != nil {
+		t.Fatal(err)
+	}
+	stmts := conn.executed()
+
+	createDefault := indexOf(stmts, "CREATE TABLE request_logs_default PARTITION OF request_logs DEFAULT")
+	if createDefault < 0 {
+		t.Fatalf("default partition not created:\n%s", strings.Join(stmts, "\n"))
+	}
+
+	today := db.RequestLogPartitionName(time.Now())
+	create := indexOf(stmts, "CREATE TABLE "+today+" (LIKE request_logs")
+	move := indexOf(stmts, "DELETE FROM request_logs_default")
+	attach := indexOf(stmts, "ATTACH PARTITION "+today)
+	// 先從默認分區移出同一天的行，再掛上新分區
+	if create < createDefault || move < create || attach < move {
+		t.Errorf("partition %s statements out of order (default %d, create %d, move %d, attach %d):\n%s",
+			today, createDefault, create, move, attach, strings.Join(stmts, "\n"))
+	}
+	if !strings.Contains(stmts[move], "INSERT INTO "+today) {
+		t.Errorf("moved rows not inserted into %s: %s", today, stmts[move])
+	}
+	if indexOf(stmts, "ATTACH PARTITION "+db.RequestLogPartitionName(time.Now().AddDate(0, 0, 1))) < 0 {
+		t.Errorf("premade partition missing:\n%s", strings.Join(stmts, "\n"))
+	}
+}
+
+func TestEnsureRequestLogPartitionsSkipsExistingPartitions(t *testing.T) {
+	gdb, conn := scriptedDB(t, map[string][]driver.Value{
+		"relkind":                     {"p"},
+		"to_regclass($1) IS NOT NULL": {true},
+	})
+	if err := db.EnsureRequestLogPartitions(gdb, db.RequestLogPartitionConfig{Retention: 30, Premake: 3}); err != nil {
+		t.Fatal(err)
+	}
+	stmts := conn.executed()
+	// 已有的分區表補上默認分區，不重建已有的日分區
+	if indexOf(stmts, "CREATE TABLE IF NOT EXISTS request_logs_default PARTITION OF request_logs DEFAULT") < 0 {
+		t.Errorf("default partition not ensured:\n%s", strings.Join(stmts, "\n"))
+	}
+	if i := indexOf(stmts, "ATTACH PARTITION"); i >= 0 {
+		t.Errorf("existing partition recreated: %s", stmts[i])
+	}
+}
+
+func TestMaintainRequestLogPartitionsKeepsDefaultPartition(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	expired := db.RequestLogPartitionName(now.AddDate(0, 0, -40))
+	kept := db.RequestLogPartitionName(now.AddDate(0, 0, -1))
+	gdb, conn := scriptedDB(t, map[string][]driver.Value{
+		"pg_try_advisory_xact_lock":   {true},
+		"to_regclass($1) IS NOT NULL": {true},
+		"pg_inherits":                 {expired, kept, "request_logs_default"},
+	})
+	if err := db.MaintainRequestLogPartitions(gdb, db.RequestLogPartitionConfig{Retention: 30, FileContentRetention: 7, Premake: 3}, now); err != nil {
+		t.Fatal(err)
+	}
+	stmts := conn.executed()
+	if indexOf(stmts, "DROP TABLE "+expired) < 0 {
+		t.Errorf("expired partition %s not dropped:\n%s", expired, strings.Join(stmts, "\n"))
+	}
+	for _, name := range []string{kept, "request_logs_default"} {
+		if i := indexOf(stmts, "DROP TABLE "+name); i >= 0 {
+			t.Errorf("dropped %s", name)
+		}
+	}
+	if indexOf(stmts, "DELETE FROM request_logs_default WHERE created_at <") < 0 {
+		t.Errorf("expired rows in the default partition not cleaned:\n%s", strings.Join(stmts, "\n"))
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"test-git/handler"
+	"test-git/model"
+	"test-git/repository"
+	"test-git/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestLogCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	cursor := service.EncodeLogCursor(createdAt, 42)
+	gotTime, gotID, err := service.DecodeLogCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotTime.Equal(createdAt) || gotID != 42 {
+		t.Errorf("DecodeLogCursor = %v, %d; want %v, 42", gotTime, gotID, createdAt)
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	for _, cursor := range []string{
+		"not base64!",
+		encode([]byte("123")),
+		encode([]byte("abc:1")),
+		encode([]byte("123:-1")),
+		base64.URLEncoding.EncodeToString([]byte("12:1")), // 帶填充
+	} {
+		if _, _, err := service.DecodeLogCursor(cursor); !errors.Is(err, service.ErrInvalidCursor) {
+			t.Errorf("DecodeLogCursor(%q) err = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func requestLogPageSQL(t *testing.T, filter service.RequestLogFilter, cursor string, limit int) string {
+	t.Helper()
+	gdb := dialectOnlyDB(t)
+	var queryErr error
+	sql := gdb.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		query, err := service.RequestLogPageQuery(tx, filter, cursor, limit)
+		if err != nil {
+			queryErr = err
+			return tx
+		}
+		return query.Find(&[]model.RequestLog{})
+	})
+	if queryErr != nil {
+		t.Fatal(queryErr)
+	}
+	return sql
+}
+
+func TestRequestLogPageQuery(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	sql := requestLogPageSQL(t, service.RequestLogFilter{
+		From:        &from,
+		To:          &to,
+		Path:        "/roles/100%_*",
+		Method:      "post",
+		StatusMin:   400,
+		StatusMax:   499,
+		RemoteIP:    "10.0.0.1",
+		RequestID:   "req-1",
+		MinLatency:  0.5,
+		ServiceName: "test-git",
+		ContentType: "multipart/form-data",
+	}, service.EncodeLogCursor(to, 7), 20)
+
+	for _, want := range []string{
+		`SELECT "id","request_id"`,
+		`created_at >= '2025-03-01 00:00:00'`,
+		`created_at < '2025-03-02 00:00:00'`,
+		`path LIKE '/roles/100\%\_%'`,
+		`method = 'POST'`,
+		`status_code >= 400`,
+		`status_code <= 499`,
+		`remote_ip = '10.0.0.1'`,
+		`request_id = 'req-1'`,
+		`request_time >= 0.5`,
+		`service_name = 'test-git'`,
+		`content_type = 'multipart/form-data'`,
+		`(created_at, id) < ('2025-03-02 00:00:00`,
+		`ORDER BY created_at DESC, id DESC LIMIT 21`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query missing %q:\n%s", want, sql)
+		}
+	}
+	if strings.Contains(sql, "file_content_json") {
+		t.Errorf("list query selects file contents:\n%s", sql)
+	}
+}
+
+func TestRequestLogPageQueryZeroFilter(t *testing.T) {
+	sql := requestLogPageSQL(t, service.RequestLogFilter{Path: "/roles"}, "", 10)
+	if !strings.Contains(sql, `WHERE path = '/roles' ORDER BY`) {
+		t.Errorf("exact path filter:\n%s", sql)
+	}
+	for _, unwanted := range []string{"created_at >=", "status_code >=", "(created_at, id)"} {
+		if strings.Contains(sql, unwanted) {
+			t.Errorf("zero filter adds %q:\n%s", unwanted, sql)
+		}
+	}
+
+	if _, err := service.RequestLogPageQuery(dialectOnlyDB(t), service.RequestLogFilter{}, "bad cursor", 10); !errors.Is(err, service.ErrInvalidCursor) {
+		t.Errorf("RequestLogPageQuery bad cursor err = %v", err)
+	}
+}
+
+func TestListRequestLogsHandlerLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := dryRunDatabases(t)
+	audits := repository.NewMemoryAuditRepository()
+	r := gin.New()
+	r.GET("/admin/request-logs", handler.AdminListRequestLogsHandler(service.NewRequestLogService(audits)))
+	list := func(query string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/request-logs?"+query, nil))
+		return w.Code
+	}
+
+	for _, query := range []string{"limit=abc", "limit=0", "limit=-1"} {
+		if code := list(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, code)
+		}
+	}
+	// 超過上限時按上限查詢，多取一條判斷是否有下一頁
+	if code := list("limit=500"); code != http.StatusOK || !strings.Contains(recorder.all(), "LIMIT 201") {
+		t.Errorf("limit=500: status = %d, queries:\n%s", code, recorder.all())
+	}
+	if list := audits.List(); len(list) != 1 || list[0].Action != service.AuditSearchRequestLogs {
+		t.Errorf("audits = %+v", list)
+	}
+}
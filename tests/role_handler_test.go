@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"test-git/common"
+	"test-git/handler"
+	"test-git/policy"
+	"test-git/repository"
+	"test-git/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newStoreRouter 使用內存存儲的角色和書籍路由，X-Test-User 和 X-Test-Role 指定當前用戶
+func newStoreRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemory()
+	roles := service.NewRoleService(repos.Roles)
+	books := service.NewBookService(repos.Books)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		role := policy.Role(c.GetHeader("X-Test-Role"))
+		if role == "" {
+			role = policy.Player
+		}
+		common.SetSubject(c, policy.Subject{UserID: c.GetHeader("X-Test-User"), Roles: []policy.Role{role}})
+	})
+	r.GET("/roles", handler.ListRoleHandler(roles))
+	r.GET("/roles/:id", handler.GetRoleHandler(roles))
+	r.POST("/roles/create", handler.CreateRoleHandler(roles))
+	r.PUT("/roles/:id", handler.UpdateRoleHandler(roles))
+	r.DELETE("/roles/:id", handler.DeleteRoleHandler(roles))
+	r.GET("/books", handler.ListBooksHandler(books))
+	r.POST("/books", handler.CreateBookHandler(books))
+	return r
+}
+
+func serveAs(r http.Handler, user string, role policy.Role, method, path string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", user)
+	req.Header.Set("X-Test-Role", string(role))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRoleHandlersWithMemoryStore(t *testing.T) {
+	card, err := os.ReadFile("../role.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]json.RawMessage{"name": []byte(`"x"`), "role_data": card})
+	r := newStoreRouter()
+
+	w := serveAs(r, "alice", "", http.MethodPost, "/roles/create", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body)
+	}
+	var created handler.RoleResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	path := "/roles/" + strconv.FormatUint(uint64(created.ID), 10)
+	if w := serveAs(r, "bob", "", http.MethodPost, "/roles/create", body); w.Code != http.StatusCreated {
+		t.Fatalf("create as bob = %d", w.Code)
+	}
+
+	var list handler.RoleListResponse
+	w = serveAs(r, "alice", "", http.MethodGet, "/roles", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || list.List[0].ID != created.ID {
+		t.Errorf("alice's roles = %+v", list)
+	}
+
+	if w := serveAs(r, "bob", "", http.MethodGet, path, nil); w.Code != http.StatusForbidden {
+		t.Errorf("bob reading alice's role = %d, want 403", w.Code)
+	}
+	if w := serveAs(r, "keeper", policy.Keeper, http.MethodGet, path, nil); w.Code != http.StatusOK {
+		t.Errorf("keeper reading alice's role = %d, want 200", w.Code)
+	}
+	if w := serveAs(r, "bob", "", http.MethodDelete, path, nil); w.Code != http.StatusForbidden {
+		t.Errorf("bob deleting alice's role = %d, want 403", w.Code)
+	}
+
+	if w := serveAs(r, "alice", "", http.MethodPut, path, body); w.Code != http.StatusNoContent {
+		t.Errorf("update = %d %s", w.Code, w.Body)
+	}
+	if w := serveAs(r, "alice", "", http.MethodDelete, path, nil); w.Code != http.StatusNoContent {
+		t.Errorf("delete = %d %s", w.Code, w.Body)
+	}
+	if w := serveAs(r, "alice", "", http.MethodGet, path, nil); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted role = %d, want 404", w.Code)
+	}
+	if w := serveAs(r, "alice", "", http.MethodPut, path, body); w.Code != http.StatusNotFound {
+		t.Errorf("update deleted role = %d, want 404", w.Code)
+	}
+}
+
+func TestBookHandlersWithMemoryStore(t *testing.T) {
+	r := newStoreRouter()
+	body := []byte(`{"title":"克蘇魯的呼喚","author":"洛夫克拉夫特","price":42}`)
+
+	if w := serveAs(r, "alice", "", http.MethodPost, "/books", body); w.Code != http.StatusForbidden {
+		t.Errorf("player creating a book = %d, want 403", w.Code)
+	}
+	if w := serveAs(r, "keeper", policy.Keeper, http.MethodPost, "/books", body); w.Code != http.StatusCreated {
+		t.Fatalf("keeper creating a book = %d %s", w.Code, w.Body)
+	}
+
+	var list handler.BookListResponse
+	w := serveAs(r, "alice", "", http.MethodGet, "/books", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || list.List[0].Title != "克蘇魯的呼喚" {
+		t.Errorf("books = %+v", list)
+	}
+}
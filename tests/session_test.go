@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"test-git/common"
+	"test-git/wechat"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionSigner(t *testing.T) {
+	signer := common.NewSessionSigner([]byte("secret"), time.Hour)
+	token, _, err := signer.Issue(common.SessionClaims{OpenID: "openid-1"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	claims, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.OpenID != "openid-1" {
+		t.Errorf("OpenID = %q, want %q", claims.OpenID, "openid-1")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"tampered payload", "x" + token, common.ErrInvalidToken},
+		{"missing signature", strings.Split(token, ".")[0], common.ErrInvalidToken},
+		{"other secret", mustIssue(t, common.NewSessionSigner([]byte("other"), time.Hour)), common.ErrInvalidToken},
+		{"expired", mustIssue(t, common.NewSessionSigner([]byte("secret"), time.Nanosecond)), common.ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := signer.Verify(tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	signer := common.NewSessionSigner([]byte("secret"), time.Hour)
+	token := mustIssue(t, signer)
+
+	trusted := common.GatewayConfig{Enabled: true, TrustedProxies: mustParseCIDRs(t, "192.0.2.0/24")}
+
+	tests := []struct {
+		name       string
+		gateway    common.GatewayConfig
+		header     map[string]string
+		wantStatus int
+		wantUser   string
+	}{
+		{"bearer token", common.GatewayConfig{}, map[string]string{"Authorization": "Bearer " + token}, http.StatusOK, "openid-1"},
+		{"spoofed header", common.GatewayConfig{}, map[string]string{common.WxOpenID: "victim"}, http.StatusUnauthorized, ""},
+		{"no identity", trusted, nil, http.StatusUnauthorized, ""},
+		{"trusted header", trusted, map[string]string{common.WxOpenID: "gateway-user"}, http.StatusOK, "gateway-user"},
+		{"invalid token", trusted, map[string]string{"Authorization": "Bearer bad.token"}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(common.HeaderMiddleware(tt.gateway))
+			r.Use(common.SessionMiddleware(signer))
+			r.GET("/", func(c *gin.Context) {
+				c.String(http.StatusOK, common.GetUserID(c))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != tt.wantUser {
+				t.Errorf("user = %q, want %q", w.Body.String(), tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestFakeCode2Session(t *testing.T) {
+	client := wechat.NewFakeClient()
+	client.Register("known", wechat.Session{OpenID: "registered", UnionID: "union"})
+
+	session, err := client.Code2Session(context.Background(), "known")
+	if err != nil || session.OpenID != "registered" {
+		t.Errorf("Code2Session(known) = %+v, %v", session, err)
+	}
+	session, err = client.Code2Session(context.Background(), "abc")
+	if err != nil || session.OpenID != "fake_abc" {
+		t.Errorf("Code2Session(abc) = %+v, %v", session, err)
+	}
+	if _, err := client.Code2Session(context.Background(), "invalid"); !errors.Is(err, wechat.ErrInvalidCode) {
+		t.Errorf("Code2Session(invalid) error = %v, want %v", err, wechat.ErrInvalidCode)
+	}
+}
+
+func mustIssue(t *testing.T, signer *common.SessionSigner) string {
+	t.Helper()
+	token, _, err := signer.Issue(common.SessionClaims{OpenID: "openid-1"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	return token
+}
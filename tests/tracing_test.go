@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"test-git/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDAndTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "traces.ndjson")
+	shutdown, err := common.InitTracing(context.Background(), common.TracingConfig{
+		Exporter:    common.TraceExporterFile,
+		File:        file,
+		SampleRatio: 1,
+		ServiceName: "test-git",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(common.RequestIDMiddleware())
+	r.Use(common.TracingMiddleware())
+	r.GET("/roles/:id", func(c *gin.Context) {
+		_, span := common.StartSpan(c.Request.Context(), "service.GetRoleByID")
+		span.End()
+		c.JSON(http.StatusNotFound, common.ErrorBody(c, "角色不存在"))
+	})
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parent  = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodGet, "/roles/7", nil)
+	req.Header.Set(common.RequestIDHeader, "upstream-req.42")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parent+"-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get(common.RequestIDHeader); got != "upstream-req.42" {
+		t.Fatalf("X-Request-ID = %q, want the incoming one", got)
+	}
+	if got := w.Header().Get("X-Trace-ID"); got != traceID {
+		t.Fatalf("X-Trace-ID = %q, want %q", got, traceID)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["request_id"] != "upstream-req.42" || body["error"] == "" {
+		t.Fatalf("error body = %s", w.Body.String())
+	}
+
+	// 不合法的請求 ID 被替換
+	req = httptest.NewRequest(http.MethodGet, "/roles/8", nil)
+	req.Header.Set(common.RequestIDHeader, "bad id\r\nX-Injected: 1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get(common.RequestIDHeader); got == "" || got == req.Header.Get(common.RequestIDHeader) {
+		t.Fatalf("invalid X-Request-ID should be replaced, got %q", got)
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	type spanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	spans := map[string]struct {
+		SpanContext spanContext
+		Parent      spanContext
+	}{}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s struct {
+			Name        string
+			SpanContext spanContext
+			Parent      spanContext
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.SpanContext.TraceID == traceID {
+			spans[s.Name] = struct {
+				SpanContext spanContext
+				Parent      spanContext
+			}{s.SpanContext, s.Parent}
+		}
+	}
+
+	server, ok := spans["GET /roles/:id"]
+	if !ok || server.Parent.SpanID != parent {
+		t.Fatalf("server span should continue the incoming trace: %+v", spans)
+	}
+	child, ok := spans["service.GetRoleByID"]
+	if !ok || child.Parent.SpanID != server.SpanContext.SpanID {
+		t.Fatalf("service span should be a child of the server span: %+v", spans)
+	}
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"test-git/common"
+)
+
+func TestUserRef(t *testing.T) {
+	key := []byte("user-ref-key")
+	ref := common.UserRef(key, "o6_bmjrPTlm6")
+	if ref == "" || strings.Contains(ref, "o6_bmjrPTlm6") {
+		t.Fatalf("UserRef = %q", ref)
+	}
+	// 同一用戶的引用相同，便於按用戶篩選日志
+	if again := common.UserRef(key, "o6_bmjrPTlm6"); again != ref {
+		t.Errorf("UserRef is not deterministic: %q != %q", again, ref)
+	}
+	if other := common.UserRef(key, "o6_other"); other == ref {
+		t.Errorf("different users share a reference %q", ref)
+	}
+	if userID, err := common.ResolveUserRef(key, ref); err != nil || userID != "o6_bmjrPTlm6" {
+		t.Fatalf("ResolveUserRef = %q, %v", userID, err)
+	}
+
+	for _, bad := range []struct {
+		key []byte
+		ref string
+	}{
+		{[]byte("wrong-key"), ref},
+		{nil, ref},
+		{key, ref[:len(ref)-2]},
+		{key, "u1.!!"},
+	} {
+		if _, err := common.ResolveUserRef(bad.key, bad.ref); !errors.Is(err, common.ErrInvalidUserRef) {
+			t.Errorf("ResolveUserRef(%q, %q) err = %v, want ErrInvalidUserRef", bad.key, bad.ref, err)
+		}
+	}
+
+	// 沒有密鑰時記錄哈希引用，仍然可以按用戶篩選，但不能還原
+	hashed := common.UserRef(nil, "o6_bmjrPTlm6")
+	if hashed == "" || strings.Contains(hashed, "o6_bmjrPTlm6") || hashed != common.UserRef(nil, "o6_bmjrPTlm6") {
+		t.Errorf("UserRef without key = %q", hashed)
+	}
+	if _, err := common.ResolveUserRef(key, hashed); !errors.Is(err, common.ErrInvalidUserRef) {
+		t.Errorf("ResolveUserRef(hashed) err = %v, want ErrInvalidUserRef", err)
+	}
+	if ref := common.UserRef(key, ""); ref != "" {
+		t.Errorf("UserRef of anonymous request = %q", ref)
+	}
+
+	// 舊日志中的明文原樣返回
+	if userID, err := common.ResolveUserRef(nil, "o-legacy"); err != nil || userID != "o-legacy" {
+		t.Errorf("ResolveUserRef legacy = %q, %v", userID, err)
+	}
+}
@@ -0,0 +1,115 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultBaseURL = "https://api.weixin.qq.com"
+
+var ErrInvalidCode = errors.New("wx.login code 無效或已過期")
+
+// Session code2session 換取到的用戶身份
+type Session struct {
+	OpenID     string `json:"openid"`
+	UnionID    string `json:"unionid"`
+	SessionKey string `json:"session_key"`
+}
+
+// Code2SessionClient 用 wx.login 返回的 code 換取用戶身份
+type Code2SessionClient interface {
+	Code2Session(ctx context.Context, code string) (*Session, error)
+}
+
+// Client 調用微信官方 jscode2session 接口
+type Client struct {
+	AppID      string
+	AppSecret  string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+type code2SessionResponse struct {
+	Session
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func NewClient(appID, appSecret string) *Client {
+	return &Client{
+		AppID:      appID,
+		AppSecret:  appSecret,
+		BaseURL:    defaultBaseURL,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Config 登錄使用的小程序配置
+type Config struct {
+	Fake      bool // WX_CODE2SESSION=fake 時使用本地假實現
+	AppID     string
+	AppSecret string
+}
+
+// LoadConfig 讀取 WX_CODE2SESSION、WX_APPID 和 WX_SECRET，lookup 的形式與 os.LookupEnv 相同
+func LoadConfig(lookup func(string) (string, bool)) Config {
+	mode, _ := lookup("WX_CODE2SESSION")
+	appID, _ := lookup("WX_APPID")
+	secret, _ := lookup("WX_SECRET")
+	return Config{Fake: mode == "fake", AppID: appID, AppSecret: secret}
+}
+
+// NewClientFromConfig 根據配置選擇實現
+func NewClientFromConfig(cfg Config) Code2SessionClient {
+	if cfg.Fake {
+		return NewFakeClient()
+	}
+	return NewClient(cfg.AppID, cfg.AppSecret)
+}
+
+func (c *Client) Code2Session(ctx context.Context, code string) (*Session, error) {
+	query := url.Values{}
+	query.Set("appid", c.AppID)
+	query.Set("secret", c.AppSecret)
+	query.Set("js_code", code)
+	query.Set("grant_type", "authorization_code")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/sns/jscode2session?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("code2session request fails: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("code2session unexpected status: %d", resp.StatusCode)
+	}
+
+	var result code2SessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("code2session decode fails: %v", err)
+	}
+
+	switch result.ErrCode {
+	case 0:
+	case 40029, 40163:
+		// 40029: code 無效; 40163: code 已被使用
+		return nil, ErrInvalidCode
+	default:
+		return nil, fmt.Errorf("code2session errcode %d: %s", result.ErrCode, result.ErrMsg)
+	}
+
+	if result.OpenID == "" {
+		return nil, ErrInvalidCode
+	}
+	return &result.Session, nil
+}
@@ -0,0 +1,44 @@
+package wechat
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeClient 本地假實現，用於測試和本地開發，不會請求微信服務器
+//
+// 預先註冊的 code 返回對應的 Session；未註冊的 code 以 "fake_" + code 作為 openid，
+// 空 code 或以 "invalid" 開頭的 code 返回 ErrInvalidCode。
+type FakeClient struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{sessions: make(map[string]*Session)}
+}
+
+// Register 註冊一個 code 對應的身份
+func (f *FakeClient) Register(code string, session Session) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions[code] = &session
+}
+
+func (f *FakeClient) Code2Session(ctx context.Context, code string) (*Session, error) {
+	if code == "" || strings.HasPrefix(code, "invalid") {
+		return nil, ErrInvalidCode
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if session, ok := f.sessions[code]; ok {
+		copied := *session
+		return &copied, nil
+	}
+	return &Session{
+		OpenID:     "fake_" + code,
+		SessionKey: "fake_session_key",
+	}, nil
+}